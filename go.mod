@@ -1,4 +1,4 @@
-module cm-int-user-details
+module user-details
 
 go 1.15
 
@@ -7,7 +7,12 @@ replace vendor.lib/tng/tng-lib => bitbucket.centene.com/tng/tng-lib v1.0.10
 require (
 	vendor.lib/tng/tng-lib v0.0.0-00010101000000-000000000000
 	github.com/denisenkom/go-mssqldb v0.0.0-20200910202707-1e08a3fab204
+	github.com/gorilla/context v1.1.1
+	github.com/gorilla/mux v1.8.0
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.7.1
 	github.com/rs/cors v1.7.0
 	github.com/rs/zerolog v1.20.0
+	go.mongodb.org/mongo-driver v1.4.1
+	golang.org/x/crypto v0.0.0-20190530122614-20be4c3c3ed5
 )
@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"user-details/pkg/model"
+)
+
+// Fields of the changes Diff reports although the JSON document of users leaves them out.
+const (
+	PasswordField = "/password"
+	LockoutField  = "/lockedUntil"
+)
+
+// redacted replaces the values of sensitive fields in changes.
+var redacted = json.RawMessage(`"[REDACTED]"`)
+
+type contextKey struct{}
+
+type origin struct {
+	actor     model.Actor
+	requestID string
+}
+
+// WithActor returns a copy of ctx carrying the actor and id of the request writes are made for.
+func WithActor(ctx context.Context, actor model.Actor, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, origin{actor: actor, requestID: requestID})
+}
+
+// ActorFromContext returns the actor and request id stored in ctx by WithActor, zero values when there are none.
+func ActorFromContext(ctx context.Context) (model.Actor, string) {
+	o, _ := ctx.Value(contextKey{}).(origin)
+	return o.actor, o.requestID
+}
+
+// Diff returns the top level fields that differ between the JSON documents of before and after, in field order. A
+// created or deleted user is diffed against the zero User. Fields the documents leave out but that matter to an
+// audit, the password and the lockout, are reported as well; password values are redacted.
+func Diff(before, after model.User) ([]model.Change, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(a)+len(b))
+	for name := range b {
+		names = append(names, name)
+	}
+	for name := range a {
+		if _, ok := b[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := make([]model.Change, 0)
+	for _, name := range names {
+		// every write changes the version, which the record carries on its own
+		if name == "version" || bytes.Equal(b[name], a[name]) {
+			continue
+		}
+		changes = append(changes, model.Change{Field: "/" + name, Before: b[name], After: a[name]})
+	}
+
+	if before.PasswordHash+before.LegacyPassword != after.PasswordHash+after.LegacyPassword {
+		change := model.Change{Field: PasswordField}
+		if before.PasswordHash != "" || before.LegacyPassword != "" {
+			change.Before = redacted
+		}
+		if after.PasswordHash != "" || after.LegacyPassword != "" {
+			change.After = redacted
+		}
+		changes = append(changes, change)
+	}
+	if !sameTime(before, after) {
+		change := model.Change{Field: LockoutField}
+		if before.LockedUntil != nil {
+			change.Before, _ = json.Marshal(before.LockedUntil)
+		}
+		if after.LockedUntil != nil {
+			change.After, _ = json.Marshal(after.LockedUntil)
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// fields returns the JSON values of the non-empty top level fields of the document of user.
+func fields(user model.User) (map[string]json.RawMessage, error) {
+	doc := make(map[string]json.RawMessage)
+	if user.ID == "" {
+		return doc, nil
+	}
+	// the plaintext password is never part of an audit
+	user.Password = ""
+	body, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	for name, value := range doc {
+		if string(value) == "null" || string(value) == `""` {
+			delete(doc, name)
+		}
+	}
+	return doc, nil
+}
+
+func sameTime(before, after model.User) bool {
+	if before.LockedUntil == nil || after.LockedUntil == nil {
+		return before.LockedUntil == after.LockedUntil
+	}
+	return before.LockedUntil.Equal(*after.LockedUntil)
+}
@@ -0,0 +1,47 @@
+package canonical
+
+import (
+	"strings"
+)
+
+// Config represents the canonicalization settings read from app.json.
+type Config struct {
+	// PlusTagDomains lists the email domains whose mailboxes ignore everything from the first '+' of the local part,
+	// such as gmail.com.
+	PlusTagDomains []string `json:"plus-tag-domains"`
+}
+
+// Canonicalizer reduces emails and user names to the form they are stored and looked up by.
+type Canonicalizer struct {
+	plusTagDomains map[string]bool
+}
+
+// New creates a Canonicalizer.
+func New(conf Config) *Canonicalizer {
+	domains := make(map[string]bool, len(conf.PlusTagDomains))
+	for _, d := range conf.PlusTagDomains {
+		domains[strings.ToLower(strings.TrimSpace(d))] = true
+	}
+	return &Canonicalizer{plusTagDomains: domains}
+}
+
+// Email trims and lowercases email, stripping the plus tag of the local part for the configured domains.
+func (c *Canonicalizer) Email(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+	if c.plusTagDomains[domain] {
+		if plus := strings.Index(local, "+"); plus >= 0 {
+			local = local[:plus]
+		}
+	}
+	return local + "@" + domain
+}
+
+// UserName trims and lowercases name.
+func (c *Canonicalizer) UserName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
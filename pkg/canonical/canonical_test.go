@@ -0,0 +1,51 @@
+package canonical
+
+import "testing"
+
+func TestEmail(t *testing.T) {
+	c := New(Config{PlusTagDomains: []string{"gmail.com", " Googlemail.COM "}})
+	tests := []struct {
+		name  string
+		email string
+		want  string
+	}{
+		{"canonical", "ada@example.com", "ada@example.com"},
+		{"case and spaces", "  Ada@Example.COM ", "ada@example.com"},
+		{"plus tag", "ada+news@gmail.com", "ada@gmail.com"},
+		{"plus tag of a domain configured in another case", "Ada+News@googlemail.com", "ada@googlemail.com"},
+		{"several plus signs", "ada+news+2021@gmail.com", "ada@gmail.com"},
+		{"plus tag of another domain", "ada+news@example.com", "ada+news@example.com"},
+		{"plus sign in the domain", "ada@gmail.com+news", "ada@gmail.com+news"},
+		{"at sign in a quoted local part", `"ada@home"+x@gmail.com`, `"ada@home"@gmail.com`},
+		{"no domain", " Ada+News ", "ada+news"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Email(tt.email); got != tt.want {
+				t.Errorf("Email(%q) = %q, want %q", tt.email, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserName(t *testing.T) {
+	c := New(Config{})
+	tests := []struct {
+		name     string
+		userName string
+		want     string
+	}{
+		{"canonical", "ada", "ada"},
+		{"case and spaces", "\tAda.Lovelace ", "ada.lovelace"},
+		{"plus sign", "Ada+1", "ada+1"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.UserName(tt.userName); got != tt.want {
+				t.Errorf("UserName(%q) = %q, want %q", tt.userName, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,17 @@
 package config
 
 import (
+	"time"
+	"user-details/pkg/canonical"
+	"user-details/pkg/dedupe"
+	"user-details/pkg/encryption"
+	"user-details/pkg/erasure"
+	"user-details/pkg/events"
+	"user-details/pkg/masking"
+	"user-details/pkg/password"
+	"user-details/pkg/tokenization"
+	"user-details/pkg/webhook"
+
 	"vendor.lib/tng/tng-lib/config"
 )
 
@@ -10,22 +21,85 @@ const (
 
 	shutdownTimeoutEnvVar  = "SHUTDOWN_TIMEOUT"
 	defaultShutdownTimeout = 25
+
+	appFile        = "config/app.json"
+	datasourceFile = "config/datasource.json"
 )
 
+// Files lists the files the configuration is read from.
+var Files = []string{appFile, datasourceFile}
+
 // Config application configuration
 type Config struct {
 	config.Application
+	Datasource
+
+	// AuditCollection names the collection, or sql table, the audit trail of users is stored in.
+	AuditCollection string `json:"audit-collection"`
+	// SnapshotCollection names the collection, or sql table, the earlier versions of users are kept in.
+	SnapshotCollection string `json:"snapshot-collection"`
+	// ConsentCollection names the collection, or sql table, the consents of users are stored in.
+	ConsentCollection string `json:"consent-collection"`
+	// AccessCollection names the collection, or sql table, the reads of users are logged in.
+	AccessCollection string `json:"access-collection"`
+	// MergeCollection names the collection, or sql table, the redirects of merged users are stored in.
+	MergeCollection string `json:"merge-collection"`
+	// OutboxCollection names the collection, or sql table, the change events of users are kept in until they are
+	// published.
+	OutboxCollection string `json:"outbox-collection"`
+	// SequenceCollection names the mongo collection the counter numbering change events is kept in.
+	SequenceCollection string `json:"sequence-collection"`
+	// WebhookCollection and DeliveryCollection name the collections, or sql tables, webhooks and their deliveries are
+	// stored in.
+	WebhookCollection  string `json:"webhook-collection"`
+	DeliveryCollection string `json:"delivery-collection"`
+	// WatchCollection names the mongo collection the resume tokens of the user collection watcher are stored in.
+	WatchCollection string `json:"watch-collection"`
+	// WatchKeyCollection names the mongo collection the watcher keeps the user id of each user document in.
+	WatchKeyCollection string `json:"watch-key-collection"`
+	// TokenCollection names the mongo collection the tokens standing for user field values are stored in.
+	TokenCollection string `json:"token-collection"`
+	// ErasureCollection names the mongo collection the certificates of erased users are stored in.
+	ErasureCollection string `json:"erasure-collection"`
+
+	Passwords    password.Config      `json:"passwords"`
+	Canonical    canonical.Config     `json:"canonical"`
+	Masking      masking.Config       `json:"masking"`
+	Tokenization tokenization.Config  `json:"tokenization"`
+	Dedupe       dedupe.Config        `json:"dedupe"`
+	Events       events.Config        `json:"events"`
+	Webhooks     webhook.Config       `json:"webhooks"`
+	Watcher      events.WatcherConfig `json:"watcher"`
+	// RotationInterval is how often, in milliseconds, the configuration files are checked for rotated credentials.
+	// Zero disables rotation.
+	RotationInterval time.Duration `json:"rotation-interval-ms"`
+	// ComplianceRole is the role callers need to export users. Exports show user fields as the masking policy lets
+	// this role see them, whatever other roles the caller holds.
+	ComplianceRole string `json:"compliance-role"`
+	// StrictJSON rejects request bodies carrying fields that are not part of the user document.
+	StrictJSON bool `json:"strict-json"`
+}
+
+// Datasource extends the tng-lib datasource configuration with the settings of this application.
+type Datasource struct {
 	config.Datasource
+
+	// Users names the backend users are stored in: mongo, mssql or memory.
+	Users string `json:"users"`
+	// Encryption lists the keys the personal fields of users are encrypted with at rest.
+	Encryption encryption.Config `json:"encryption"`
+	// Erasure holds the key erasure certificates are signed with.
+	Erasure erasure.Config `json:"erasure"`
 }
 
 func GetConfig() (Config, error) {
 
 	conf := Config{}
-	if err := config.Read("config/app.json", &conf); err != nil {
+	if err := config.Read(appFile, &conf); err != nil {
 		return conf, err
 	}
 
-	if err := config.Read("config/datasource.json", &conf.Datasource); err != nil {
+	if err := config.Read(datasourceFile, &conf.Datasource); err != nil {
 		return conf, err
 	}
 
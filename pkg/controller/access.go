@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"context"
+	"time"
+	"user-details/pkg/audit"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// logAccesses logs that the caller read users by operation, see model.Access. A read whose access cannot be logged
+// fails, so that no user is seen without a trace.
+func (c *Controller) logAccesses(operation string, users []model.User, ctx context.Context) error {
+	if len(users) == 0 {
+		return nil
+	}
+	actor, requestID := audit.ActorFromContext(ctx)
+	now := time.Now().UTC()
+	accesses := make([]model.Access, len(users))
+	for i, user := range users {
+		accesses[i] = model.Access{ID: primitive.NewObjectID().Hex(), UserID: user.ID, Operation: operation,
+			Timestamp: now, Actor: actor, RequestID: requestID}
+	}
+	if err := c.datasource.Accesses().LogAccesses(accesses, ctx); err != nil {
+		return errors.Wrapf(err, "unable to log %s of users", operation)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"time"
+	"user-details/pkg/audit"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// historySort marks cursors of histories, which are ordered by record id.
+const historySort = "history"
+
+// UserHistory returns the page of audit records of the user stored under userId selected by limit, newest first.
+// cursor is the opaque Next value of the previous page, empty for the first page. The history of deleted users
+// remains available.
+func (c *Controller) UserHistory(userId string, limit int, cursor string, ctx context.Context) (model.HistoryPage, error) {
+	page := model.HistoryPage{Records: make([]model.AuditRecord, 0)}
+	if limit < 0 {
+		return page, errors.Wrap(model.ErrInvalidQuery, "limit must not be negative")
+	}
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	query := model.HistoryQuery{UserID: userId, Limit: limit + 1}
+	if cursor != "" {
+		before, err := decodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		if before.Sort != historySort {
+			return page, errors.Wrap(model.ErrInvalidQuery, "cursor does not belong to a history")
+		}
+		query.Before = before.ID
+	}
+
+	// one extra record tells whether another page follows
+	records, err := c.datasource.Audit().History(query, ctx)
+	if err != nil {
+		return page, errors.Wrapf(err, "unable to read history of user %s", userId)
+	}
+	if len(records) > limit {
+		records = records[:limit]
+		page.Next = encodeCursor(model.Cursor{Sort: historySort, Descending: true, ID: records[limit-1].ID})
+	}
+	page.Records = records
+	return page, nil
+}
+
+// record appends the audit record of operation made at the time at, before being the user the write replaced and
+// after the user it stored; the zero User stands for a user that did not exist. It is called within the transaction
+// of the write, so that a write is never left without its record.
+func (c *Controller) record(operation string, before, after model.User, at time.Time, ctx context.Context) error {
+	actor, requestID := audit.ActorFromContext(ctx)
+	record := model.AuditRecord{
+		ID:        primitive.NewObjectID().Hex(),
+		UserID:    after.ID,
+		Operation: operation,
+		Actor:     actor,
+		RequestID: requestID,
+		Timestamp: at,
+		Version:   after.Version,
+	}
+	if after.ID == "" {
+		record.UserID, record.Version = before.ID, before.Version
+	}
+
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		return errors.Wrapf(err, "unable to audit %s of user %s", operation, record.UserID)
+	}
+	// password checks write on every attempt, only changes of the password or lockout are worth a record
+	if operation == model.OpVerifyPassword && len(changes) == 0 {
+		return nil
+	}
+	record.Changes = changes
+
+	if err := c.datasource.Audit().Append(record, ctx); err != nil {
+		return errors.Wrapf(err, "unable to audit %s of user %s", operation, record.UserID)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"user-details/pkg/audit"
+	"user-details/pkg/config"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+func TestWritesAreAudited(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	actor := model.Actor{AccountName: "jdoe", Roles: []string{"user-details-admin"}}
+	ctx := audit.WithActor(context.Background(), actor, "req-1")
+
+	user := model.User{ID: "u1", FirstName: "Ada", LastName: "Byron", UserName: "ada", EmailID: "ada@example.com",
+		Password: "correct horse"}
+	if _, err := c.CreateUser(user, ctx); err != nil {
+		t.Fatal(err)
+	}
+	user.LastName, user.Password = "Lovelace", "battery staple"
+	if _, _, err := c.ReplaceUser(user, 1, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveUser("u1", 2, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := c.UserHistory("u1", 0, "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redacted := `"[REDACTED]"`
+	tests := []struct {
+		operation string
+		version   int64
+		// changes maps the fields checked to their values before and after, empty when absent
+		changes map[string][2]string
+	}{
+		{model.OpDelete, 2, map[string][2]string{"/lastName": {`"Lovelace"`, ""}, audit.PasswordField: {redacted, ""}}},
+		{model.OpReplace, 2, map[string][2]string{"/lastName": {`"Byron"`, `"Lovelace"`},
+			audit.PasswordField: {redacted, redacted}}},
+		{model.OpCreate, 1, map[string][2]string{"/lastName": {"", `"Byron"`}, audit.PasswordField: {"", redacted}}},
+	}
+	if len(page.Records) != len(tests) {
+		t.Fatalf("history holds %d records, want %d", len(page.Records), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.operation, func(t *testing.T) {
+			record := page.Records[i]
+			if record.Operation != tt.operation || record.Version != tt.version {
+				t.Errorf("record %d is %s of version %d, want %s of version %d", i, record.Operation, record.Version,
+					tt.operation, tt.version)
+			}
+			if !reflect.DeepEqual(record.Actor, actor) || record.RequestID != "req-1" {
+				t.Errorf("record was made by %+v for request %q, want %+v for req-1", record.Actor, record.RequestID,
+					actor)
+			}
+			changes := make(map[string][2]string)
+			for _, change := range record.Changes {
+				changes[change.Field] = [2]string{string(change.Before), string(change.After)}
+			}
+			for field, want := range tt.changes {
+				if got, ok := changes[field]; !ok || got != want {
+					t.Errorf("%s changed from %s to %s, want from %s to %s", field, got[0], got[1], want[0], want[1])
+				}
+			}
+		})
+	}
+}
+
+func TestUserHistoryPages(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+	user := model.User{ID: "u1", FirstName: "Ada", LastName: "Lovelace", UserName: "ada", EmailID: "ada@example.com"}
+	if _, err := c.CreateUser(user, ctx); err != nil {
+		t.Fatal(err)
+	}
+	for version := int64(1); version < 5; version++ {
+		user.FirstName = user.FirstName + "a"
+		if _, _, err := c.ReplaceUser(user, version, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the history of version 5 down to 1 is read two records at a time
+	var versions []int64
+	cursor, pages := "", 0
+	for {
+		page, err := c.UserHistory("u1", 2, cursor, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, record := range page.Records {
+			versions = append(versions, record.Version)
+		}
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+	if want := []int64{5, 4, 3, 2, 1}; !reflect.DeepEqual(versions, want) || pages != 3 {
+		t.Errorf("history read versions %v in %d pages, want %v in 3", versions, pages, want)
+	}
+
+	tests := []struct {
+		name   string
+		limit  int
+		cursor string
+		err    error
+	}{
+		{"negative limit", -1, "", model.ErrInvalidQuery},
+		{"malformed cursor", 2, "not a cursor", model.ErrInvalidQuery},
+		{"cursor of a user listing", 2, encodeCursor(model.Cursor{Sort: "id", ID: "u1"}), model.ErrInvalidQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.UserHistory("u1", tt.limit, tt.cursor, ctx); errors.Cause(err) != tt.err {
+				t.Errorf("history failed with %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
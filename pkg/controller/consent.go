@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"time"
+	"user-details/pkg/audit"
+	"user-details/pkg/model"
+	"user-details/pkg/validate"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DecodeConsent reads a JSON consent document from body, see DecodeUser.
+func (c *Controller) DecodeConsent(body io.Reader) (model.Consent, error) {
+	var consent model.Consent
+	err := c.decode(body, &consent)
+	return consent, err
+}
+
+// RecordConsent appends consent to the consents of the user stored under userId. The id, time and caller of the
+// consent are set here.
+func (c *Controller) RecordConsent(userId string, consent model.Consent, ctx context.Context) (model.Consent, error) {
+	if errs := validate.Struct(consent); len(errs) > 0 {
+		return consent, errs
+	}
+	if _, err := c.user(userId, ctx); err != nil {
+		return consent, err
+	}
+	consent.ID = primitive.NewObjectID().Hex()
+	consent.UserID = userId
+	consent.Timestamp = time.Now().UTC()
+	consent.Actor, consent.RequestID = audit.ActorFromContext(ctx)
+	if err := c.datasource.Consents().Record(consent, ctx); err != nil {
+		return consent, errors.Wrapf(err, "unable to record consent of user %s", userId)
+	}
+	return consent, nil
+}
+
+// UserConsents returns the consents of the user stored under userId to purpose, or to every purpose when purpose is
+// empty, newest first.
+func (c *Controller) UserConsents(userId, purpose string, ctx context.Context) ([]model.Consent, error) {
+	if purpose != "" && !knownPurpose(purpose) {
+		return nil, errors.Wrapf(model.ErrInvalidQuery, "unknown purpose %s", purpose)
+	}
+	consents, err := c.consents(userId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]model.Consent, 0, len(consents))
+	for i := len(consents) - 1; i >= 0; i-- {
+		if purpose == "" || consents[i].Purpose == purpose {
+			selected = append(selected, consents[i])
+		}
+	}
+	return selected, nil
+}
+
+// EffectiveConsents returns the consent of the user stored under userId in effect for every purpose.
+func (c *Controller) EffectiveConsents(userId string, ctx context.Context) ([]model.ConsentState, error) {
+	consents, err := c.consents(userId, ctx)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]*model.ConsentState, len(model.ConsentPurposes))
+	for _, purpose := range model.ConsentPurposes {
+		states[purpose] = &model.ConsentState{Purpose: purpose}
+	}
+	// consents are oldest first, so the latest one of each purpose is applied last
+	for i := range consents {
+		consent := consents[i]
+		state, ok := states[consent.Purpose]
+		if !ok {
+			continue
+		}
+		state.Granted = consent.Action == model.ConsentGrant
+		if state.Granted {
+			state.GrantedAt = &consent.Timestamp
+		} else {
+			state.RevokedAt = &consent.Timestamp
+		}
+		state.Source, state.PolicyVersion = consent.Source, consent.PolicyVersion
+	}
+
+	effective := make([]model.ConsentState, len(model.ConsentPurposes))
+	for i, purpose := range model.ConsentPurposes {
+		effective[i] = *states[purpose]
+	}
+	return effective, nil
+}
+
+func (c *Controller) consents(userId string, ctx context.Context) ([]model.Consent, error) {
+	if _, err := c.user(userId, ctx); err != nil {
+		return nil, err
+	}
+	consents, err := c.datasource.Consents().Consents(userId, ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read consents of user %s", userId)
+	}
+	return consents, nil
+}
+
+func knownPurpose(purpose string) bool {
+	for _, p := range model.ConsentPurposes {
+		if p == purpose {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+	"user-details/pkg/config"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+func TestRecordConsent(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+	if _, err := c.CreateUser(model.User{ID: "u1", FirstName: "Ada", LastName: "Lovelace", UserName: "ada",
+		EmailID: "ada@example.com"}, ctx); err != nil {
+		t.Fatal(err)
+	}
+	valid := model.Consent{Purpose: model.PurposeSMS, Action: model.ConsentGrant, Source: "web", PolicyVersion: "v1"}
+
+	tests := []struct {
+		name    string
+		userId  string
+		consent func(model.Consent) model.Consent
+		pointer string
+		err     error
+	}{
+		{"valid consent", "u1", func(c model.Consent) model.Consent { return c }, "", nil},
+		{"unknown purpose", "u1", func(c model.Consent) model.Consent { c.Purpose = "telepathy"; return c }, "/purpose",
+			nil},
+		{"unknown action", "u1", func(c model.Consent) model.Consent { c.Action = "maybe"; return c }, "/action", nil},
+		{"no source", "u1", func(c model.Consent) model.Consent { c.Source = ""; return c }, "/source", nil},
+		{"no policy version", "u1", func(c model.Consent) model.Consent { c.PolicyVersion = ""; return c },
+			"/policyVersion", nil},
+		{"unknown user", "u9", func(c model.Consent) model.Consent { return c }, "", model.ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consent, err := c.RecordConsent(tt.userId, tt.consent(valid), ctx)
+			if tt.pointer != "" {
+				errs, ok := errors.Cause(err).(model.FieldErrors)
+				if !ok || len(errs) != 1 || errs[0].Pointer != tt.pointer {
+					t.Errorf("record failed with %v, want an error at %s", err, tt.pointer)
+				}
+				return
+			}
+			if errors.Cause(err) != tt.err {
+				t.Fatalf("record failed with %v, want %v", err, tt.err)
+			}
+			if err == nil && (consent.ID == "" || consent.UserID != "u1" || consent.Timestamp.IsZero()) {
+				t.Errorf("recorded %+v, want an id, the user and a timestamp", consent)
+			}
+		})
+	}
+}
+
+func TestConsentsAreAppended(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+	if _, err := c.CreateUser(model.User{ID: "u1", FirstName: "Ada", LastName: "Lovelace", UserName: "ada",
+		EmailID: "ada@example.com"}, ctx); err != nil {
+		t.Fatal(err)
+	}
+	// sms is granted, revoked and granted again under a newer policy, marketing email granted then revoked
+	recorded := []model.Consent{
+		{Purpose: model.PurposeSMS, Action: model.ConsentGrant, Source: "web", PolicyVersion: "v1"},
+		{Purpose: model.PurposeMarketingEmail, Action: model.ConsentGrant, Source: "web", PolicyVersion: "v1"},
+		{Purpose: model.PurposeSMS, Action: model.ConsentRevoke, Source: "call-center", PolicyVersion: "v1"},
+		{Purpose: model.PurposeMarketingEmail, Action: model.ConsentRevoke, Source: "web", PolicyVersion: "v1"},
+		{Purpose: model.PurposeSMS, Action: model.ConsentGrant, Source: "app", PolicyVersion: "v2"},
+	}
+	for i := range recorded {
+		consent, err := c.RecordConsent("u1", recorded[i], ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded[i] = consent
+	}
+
+	t.Run("history", func(t *testing.T) {
+		tests := []struct {
+			purpose string
+			// want indexes the consents recorded, newest first
+			want []int
+			err  error
+		}{
+			{"", []int{4, 3, 2, 1, 0}, nil},
+			{model.PurposeSMS, []int{4, 2, 0}, nil},
+			{model.PurposeMarketingEmail, []int{3, 1}, nil},
+			{model.PurposeDataSharing, []int{}, nil},
+			{"telepathy", nil, model.ErrInvalidQuery},
+		}
+		for _, tt := range tests {
+			consents, err := c.UserConsents("u1", tt.purpose, ctx)
+			if errors.Cause(err) != tt.err {
+				t.Fatalf("consents to %q failed with %v, want %v", tt.purpose, err, tt.err)
+			}
+			got := make([]string, len(consents))
+			for i := range consents {
+				got[i] = consents[i].ID
+			}
+			want := make([]string, len(tt.want))
+			for i, j := range tt.want {
+				want[i] = recorded[j].ID
+			}
+			if err == nil && !reflect.DeepEqual(got, want) {
+				t.Errorf("consents to %q are %v, want %v", tt.purpose, got, want)
+			}
+		}
+	})
+
+	t.Run("effective", func(t *testing.T) {
+		states, err := c.EffectiveConsents("u1", ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			purpose   string
+			granted   bool
+			grantedAt *int
+			revokedAt *int
+			source    string
+			policy    string
+		}{
+			{model.PurposeMarketingEmail, false, index(1), index(3), "web", "v1"},
+			{model.PurposeSMS, true, index(4), index(2), "app", "v2"},
+			{model.PurposeDataSharing, false, nil, nil, "", ""},
+		}
+		if len(states) != len(tests) {
+			t.Fatalf("%d purposes are in effect, want %d", len(states), len(tests))
+		}
+		for i, tt := range tests {
+			state := states[i]
+			if state.Purpose != tt.purpose || state.Granted != tt.granted || state.Source != tt.source ||
+				state.PolicyVersion != tt.policy {
+				t.Errorf("%s is in effect as %+v, want granted %t from %s under %s", tt.purpose, state, tt.granted,
+					tt.source, tt.policy)
+			}
+			if !sameTime(state.GrantedAt, tt.grantedAt, recorded) || !sameTime(state.RevokedAt, tt.revokedAt, recorded) {
+				t.Errorf("%s was granted at %v and revoked at %v, want the times of consents %v and %v", tt.purpose,
+					state.GrantedAt, state.RevokedAt, tt.grantedAt, tt.revokedAt)
+			}
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		if _, err := c.EffectiveConsents("u9", ctx); errors.Cause(err) != model.ErrUserNotFound {
+			t.Errorf("effective consents failed with %v, want %v", err, model.ErrUserNotFound)
+		}
+	})
+}
+
+func index(i int) *int {
+	return &i
+}
+
+// sameTime reports whether at is the timestamp of the consent recorded at index i, or both are absent.
+func sameTime(at *time.Time, i *int, recorded []model.Consent) bool {
+	if at == nil || i == nil {
+		return at == nil && i == nil
+	}
+	return at.Equal(recorded[*i].Timestamp)
+}
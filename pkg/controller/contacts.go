@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"user-details/pkg/model"
+	"user-details/pkg/validate"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DecodePhone reads a JSON phone document from body, see DecodeUser.
+func (c *Controller) DecodePhone(body io.Reader) (model.Phone, error) {
+	var phone model.Phone
+	err := c.decode(body, &phone)
+	return phone, err
+}
+
+// DecodeAddress reads a JSON address document from body, see DecodeUser.
+func (c *Controller) DecodeAddress(body io.Reader) (model.Address, error) {
+	var address model.Address
+	err := c.decode(body, &address)
+	return address, err
+}
+
+// AddPhone adds phone to the user stored under userId when it is at version, see model.AnyVersion. A primary phone
+// takes over from the previous primary one.
+func (c *Controller) AddPhone(userId string, phone model.Phone, version int64, ctx context.Context) (model.User, model.Phone, error) {
+	if errs := validate.Struct(phone); len(errs) > 0 {
+		return model.User{}, phone, errs
+	}
+	if phone.ID == "" {
+		phone.ID = newContactID()
+	}
+	user, err := c.updateUser(userId, version, model.OpAddPhone, func(user *model.User) error {
+		if phone.Primary {
+			for i := range user.Phones {
+				user.Phones[i].Primary = false
+			}
+		}
+		user.Phones = append(user.Phones, phone)
+		return nil
+	}, ctx)
+	return user, phone, err
+}
+
+// ReplacePhone stores phone in place of the phone phoneId of the user stored under userId when the user is at
+// version, see model.AnyVersion.
+func (c *Controller) ReplacePhone(userId, phoneId string, phone model.Phone, version int64, ctx context.Context) (model.User, model.Phone, error) {
+	phone.ID = phoneId
+	if errs := validate.Struct(phone); len(errs) > 0 {
+		return model.User{}, phone, errs
+	}
+	user, err := c.updateUser(userId, version, model.OpReplacePhone, func(user *model.User) error {
+		for i := range user.Phones {
+			if user.Phones[i].ID == phoneId {
+				if phone.Primary {
+					for j := range user.Phones {
+						user.Phones[j].Primary = false
+					}
+				}
+				user.Phones[i] = phone
+				return nil
+			}
+		}
+		return errors.Wrapf(model.ErrContactNotFound, "unable to find phone %s of user %s", phoneId, userId)
+	}, ctx)
+	return user, phone, err
+}
+
+// RemovePhone removes the phone phoneId of the user stored under userId when the user is at version, see
+// model.AnyVersion.
+func (c *Controller) RemovePhone(userId, phoneId string, version int64, ctx context.Context) (model.User, error) {
+	return c.updateUser(userId, version, model.OpRemovePhone, func(user *model.User) error {
+		for i := range user.Phones {
+			if user.Phones[i].ID == phoneId {
+				user.Phones = append(user.Phones[:i], user.Phones[i+1:]...)
+				return nil
+			}
+		}
+		return errors.Wrapf(model.ErrContactNotFound, "unable to find phone %s of user %s", phoneId, userId)
+	}, ctx)
+}
+
+// AddAddress adds address to the user stored under userId when it is at version, see model.AnyVersion. A primary
+// address takes over from the previous primary one.
+func (c *Controller) AddAddress(userId string, address model.Address, version int64, ctx context.Context) (model.User, model.Address, error) {
+	if errs := validate.Struct(address); len(errs) > 0 {
+		return model.User{}, address, errs
+	}
+	if address.ID == "" {
+		address.ID = newContactID()
+	}
+	user, err := c.updateUser(userId, version, model.OpAddAddress, func(user *model.User) error {
+		if address.Primary {
+			for i := range user.Addresses {
+				user.Addresses[i].Primary = false
+			}
+		}
+		user.Addresses = append(user.Addresses, address)
+		return nil
+	}, ctx)
+	return user, address, err
+}
+
+// ReplaceAddress stores address in place of the address addressId of the user stored under userId when the user is
+// at version, see model.AnyVersion.
+func (c *Controller) ReplaceAddress(userId, addressId string, address model.Address, version int64, ctx context.Context) (model.User, model.Address, error) {
+	address.ID = addressId
+	if errs := validate.Struct(address); len(errs) > 0 {
+		return model.User{}, address, errs
+	}
+	user, err := c.updateUser(userId, version, model.OpReplaceAddress, func(user *model.User) error {
+		for i := range user.Addresses {
+			if user.Addresses[i].ID == addressId {
+				if address.Primary {
+					for j := range user.Addresses {
+						user.Addresses[j].Primary = false
+					}
+				}
+				user.Addresses[i] = address
+				return nil
+			}
+		}
+		return errors.Wrapf(model.ErrContactNotFound, "unable to find address %s of user %s", addressId, userId)
+	}, ctx)
+	return user, address, err
+}
+
+// RemoveAddress removes the address addressId of the user stored under userId when the user is at version, see
+// model.AnyVersion.
+func (c *Controller) RemoveAddress(userId, addressId string, version int64, ctx context.Context) (model.User, error) {
+	return c.updateUser(userId, version, model.OpRemoveAddress, func(user *model.User) error {
+		for i := range user.Addresses {
+			if user.Addresses[i].ID == addressId {
+				user.Addresses = append(user.Addresses[:i], user.Addresses[i+1:]...)
+				return nil
+			}
+		}
+		return errors.Wrapf(model.ErrContactNotFound, "unable to find address %s of user %s", addressId, userId)
+	}, ctx)
+}
+
+// updateUser applies mutate to the user stored under userId when it is at version, see model.AnyVersion, and stores
+// the result, auditing it as operation.
+func (c *Controller) updateUser(userId string, version int64, operation string, mutate func(user *model.User) error, ctx context.Context) (model.User, error) {
+	user, err := c.user(userId, ctx)
+	if err != nil {
+		return user, err
+	}
+	if version != model.AnyVersion && user.Version != version {
+		return user, errors.Wrapf(model.ErrVersionConflict, "unable to update user %s", userId)
+	}
+	current := clone(user)
+	if err := mutate(&user); err != nil {
+		return user, err
+	}
+	if errs := checkUser(&user); len(errs) > 0 {
+		return user, errs
+	}
+	if err := c.hashPassword(&user, user); err != nil {
+		return user, err
+	}
+	return c.storeUser(operation, current, user, user.Version, ctx)
+}
+
+// clone copies the contacts of user, so that mutating them in place leaves user untouched.
+func clone(user model.User) model.User {
+	user.Phones = append([]model.Phone(nil), user.Phones...)
+	user.Emails = append([]model.Email(nil), user.Emails...)
+	user.Addresses = append([]model.Address(nil), user.Addresses...)
+	return user
+}
+
+// checkUser assigns ids to the contacts of user that have none and returns the violations of its validation rules,
+// as well as contacts sharing an id and collections with more than one primary contact.
+func checkUser(user *model.User) model.FieldErrors {
+	phones := make([]contactKey, len(user.Phones))
+	for i := range user.Phones {
+		if user.Phones[i].ID == "" {
+			user.Phones[i].ID = newContactID()
+		}
+		phones[i] = contactKey{user.Phones[i].ID, user.Phones[i].Primary}
+	}
+	emails := make([]contactKey, len(user.Emails))
+	for i := range user.Emails {
+		if user.Emails[i].ID == "" {
+			user.Emails[i].ID = newContactID()
+		}
+		emails[i] = contactKey{user.Emails[i].ID, user.Emails[i].Primary}
+	}
+	addresses := make([]contactKey, len(user.Addresses))
+	for i := range user.Addresses {
+		if user.Addresses[i].ID == "" {
+			user.Addresses[i].ID = newContactID()
+		}
+		addresses[i] = contactKey{user.Addresses[i].ID, user.Addresses[i].Primary}
+	}
+
+	errs := validate.Struct(user)
+	errs = append(errs, checkContacts("/phones", phones)...)
+	errs = append(errs, checkContacts("/emails", emails)...)
+	errs = append(errs, checkContacts("/addresses", addresses)...)
+	return errs
+}
+
+// contactKey holds what checkContacts looks at of a phone, email or address.
+type contactKey struct {
+	id      string
+	primary bool
+}
+
+func checkContacts(pointer string, contacts []contactKey) model.FieldErrors {
+	errs := make(model.FieldErrors, 0)
+	ids := make(map[string]bool, len(contacts))
+	primary := false
+	for i, contact := range contacts {
+		if ids[contact.id] {
+			errs = append(errs, model.FieldError{Pointer: pointer + "/" + strconv.Itoa(i) + "/id", Message: "is already used by another entry"})
+		}
+		ids[contact.id] = true
+		if contact.primary && primary {
+			errs = append(errs, model.FieldError{Pointer: pointer + "/" + strconv.Itoa(i) + "/primary", Message: "only one entry can be primary"})
+		}
+		primary = primary || contact.primary
+	}
+	return errs
+}
+
+func newContactID() string {
+	return primitive.NewObjectID().Hex()
+}
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"user-details/pkg/config"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+// primaries returns the ids of the phones of user marked primary.
+func primaries(user model.User) []string {
+	ids := make([]string, 0)
+	for _, phone := range user.Phones {
+		if phone.Primary {
+			ids = append(ids, phone.ID)
+		}
+	}
+	return ids
+}
+
+// errInvalid stands for the field errors of a rejected contact in test tables.
+var errInvalid = errors.New("invalid contact")
+
+func TestPhonesKeepOnePrimary(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+	if _, err := c.CreateUser(model.User{ID: "u1", FirstName: "Ada", LastName: "Lovelace", UserName: "ada",
+		EmailID: "ada@example.com"}, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// each step runs against the user the previous ones left
+	tests := []struct {
+		name    string
+		write   func() (model.User, error)
+		phones  int
+		primary string
+		err     error
+	}{
+		{"first phone", func() (model.User, error) {
+			user, _, err := c.AddPhone("u1", model.Phone{ID: "p1", Type: "mobile", Number: "+15550100100",
+				Primary: true}, model.AnyVersion, ctx)
+			return user, err
+		}, 1, "p1", nil},
+		{"phone taking over as primary", func() (model.User, error) {
+			user, _, err := c.AddPhone("u1", model.Phone{ID: "p2", Type: "work", Number: "+15550100200",
+				Primary: true}, model.AnyVersion, ctx)
+			return user, err
+		}, 2, "p2", nil},
+		{"secondary phone", func() (model.User, error) {
+			user, _, err := c.AddPhone("u1", model.Phone{ID: "p3", Type: "home", Number: "+15550100300"},
+				model.AnyVersion, ctx)
+			return user, err
+		}, 3, "p2", nil},
+		{"phone replaced as primary", func() (model.User, error) {
+			user, _, err := c.ReplacePhone("u1", "p1", model.Phone{Type: "mobile", Number: "+15550100101",
+				Primary: true}, model.AnyVersion, ctx)
+			return user, err
+		}, 3, "p1", nil},
+		{"invalid number", func() (model.User, error) {
+			user, _, err := c.AddPhone("u1", model.Phone{Type: "mobile", Number: "555-0100"}, model.AnyVersion, ctx)
+			return user, err
+		}, 0, "", errInvalid},
+		{"unknown phone replaced", func() (model.User, error) {
+			user, _, err := c.ReplacePhone("u1", "p9", model.Phone{Type: "mobile", Number: "+15550100900"},
+				model.AnyVersion, ctx)
+			return user, err
+		}, 0, "", model.ErrContactNotFound},
+		{"stale version", func() (model.User, error) {
+			user, _, err := c.AddPhone("u1", model.Phone{Type: "mobile", Number: "+15550100400"}, 1, ctx)
+			return user, err
+		}, 0, "", model.ErrVersionConflict},
+		{"primary phone removed", func() (model.User, error) {
+			return c.RemovePhone("u1", "p1", model.AnyVersion, ctx)
+		}, 2, "", nil},
+		{"unknown phone removed", func() (model.User, error) {
+			return c.RemovePhone("u1", "p1", model.AnyVersion, ctx)
+		}, 0, "", model.ErrContactNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := tt.write()
+			if _, invalid := errors.Cause(err).(model.FieldErrors); invalid && tt.err == errInvalid {
+				return
+			}
+			if errors.Cause(err) != tt.err {
+				t.Fatalf("write failed with %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			want := []string{}
+			if tt.primary != "" {
+				want = []string{tt.primary}
+			}
+			if got := primaries(user); len(user.Phones) != tt.phones || len(got) != len(want) ||
+				(len(got) == 1 && got[0] != want[0]) {
+				t.Errorf("user has %d phones, primary %v, want %d, primary %v", len(user.Phones), got, tt.phones,
+					want)
+			}
+		})
+	}
+}
+
+func TestUsersHaveOnePrimaryContact(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+	address := model.Address{Type: "home", Lines: []string{"12 St James's Square"}, City: "New York", State: "NY",
+		Zip: "10001", Primary: true}
+
+	tests := []struct {
+		name    string
+		user    model.User
+		pointer string
+	}{
+		{"two primary phones", model.User{Phones: []model.Phone{
+			{Type: "mobile", Number: "+15550100100", Primary: true},
+			{Type: "work", Number: "+15550100200", Primary: true}}}, "/phones/1/primary"},
+		{"two primary addresses", model.User{Addresses: []model.Address{address, address}}, "/addresses/1/primary"},
+		{"phones sharing an id", model.User{Phones: []model.Phone{
+			{ID: "p1", Type: "mobile", Number: "+15550100100"},
+			{ID: "p1", Type: "work", Number: "+15550100200"}}}, "/phones/1/id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			user.ID, user.FirstName, user.LastName = "u1", "Ada", "Lovelace"
+			user.UserName, user.EmailID = "ada", "ada@example.com"
+			_, err := c.CreateUser(user, ctx)
+			errs, ok := errors.Cause(err).(model.FieldErrors)
+			if !ok || len(errs) != 1 || errs[0].Pointer != tt.pointer {
+				t.Errorf("create failed with %v, want an error at %s", err, tt.pointer)
+			}
+		})
+	}
+}
+
+func TestLegacyContactsMigrateOnRead(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+	// users stored before contacts were structured hold a free-form contact
+	if _, err := c.datasource.Users().Upsert(model.User{ID: "u1", FirstName: "Ada", LastName: "Lovelace",
+		UserName: "ada", EmailID: "ada@example.com", LegacyContact: "(555) 010-0199"}, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := c.FindUserDetails("u1", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.Phones) != 1 || user.Phones[0].Number != "+15550100199" || !user.Phones[0].Primary ||
+		user.LegacyContact != "" {
+		t.Fatalf("read user has phones %+v and contact %q, want the contact as its primary phone", user.Phones,
+			user.LegacyContact)
+	}
+
+	// the migrated phone keeps its id until the user is written, which stores it
+	stored, _, err := c.AddPhone("u1", model.Phone{Type: "work", Number: "+15550100200"}, model.AnyVersion, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.RemovePhone("u1", user.Phones[0].ID, stored.Version, ctx); err != nil {
+		t.Fatalf("removing the migrated phone failed: %v", err)
+	}
+	raw, err := c.datasource.Users().Get("u1", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.LegacyContact != "" || len(raw.Phones) != 1 || raw.Phones[0].Number != "+15550100200" {
+		t.Errorf("stored user has phones %+v and contact %q, want the added phone alone", raw.Phones,
+			raw.LegacyContact)
+	}
+}
@@ -1,20 +1,72 @@
 package controller
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"user-details/pkg/canonical"
 	"user-details/pkg/config"
 	"user-details/pkg/db"
+	"user-details/pkg/dedupe"
+	"user-details/pkg/encryption"
+	"user-details/pkg/erasure"
+	"user-details/pkg/events"
+	"user-details/pkg/masking"
+	"user-details/pkg/model"
+	"user-details/pkg/password"
+	"user-details/pkg/patch"
+	"user-details/pkg/tokenization"
+	"user-details/pkg/validate"
+	"user-details/pkg/webhook"
 	"net/http"
 	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	common "vendor.lib/tng/tng-lib/http"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+
+	// maxWriteAttempts bounds the retries of writes that lose a version race to a concurrent write.
+	maxWriteAttempts = 3
+)
+
+// validated lists the documents checked with validate.Struct, whose rules New checks once.
+var validated = []interface{}{model.User{}, model.Phone{}, model.Address{}, model.Consent{}, model.MergeRequest{},
+	model.Webhook{}}
+
 // Controller houses application's dependencies.
 type Controller struct {
 	datasource *db.Datasource
+	// mu guards clients, which are replaced when their configuration changes
+	mu         sync.RWMutex
 	clients    map[string]*common.Client
+	clientsCfg map[string]common.Config
+	passwords  *password.Hasher
+	canonical  *canonical.Canonicalizer
+	masking    *masking.Policy
+	tokens     tokenization.Config
+	erasure    *erasure.Signer
+	dedupe     *dedupe.Detector
+	duplicates dedupe.Index
+	events     events.Config
+	publisher  events.Publisher
+	webhooks   webhook.Config
+	watcher    events.WatcherConfig
+	compliance string
+	strict     bool
 }
 
 // New Create a new Controller
@@ -30,18 +82,71 @@ func New(cfg config.Config) (*Controller, error) {
 		clients[k] = client
 	}
 
-	return &Controller{
-		datasource: db.Initialize(cfg),
+	// the watcher tails a change stream of the mongo user collection, other datasources have none
+	if cfg.Watcher.Enabled && cfg.Users != "" && cfg.Users != db.MongoUsers {
+		return &Controller{}, errors.Errorf("Unable to watch users kept in %s, the watcher needs users kept in mongo", cfg.Users)
+	}
+
+	for _, v := range validated {
+		if err := validate.Check(v); err != nil {
+			return &Controller{}, errors.Wrapf(err, "Unable to validate %T", v)
+		}
+	}
+
+	passwords, err := password.New(cfg.Passwords)
+	if err != nil {
+		return &Controller{}, errors.Wrap(err, "Unable to make password hasher")
+	}
+
+	policy, err := masking.New(cfg.Masking)
+	if err != nil {
+		return &Controller{}, errors.Wrap(err, "Unable to make masking policy")
+	}
+
+	cipher, err := encryption.New(cfg.Encryption)
+	if err != nil {
+		return &Controller{}, errors.Wrap(err, "Unable to make field cipher")
+	}
+
+	detector, err := dedupe.New(cfg.Dedupe)
+	if err != nil {
+		return &Controller{}, errors.Wrap(err, "Unable to make duplicate detector")
+	}
+
+	c := &Controller{
+		datasource: db.Initialize(cfg, cipher),
 		clients:    clients,
-	}, nil
+		clientsCfg: cfg.Clients,
+		passwords:  passwords,
+		canonical:  canonical.New(cfg.Canonical),
+		masking:    policy,
+		tokens:     cfg.Tokenization,
+		erasure:    erasure.New(cfg.Erasure),
+		dedupe:     detector,
+		events:     cfg.Events.WithDefaults(),
+		webhooks:   cfg.Webhooks.WithDefaults(),
+		watcher:    cfg.Watcher.WithDefaults(),
+		compliance: cfg.ComplianceRole,
+		strict:     cfg.StrictJSON,
+	}
+	c.publisher, err = events.New(cfg.Events, c.client)
+	if err != nil {
+		return &Controller{}, errors.Wrap(err, "Unable to make event publisher")
+	}
+	return c, nil
+}
+
+// View returns the user fields a caller with roles may see.
+func (c *Controller) View(roles []string) masking.View {
+	return c.masking.For(roles)
 }
 
 // Ready K8s ready check. Verifies connection to all dependencies
 func (c *Controller) Ready() error {
 
-	if c.clients["login-service"] != nil {
+	if client := c.client("login-service"); client != nil {
 		uri := &url.URL{Path: "/pkg"}
-		resp, err := c.clients["login-service"].Get(uri, http.Header{})
+		resp, err := client.Get(uri, http.Header{})
 		if err != nil {
 			log.Error().Stack().Caller().Err(err).Send()
 			return err
@@ -51,14 +156,14 @@ func (c *Controller) Ready() error {
 		}
 	}
 
-	err := c.datasource.Mongo.Ping()
+	err := c.datasource.Mongo().Ping()
 	if err != nil {
 		e := log.Error().Stack().Caller().Err(err)
 		e.Msgf("could not connect to Mongo database,configure in datasource.json")
 		return err
 	}
 
-	err = c.datasource.Mssql.Ping()
+	err = c.datasource.Mssql().Ping()
 	if err != nil {
 		e := log.Error().Stack().Caller().Err(err)
 		e.Msgf("could not connect to database, configure in datasource.json")
@@ -68,16 +173,407 @@ func (c *Controller) Ready() error {
 	return nil
 }
 
-func (c *Controller) FindUserDetails(userId string, ctx context.Context) ([]model.User, error){
-	var users []model.User
+// unknownFieldPrefix starts the errors of decoders disallowing unknown fields, followed by the quoted field.
+const unknownFieldPrefix = "json: unknown field "
+
+// unknownField returns the field err reports as unknown to a decoder disallowing unknown fields. encoding/json has
+// no error type for unknown fields, so they are told apart by their message, which TestUnknownField pins down.
+func unknownField(err error) (string, bool) {
+	if err == nil || !strings.HasPrefix(err.Error(), unknownFieldPrefix) {
+		return "", false
+	}
+	field, uerr := strconv.Unquote(strings.TrimPrefix(err.Error(), unknownFieldPrefix))
+	return field, uerr == nil
+}
+
+// DecodeUser reads a JSON user document from body. Values of the wrong type, and in strict mode unknown fields, are
+// reported as model.FieldErrors.
+func (c *Controller) DecodeUser(body io.Reader) (model.User, error) {
+	var user model.User
+	err := c.decode(body, &user)
+	return user, err
+}
+
+// decode reads the JSON document in body into v, see DecodeUser. The rejected value is pointed at by its path in the
+// document, see locate.
+func (c *Controller) decode(body io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return errors.Wrap(model.ErrMalformedBody, err.Error())
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if c.strict {
+		decoder.DisallowUnknownFields()
+	}
+	err = decoder.Decode(v)
+	e, wrongType := err.(*json.UnmarshalTypeError)
+	field, unknown := unknownField(err)
+	if wrongType || unknown {
+		if found, ok := locate(data, reflect.TypeOf(v), c.strict); ok {
+			return model.FieldErrors{found}
+		}
+	}
+	// locate only disagrees with encoding/json on documents it cannot walk, the fields encoding/json names are used then
+	if wrongType {
+		pointer := ""
+		for _, name := range strings.Split(e.Field, ".") {
+			pointer += "/" + escapeToken(name)
+		}
+		return model.FieldErrors{{Pointer: pointer, Message: "must be a " + e.Type.String()}}
+	}
+	if unknown {
+		return model.FieldErrors{{Pointer: "/" + escapeToken(field), Message: "unknown field"}}
+	}
+	if err != nil {
+		return errors.Wrap(model.ErrMalformedBody, err.Error())
+	}
+	return nil
+}
+
+// FindUserDetails returns the user stored under userId, logging the read.
+func (c *Controller) FindUserDetails(userId string, ctx context.Context) (model.User, error) {
+	user, err := c.user(userId, ctx)
+	if err != nil {
+		return user, err
+	}
+	return user, c.logAccesses(model.AccessRead, []model.User{user}, ctx)
+}
 
-	user, err := c.datasource.Mongo.FindUser(userId, ctx)
-	
-	return user
+// user returns the user stored under userId without logging the read, for reads the caller does not see.
+func (c *Controller) user(userId string, ctx context.Context) (model.User, error) {
+	user, err := c.datasource.Users().Get(userId, ctx)
+	if err != nil {
+		return user, errors.Wrapf(err, "unable to find user %s", userId)
+	}
+	user.MigrateContact()
+	return user, nil
 }
 
-func (c *Controller) IngestUser(userDetails model.User, ctx context.Context) (string, error){
-	id, err := c.datasource.Mongo.UpsertUser(userDetails,ctx)
+// FindUserByEmail returns the user whose email has the same canonical form as email.
+func (c *Controller) FindUserByEmail(email string, ctx context.Context) (model.User, error) {
+	users, err := c.datasource.Users().Search(model.UserFilter{CanonicalEmail: c.canonical.Email(email)}, ctx)
+	if err != nil {
+		return model.User{}, errors.Wrapf(err, "unable to find user by email %s", email)
+	}
+	user, err := single(users, "email "+email)
+	if err != nil {
+		return user, err
+	}
+	return user, c.logAccesses(model.AccessRead, []model.User{user}, ctx)
+}
+
+// FindUserByUserName returns the user whose user name has the same canonical form as name.
+func (c *Controller) FindUserByUserName(name string, ctx context.Context) (model.User, error) {
+	users, err := c.datasource.Users().Search(model.UserFilter{CanonicalUserName: c.canonical.UserName(name)}, ctx)
+	if err != nil {
+		return model.User{}, errors.Wrapf(err, "unable to find user by user name %s", name)
+	}
+	user, err := single(users, "user name "+name)
+	if err != nil {
+		return user, err
+	}
+	return user, c.logAccesses(model.AccessRead, []model.User{user}, ctx)
+}
 
-	return id, nil
+// IngestUser stores userDetails when the user stored under the same id is at version, 0 meaning it may not exist yet.
+// The stored user is returned with its new version.
+func (c *Controller) IngestUser(userDetails model.User, version int64, ctx context.Context) (model.User, error) {
+	userDetails.CanonicalEmail = c.canonical.Email(userDetails.EmailID)
+	userDetails.CanonicalUserName = c.canonical.UserName(userDetails.UserName)
+	user, err := c.datasource.Users().Upsert(userDetails, version, ctx)
+	if err != nil {
+		return user, errors.Wrapf(err, "unable to ingest user %s", userDetails.ID)
+	}
+	return user, nil
+}
+
+// CreateUser stores userDetails as a new user, failing with model.ErrUserExists when its id is already taken.
+func (c *Controller) CreateUser(userDetails model.User, ctx context.Context) (model.User, error) {
+	_, err := c.user(userDetails.ID, ctx)
+	if err == nil {
+		return userDetails, errors.Wrapf(model.ErrUserExists, "unable to create user %s", userDetails.ID)
+	}
+	if errors.Cause(err) != model.ErrUserNotFound {
+		return userDetails, err
+	}
+	if errs := checkUser(&userDetails); len(errs) > 0 {
+		return userDetails, errs
+	}
+	if err := c.hashPassword(&userDetails, model.User{}); err != nil {
+		return userDetails, err
+	}
+	user, err := c.storeUser(model.OpCreate, model.User{}, userDetails, 0, ctx)
+	if errors.Cause(err) == model.ErrVersionConflict {
+		return user, errors.Wrapf(model.ErrUserExists, "unable to create user %s", userDetails.ID)
+	}
+	if err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+// ReplaceUser stores userDetails in place of the user stored under the same id, creating it when it does not exist.
+// The write only applies when the stored user is at version, see model.AnyVersion. created reports whether the user
+// is new.
+func (c *Controller) ReplaceUser(userDetails model.User, version int64, ctx context.Context) (user model.User, created bool, err error) {
+	if errs := checkUser(&userDetails); len(errs) > 0 {
+		return userDetails, false, errs
+	}
+	current, err := c.user(userDetails.ID, ctx)
+	if errors.Cause(err) == model.ErrUserNotFound {
+		created = true
+	} else if err != nil {
+		return current, false, err
+	}
+	if version != model.AnyVersion && (created || current.Version != version) {
+		return current, false, errors.Wrapf(model.ErrVersionConflict, "unable to replace user %s", userDetails.ID)
+	}
+	if err := c.hashPassword(&userDetails, current); err != nil {
+		return current, false, err
+	}
+
+	operation := model.OpReplace
+	if created {
+		operation = model.OpCreate
+	}
+	user, err = c.storeUser(operation, current, userDetails, current.Version, ctx)
+	if err != nil {
+		return user, false, err
+	}
+	return user, created, nil
+}
+
+// PatchUser applies p to the user stored under userId when it is at version and stores the result. Changing the id
+// is rejected with model.FieldErrors.
+func (c *Controller) PatchUser(userId string, p patch.Patch, version int64, ctx context.Context) (model.User, error) {
+	user, err := c.user(userId, ctx)
+	if err != nil {
+		return user, err
+	}
+	if version != model.AnyVersion && user.Version != version {
+		return user, errors.Wrapf(model.ErrVersionConflict, "unable to patch user %s", userId)
+	}
+
+	doc, err := json.Marshal(user)
+	if err != nil {
+		return user, err
+	}
+	doc, err = p.Apply(doc)
+	if err != nil {
+		return user, errors.Wrapf(err, "unable to patch user %s", userId)
+	}
+
+	patched, err := c.DecodeUser(bytes.NewReader(doc))
+	if err != nil {
+		return user, err
+	}
+	if patched.ID != user.ID {
+		return user, model.FieldErrors{{Pointer: "/id", Message: "field is immutable"}}
+	}
+	if errs := checkUser(&patched); len(errs) > 0 {
+		return user, errs
+	}
+	if err := c.hashPassword(&patched, user); err != nil {
+		return user, err
+	}
+
+	return c.storeUser(model.OpPatch, user, patched, user.Version, ctx)
+}
+
+// VerifyPassword checks plain against the password of the user stored under userId. Consecutive failures are
+// counted on the user, which is locked once they reach the configured maximum; checks of a locked user fail without
+// looking at the password. Hashes produced under earlier hashing settings, as well as legacy plaintext passwords,
+// are upgraded once the password is known to match.
+func (c *Controller) VerifyPassword(userId, plain string, ctx context.Context) (model.PasswordCheck, error) {
+	var check model.PasswordCheck
+	maxFailures, window := c.passwords.Lockout()
+
+	// concurrent checks of the same user conflict on its version, so retry with the fresher user
+	for attempt := 0; attempt < maxWriteAttempts; attempt++ {
+		user, err := c.user(userId, ctx)
+		if err != nil {
+			return check, err
+		}
+		current := user
+
+		now := time.Now().UTC()
+		if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+			check.LockedUntil = user.LockedUntil
+			return check, nil
+		}
+
+		switch {
+		case user.PasswordHash != "":
+			check.Valid, err = c.passwords.Verify(plain, user.PasswordHash)
+			if err != nil {
+				return check, errors.Wrapf(err, "unable to verify password of user %s", userId)
+			}
+		case user.LegacyPassword != "":
+			check.Valid = subtle.ConstantTimeCompare([]byte(plain), []byte(user.LegacyPassword)) == 1
+		}
+
+		rehash := check.Valid && (user.PasswordHash == "" || c.passwords.NeedsRehash(user.PasswordHash))
+		if check.Valid {
+			if user.FailedLogins == 0 && user.LockedUntil == nil && !rehash {
+				return check, nil
+			}
+			user.FailedLogins, user.LockedUntil = 0, nil
+		} else {
+			user.FailedLogins++
+			user.LockedUntil = nil
+			if user.FailedLogins >= maxFailures {
+				lockedUntil := now.Add(window)
+				user.FailedLogins, user.LockedUntil = 0, &lockedUntil
+				check.LockedUntil = &lockedUntil
+			}
+		}
+
+		if rehash {
+			user.Password = plain
+			if err := c.hashPassword(&user, user); err != nil {
+				return check, err
+			}
+		}
+		_, err = c.storeUser(model.OpVerifyPassword, current, user, user.Version, ctx)
+		if errors.Cause(err) == model.ErrVersionConflict {
+			check = model.PasswordCheck{}
+			continue
+		}
+		if err != nil {
+			return check, err
+		}
+		return check, nil
+	}
+	return check, errors.Wrapf(model.ErrVersionConflict, "unable to record password check of user %s", userId)
+}
+
+// RemoveUser deletes the user stored under userId when it is at version, see model.AnyVersion.
+func (c *Controller) RemoveUser(userId string, version int64, ctx context.Context) error {
+	user, err := c.user(userId, ctx)
+	if err != nil {
+		return err
+	}
+	if version != model.AnyVersion && user.Version != version {
+		return errors.Wrapf(model.ErrVersionConflict, "unable to remove user %s", userId)
+	}
+	// deleting at the version read makes sure the audit records the user that was removed
+	if err := c.deleteUser(model.OpDelete, user, ctx); err != nil {
+		return errors.Wrapf(err, "unable to remove user %s", userId)
+	}
+	return nil
+}
+
+// ListUsers returns the page of users selected by query. cursor is the opaque Next value of the previous page,
+// empty for the first page.
+func (c *Controller) ListUsers(query model.UserQuery, cursor string, ctx context.Context) (model.UserPage, error) {
+	page := model.UserPage{Users: make([]model.User, 0)}
+	if query.Sort == "" {
+		query.Sort = "id"
+	}
+	if !validSortField(query.Sort) {
+		return page, errors.Wrapf(model.ErrInvalidQuery, "unable to sort users by %s", query.Sort)
+	}
+	if query.Limit < 0 {
+		return page, errors.Wrap(model.ErrInvalidQuery, "limit must not be negative")
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultPageSize
+	}
+	if query.Limit > maxPageSize {
+		query.Limit = maxPageSize
+	}
+
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		if after.Sort != query.Sort || after.Descending != query.Descending {
+			return page, errors.Wrap(model.ErrInvalidQuery, "cursor belongs to a listing in a different order")
+		}
+		query.After = &after
+	}
+
+	// fetch one extra user to find out whether another page follows
+	limit := query.Limit
+	query.Limit++
+	users, err := c.datasource.Users().List(query, ctx)
+	if err != nil {
+		return page, errors.Wrap(err, "unable to list users")
+	}
+	for i := range users {
+		users[i].MigrateContact()
+	}
+	if len(users) > limit {
+		users = users[:limit]
+		last := users[limit-1]
+		page.Next = encodeCursor(model.Cursor{
+			Sort:       query.Sort,
+			Descending: query.Descending,
+			Value:      last.SortValue(query.Sort),
+			ID:         last.ID,
+		})
+	}
+	page.Users = users
+	return page, c.logAccesses(model.AccessList, users, ctx)
+}
+
+// hashPassword replaces the plaintext password of user by its hash. Without a new password the hash and lockout
+// state of current are kept, hashing its legacy plaintext password if it has one. A new password clears the lockout.
+func (c *Controller) hashPassword(user *model.User, current model.User) error {
+	plain := user.Password
+	user.Password, user.PasswordHash, user.LegacyPassword = "", current.PasswordHash, ""
+	user.FailedLogins, user.LockedUntil = 0, nil
+	if plain == "" {
+		user.FailedLogins, user.LockedUntil = current.FailedLogins, current.LockedUntil
+		if current.LegacyPassword == "" {
+			return nil
+		}
+		plain = current.LegacyPassword
+	}
+
+	hash, err := c.passwords.Hash(plain)
+	if err != nil {
+		return errors.Wrapf(err, "unable to hash password of user %s", user.ID)
+	}
+	user.PasswordHash = hash
+	return nil
+}
+
+// single returns the only user of users, which were looked up by key.
+func single(users []model.User, key string) (model.User, error) {
+	switch len(users) {
+	case 0:
+		return model.User{}, errors.Wrapf(model.ErrUserNotFound, "unable to find user by %s", key)
+	case 1:
+		users[0].MigrateContact()
+		return users[0], nil
+	}
+	return model.User{}, errors.Wrapf(model.ErrAmbiguousLookup, "unable to find user by %s", key)
+}
+
+func validSortField(field string) bool {
+	for _, f := range model.SortFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeCursor(cursor model.Cursor) string {
+	body, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(body)
+}
+
+func decodeCursor(cursor string) (model.Cursor, error) {
+	var after model.Cursor
+	body, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(body, &after)
+	}
+	if err != nil {
+		return after, errors.Wrap(model.ErrInvalidQuery, "malformed cursor")
+	}
+	return after, nil
 }
@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"user-details/pkg/config"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+func TestUnknownField(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		field string
+		ok    bool
+	}{
+		{"unknown field", `{"id": "u1", "nickname": "ada"}`, "nickname", true},
+		{"quoted name", `{"say \"hi\"": 1}`, `say "hi"`, true},
+		{"known fields", `{"id": "u1"}`, "", false},
+		{"malformed", `{"id": `, "", false},
+		{"wrong type", `{"id": 1}`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the error of encoding/json itself, so a change of its message fails here
+			decoder := json.NewDecoder(strings.NewReader(tt.body))
+			decoder.DisallowUnknownFields()
+			var user model.User
+			field, ok := unknownField(decoder.Decode(&user))
+			if field != tt.field || ok != tt.ok {
+				t.Errorf("unknownField found %q, %v, want %q, %v", field, ok, tt.field, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDecodePointsAtRejectedValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		strict  bool
+		body    string
+		pointer string
+		message string
+	}{
+		{"unknown field", true, `{"id": "u1", "nickname": "ada"}`, "/nickname", "unknown field"},
+		{"unknown field of a phone", true, `{"phones": [{"type": "mobile"}, {"number": "+15550100", "ext": "1"}]}`,
+			"/phones/1/ext", "unknown field"},
+		{"unknown field escaped", true, `{"addresses": [{"a/b~c": 1}]}`, "/addresses/0/a~1b~0c", "unknown field"},
+		{"unknown fields allowed", false, `{"nickname": {"a/b": [1]}, "id": 1}`, "/id", "must be a string"},
+		{"wrong type", false, `{"id": 1}`, "/id", "must be a string"},
+		{"wrong type in a phone", false, `{"phones": [{}, {}, {"primary": "yes"}]}`, "/phones/2/primary",
+			"must be a bool"},
+		{"wrong type of a line", false, `{"addresses": [{"lines": ["12 Main St", 12]}]}`, "/addresses/0/lines/1",
+			"must be a string"},
+		{"object for a slice", false, `{"phones": {"number": "+15550100"}}`, "/phones", "must be a []model.Phone"},
+		{"fraction for an integer", false, `{"businessUnit": 1.5}`, "/businessUnit", "must be a int"},
+		{"member in another case", false, `{"FIRSTNAME": 1}`, "/FIRSTNAME", "must be a string"},
+		{"first of several", true, `{"emails": [{"address": 1}], "nickname": "ada"}`, "/emails/0/address",
+			"must be a string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Controller{strict: tt.strict}
+			_, err := c.DecodeUser(strings.NewReader(tt.body))
+			errs, ok := errors.Cause(err).(model.FieldErrors)
+			if !ok || len(errs) != 1 || errs[0].Pointer != tt.pointer || errs[0].Message != tt.message {
+				t.Errorf("decoding failed with %v, want %s: %s", err, tt.pointer, tt.message)
+			}
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+	for _, u := range []model.User{
+		{ID: "u1", FirstName: "Ada", LastName: "Lovelace", UserName: "ada", EmailID: "ada@example.com",
+			Phones: []model.Phone{{Type: "mobile", Number: "+15550100", Primary: true}}},
+		{ID: "u2", FirstName: "Grace", LastName: "Hopper", UserName: "grace", EmailID: "grace@navy.mil"},
+		{ID: "u3", FirstName: "Alan", LastName: "Turing", UserName: "alan", EmailID: "alan@example.com"},
+		{ID: "u4", FirstName: "Augusta", LastName: "Lovelace", UserName: "augusta", EmailID: "augusta@example.org"},
+	} {
+		if _, err := c.CreateUser(u, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query model.UserQuery
+		want  []string
+		err   error
+	}{
+		{"every user", model.UserQuery{}, []string{"u1", "u2", "u3", "u4"}, nil},
+		{"last name", model.UserQuery{LastName: "Lovelace"}, []string{"u1", "u4"}, nil},
+		{"user name", model.UserQuery{UserName: "grace"}, []string{"u2"}, nil},
+		{"email prefix", model.UserQuery{EmailPrefix: "a"}, []string{"u1", "u3", "u4"}, nil},
+		{"phone", model.UserQuery{Phone: "+15550100"}, []string{"u1"}, nil},
+		{"several filters", model.UserQuery{LastName: "Lovelace", EmailPrefix: "au"}, []string{"u4"}, nil},
+		{"sorted by last name", model.UserQuery{Sort: "lastName"}, []string{"u2", "u1", "u4", "u3"}, nil},
+		{"sorted by user name descending", model.UserQuery{Sort: "userName", Descending: true},
+			[]string{"u2", "u4", "u3", "u1"}, nil},
+		{"unknown sort", model.UserQuery{Sort: "password"}, nil, model.ErrInvalidQuery},
+		{"negative limit", model.UserQuery{Limit: -1}, nil, model.ErrInvalidQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := c.ListUsers(tt.query, "", ctx)
+			if errors.Cause(err) != tt.err {
+				t.Fatalf("listing failed with %v, want %v", err, tt.err)
+			}
+			var got []string
+			for _, u := range page.Users {
+				got = append(got, u.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) || page.Next != "" {
+				t.Errorf("listed %v with next %q, want %v on a single page", got, page.Next, tt.want)
+			}
+		})
+	}
+}
+
+func TestListUsersPages(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+	// users sharing a last name are ordered by id, across pages too
+	for _, u := range []model.User{
+		{ID: "u1", FirstName: "Ada", LastName: "Lovelace", UserName: "ada", EmailID: "ada@example.com"},
+		{ID: "u2", FirstName: "Grace", LastName: "Hopper", UserName: "grace", EmailID: "grace@navy.mil"},
+		{ID: "u3", FirstName: "Alan", LastName: "Turing", UserName: "alan", EmailID: "alan@example.com"},
+		{ID: "u4", FirstName: "Augusta", LastName: "Lovelace", UserName: "augusta", EmailID: "augusta@example.org"},
+		{ID: "u5", FirstName: "Byron", LastName: "Lovelace", UserName: "byron", EmailID: "byron@example.org"},
+	} {
+		if _, err := c.CreateUser(u, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query model.UserQuery
+		want  [][]string
+	}{
+		{"by id", model.UserQuery{Limit: 2}, [][]string{{"u1", "u2"}, {"u3", "u4"}, {"u5"}}},
+		{"by last name", model.UserQuery{Sort: "lastName", Limit: 2}, [][]string{{"u2", "u1"}, {"u4", "u5"}, {"u3"}}},
+		{"by last name descending", model.UserQuery{Sort: "lastName", Descending: true, Limit: 2},
+			[][]string{{"u3", "u5"}, {"u4", "u1"}, {"u2"}}},
+		{"filtered", model.UserQuery{LastName: "Lovelace", Limit: 2}, [][]string{{"u1", "u4"}, {"u5"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			cursor := ""
+			for {
+				page, err := c.ListUsers(tt.query, cursor, ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids := make([]string, 0, len(page.Users))
+				for _, u := range page.Users {
+					ids = append(ids, u.ID)
+				}
+				got = append(got, ids)
+				if page.Next == "" || len(got) > len(tt.want) {
+					break
+				}
+				cursor = page.Next
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed pages %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	page, err := c.ListUsers(model.UserQuery{Limit: 2}, "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []model.UserQuery{{Sort: "lastName"}, {Descending: true}} {
+		if _, err := c.ListUsers(query, page.Next, ctx); errors.Cause(err) != model.ErrInvalidQuery {
+			t.Errorf("listing %+v after a cursor of another order failed with %v, want %v", query, err,
+				model.ErrInvalidQuery)
+		}
+	}
+	if _, err := c.ListUsers(model.UserQuery{}, "not a cursor", ctx); errors.Cause(err) != model.ErrInvalidQuery {
+		t.Errorf("listing after a malformed cursor failed with %v, want %v", err, model.ErrInvalidQuery)
+	}
+}
+
+func TestVerifyPasswordLocksOut(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+	if _, err := c.CreateUser(model.User{ID: "u1", FirstName: "Ada", LastName: "Lovelace", UserName: "ada",
+		EmailID: "ada@example.com", Password: "correct horse"}, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// each check runs against the user the previous ones left, users are locked after 2 failures in a row
+	tests := []struct {
+		name     string
+		password string
+		valid    bool
+		locked   bool
+	}{
+		{"wrong password", "wrong", false, false},
+		{"right password", "correct horse", true, false},
+		{"failure counted from the last success", "wrong", false, false},
+		{"second failure in a row", "wrong", false, true},
+		{"right password while locked", "correct horse", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check, err := c.VerifyPassword("u1", tt.password, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if check.Valid != tt.valid || (check.LockedUntil != nil) != tt.locked {
+				t.Errorf("check is valid %v and locked until %v, want valid %v and locked %v", check.Valid,
+					check.LockedUntil, tt.valid, tt.locked)
+			}
+		})
+	}
+
+	if _, err := c.VerifyPassword("u2", "correct horse", ctx); errors.Cause(err) != model.ErrUserNotFound {
+		t.Errorf("check of an unknown user failed with %v, want %v", err, model.ErrUserNotFound)
+	}
+}
+
+func TestVerifyPasswordOfStoredUsers(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+	expired := time.Now().UTC().Add(-time.Minute)
+
+	tests := []struct {
+		name string
+		user model.User
+	}{
+		{"lock expired", model.User{ID: "u1", UserName: "ada", EmailID: "ada@example.com", LockedUntil: &expired}},
+		{"legacy plaintext password", model.User{ID: "u2", UserName: "grace", EmailID: "grace@navy.mil",
+			LegacyPassword: "correct horse"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			if user.LegacyPassword == "" {
+				user.Password = "correct horse"
+				if err := c.hashPassword(&user, model.User{}); err != nil {
+					t.Fatal(err)
+				}
+				user.LockedUntil = tt.user.LockedUntil
+			}
+			if _, err := c.datasource.Users().Upsert(user, 0, ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			check, err := c.VerifyPassword(user.ID, "wrong", ctx)
+			if err != nil || check.Valid || check.LockedUntil != nil {
+				t.Fatalf("check of a wrong password is %+v (%v), want invalid and unlocked", check, err)
+			}
+			if check, err := c.VerifyPassword(user.ID, "correct horse", ctx); err != nil || !check.Valid {
+				t.Fatalf("check of the password is %+v (%v), want valid", check, err)
+			}
+			stored, err := c.datasource.Users().Get(user.ID, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.PasswordHash == "" || stored.LegacyPassword != "" || stored.LockedUntil != nil ||
+				stored.FailedLogins != 0 {
+				t.Errorf("stored user has hash %q, legacy password %q, lock %v and %d failures, want a hash alone",
+					stored.PasswordHash, stored.LegacyPassword, stored.LockedUntil, stored.FailedLogins)
+			}
+		})
+	}
+}
+
+func TestFindUserByCanonicalForms(t *testing.T) {
+	var conf config.Config
+	conf.Canonical.PlusTagDomains = []string{"gmail.com"}
+	c := newTestController(t, conf)
+	ctx := context.Background()
+	for _, u := range []model.User{
+		{ID: "u1", FirstName: "Ada", LastName: "Lovelace", UserName: "Ada.Lovelace", EmailID: "Ada+News@gmail.com"},
+		{ID: "u2", FirstName: "Grace", LastName: "Hopper", UserName: "grace", EmailID: "grace+navy@example.com"},
+		// the plus tags of gmail.com make both addresses reach the same mailbox
+		{ID: "u3", FirstName: "Alan", LastName: "Turing", UserName: "alan", EmailID: "alan+a@gmail.com"},
+		{ID: "u4", FirstName: "Alan", LastName: "Turing", UserName: "turing", EmailID: "alan+b@gmail.com"},
+	} {
+		if _, err := c.CreateUser(u, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		find   func(value string, ctx context.Context) (model.User, error)
+		value  string
+		userId string
+		err    error
+	}{
+		{"email", c.FindUserByEmail, "ada+news@gmail.com", "u1", nil},
+		{"email without its plus tag", c.FindUserByEmail, " ADA@gmail.com", "u1", nil},
+		{"email with another plus tag", c.FindUserByEmail, "ada+bills@gmail.com", "u1", nil},
+		{"email keeping its plus tag", c.FindUserByEmail, "Grace+Navy@example.com", "u2", nil},
+		{"email without a plus tag it keeps", c.FindUserByEmail, "grace@example.com", "", model.ErrUserNotFound},
+		{"email of two users", c.FindUserByEmail, "alan@gmail.com", "", model.ErrAmbiguousLookup},
+		{"user name", c.FindUserByUserName, "ada.lovelace", "u1", nil},
+		{"user name in another case", c.FindUserByUserName, " ADA.LOVELACE", "u1", nil},
+		{"unknown user name", c.FindUserByUserName, "ada", "", model.ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := tt.find(tt.value, ctx)
+			if errors.Cause(err) != tt.err {
+				t.Fatalf("lookup of %q failed with %v, want %v", tt.value, err, tt.err)
+			}
+			if user.ID != tt.userId {
+				t.Errorf("lookup of %q found %q, want %q", tt.value, user.ID, tt.userId)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+	"user-details/pkg/audit"
+	"user-details/pkg/dedupe"
+	"user-details/pkg/model"
+	"user-details/pkg/validate"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// maxRedirects bounds the redirects followed from a merged user, guarding against merges that went round in a circle.
+const maxRedirects = 10
+
+// DetectDuplicates scans every user for duplicates right away and then every configured interval until ctx is done.
+// UserDuplicates answers from the latest scan. It must not be called while scans are disabled.
+func (c *Controller) DetectDuplicates(ctx context.Context) {
+	ticker := time.NewTicker(c.dedupe.Interval())
+	defer ticker.Stop()
+	for {
+		started := time.Now()
+		if err := c.scanDuplicates(ctx); err != nil {
+			log.Error().Stack().Caller().Err(err).Msg("duplicate scan failed, the previous results stay in use")
+		} else {
+			log.Info().Dur("took", time.Since(started)).Msg("duplicate scan done")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scanDuplicates compares every user with the users sharing a block with it and keeps the pairs reaching the
+// threshold.
+func (c *Controller) scanDuplicates(ctx context.Context) error {
+	profiles := make([]dedupe.Profile, 0)
+	query := model.UserQuery{Sort: "id", Limit: maxPageSize}
+	for {
+		users, err := c.datasource.Users().List(query, ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to list users to scan for duplicates")
+		}
+		for i := range users {
+			users[i].MigrateContact()
+			profiles = append(profiles, dedupe.NewProfile(users[i]))
+		}
+		if len(users) < query.Limit {
+			break
+		}
+		last := users[len(users)-1]
+		query.After = &model.Cursor{Sort: query.Sort, Value: last.ID, ID: last.ID}
+	}
+	c.duplicates.Replace(c.dedupe.Pairs(profiles))
+	return nil
+}
+
+// UserDuplicates returns the users likely to be the same person as the user stored under userId, most likely first.
+// Candidates come from the latest scan, along with the users sharing an email address or phone number with it, and
+// are scored against their current state.
+func (c *Controller) UserDuplicates(userId string, ctx context.Context) ([]model.DuplicateCandidate, error) {
+	user, err := c.user(userId, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// users written since the latest scan are only found by their exact values
+	filters := make([]model.UserFilter, 0, 1+len(user.Phones))
+	if user.EmailID != "" {
+		filters = append(filters, model.UserFilter{CanonicalEmail: c.canonical.Email(user.EmailID)})
+	}
+	for _, p := range user.Phones {
+		filters = append(filters, model.UserFilter{Phone: p.Number})
+	}
+	others := make(map[string]*model.User)
+	for _, filter := range filters {
+		users, err := c.datasource.Users().Search(filter, ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to find duplicates of user %s", userId)
+		}
+		for i := range users {
+			users[i].MigrateContact()
+			others[users[i].ID] = &users[i]
+		}
+	}
+	for _, id := range c.duplicates.Candidates(userId) {
+		if _, ok := others[id]; !ok {
+			others[id] = nil
+		}
+	}
+	delete(others, userId)
+
+	profile := dedupe.NewProfile(user)
+	candidates := make([]model.DuplicateCandidate, 0, len(others))
+	for id, other := range others {
+		if other == nil {
+			found, err := c.user(id, ctx)
+			if errors.Cause(err) == model.ErrUserNotFound {
+				// merged or deleted since the latest scan
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			other = &found
+		}
+		if candidate, ok := c.dedupe.Score(profile, dedupe.NewProfile(*other)); ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+	dedupe.Sort(candidates)
+	return candidates, nil
+}
+
+// DecodeMergeRequest reads a JSON merge request from body, see DecodeUser.
+func (c *Controller) DecodeMergeRequest(body io.Reader) (model.MergeRequest, error) {
+	var request model.MergeRequest
+	err := c.decode(body, &request)
+	return request, err
+}
+
+// MergeUsers merges the users named by request into its survivor when the survivor is at version, see
+// model.AnyVersion. The fields of the survivor are decided by the survivorship rules, the merged users are deleted
+// and their ids redirect to the survivor from then on. The consents of the merged users move to the survivor, so a
+// consent revoked through any of them stays revoked. The stored survivor is returned.
+//
+// The whole merge is written in one transaction. The merged users are deleted before the survivor is stored, as it
+// may take over their user name or email, which are unique. Merging again after a merge succeeded skips the users
+// already redirected to the survivor.
+func (c *Controller) MergeUsers(request model.MergeRequest, version int64, ctx context.Context) (model.User, error) {
+	if errs := validate.Struct(request); len(errs) > 0 {
+		return model.User{}, errs
+	}
+	named := map[string]bool{request.SurvivorID: true}
+	for i, id := range request.MergedIDs {
+		if named[id] {
+			return model.User{}, model.FieldErrors{{Pointer: fmt.Sprintf("/mergedIds/%d", i), Message: "is named twice"}}
+		}
+		named[id] = true
+	}
+
+	survivor, err := c.user(request.SurvivorID, ctx)
+	if err != nil {
+		return survivor, err
+	}
+	if version != model.AnyVersion && survivor.Version != version {
+		return survivor, errors.Wrapf(model.ErrVersionConflict, "unable to merge into user %s", survivor.ID)
+	}
+	merged := make([]model.User, 0, len(request.MergedIDs))
+	for _, id := range request.MergedIDs {
+		user, err := c.user(id, ctx)
+		if errors.Cause(err) == model.ErrUserNotFound {
+			// merged by an earlier attempt of the same merge
+			if redirect, rerr := c.datasource.Merges().Redirect(id, ctx); rerr == nil && redirect.SurvivorID == survivor.ID {
+				continue
+			}
+		}
+		if err != nil {
+			return survivor, err
+		}
+		merged = append(merged, user)
+	}
+	if len(merged) == 0 {
+		return survivor, nil
+	}
+
+	result := c.dedupe.Merge(survivor, merged)
+	if errs := checkUser(&result); len(errs) > 0 {
+		return survivor, errs
+	}
+	if err := c.hashPassword(&result, survivor); err != nil {
+		return survivor, err
+	}
+	actor, requestID := audit.ActorFromContext(ctx)
+	stored := result
+	err = c.datasource.Outbox().Transact(func(ctx context.Context) ([]model.UserEvent, error) {
+		events := make([]model.UserEvent, 0, len(merged)+1)
+		for _, m := range merged {
+			if err := c.datasource.Users().Delete(m.ID, m.Version, ctx); err != nil {
+				return nil, errors.Wrapf(err, "unable to merge user %s into %s", m.ID, survivor.ID)
+			}
+			redirect := model.Redirect{ID: m.ID, SurvivorID: survivor.ID, Timestamp: time.Now().UTC(), Actor: actor,
+				RequestID: requestID}
+			if err := c.datasource.Merges().AddRedirect(redirect, ctx); err != nil {
+				return nil, errors.Wrapf(err, "unable to redirect user %s to %s", m.ID, survivor.ID)
+			}
+			if err := c.datasource.Consents().MoveConsents(m.ID, survivor.ID, ctx); err != nil {
+				return nil, errors.Wrapf(err, "unable to move the consents of user %s to %s", m.ID, survivor.ID)
+			}
+			written, err := c.written(model.OpMerge, m, model.User{}, ctx)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, written...)
+		}
+		var err error
+		stored, err = c.IngestUser(result, survivor.Version, ctx)
+		if err != nil {
+			return nil, err
+		}
+		written, err := c.written(model.OpMerge, survivor, stored, ctx)
+		return append(events, written...), err
+	}, ctx)
+	return stored, err
+}
+
+// MergedInto returns the id of the user the user once stored under userId was merged into, following later merges of
+// that user too. It returns model.ErrUserNotFound when userId was never merged.
+func (c *Controller) MergedInto(userId string, ctx context.Context) (string, error) {
+	id := userId
+	for i := 0; i < maxRedirects; i++ {
+		redirect, err := c.datasource.Merges().Redirect(id, ctx)
+		if errors.Cause(err) == model.ErrUserNotFound && id != userId {
+			return id, nil
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to find the user %s was merged into", userId)
+		}
+		id = redirect.SurvivorID
+	}
+	return id, nil
+}
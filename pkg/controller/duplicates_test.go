@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"user-details/pkg/config"
+	"user-details/pkg/dedupe"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+func TestMergeUsersTakesOverUniqueFields(t *testing.T) {
+	var conf config.Config
+	conf.Dedupe.Survivorship = dedupe.Rules{"userName": dedupe.NonEmpty, "emailId": dedupe.NonEmpty}
+	c := newTestController(t, conf)
+	ctx := context.Background()
+
+	// users imported before user names and emails were required have neither
+	if _, err := c.IngestUser(model.User{ID: "survivor", FirstName: "Ada", LastName: "Lovelace"}, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+	merged, err := c.CreateUser(model.User{ID: "merged", FirstName: "Ada", LastName: "Lovelace", UserName: "ada",
+		EmailID: "ada@example.com"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := lastSequence(t, c)
+
+	stored, err := c.MergeUsers(model.MergeRequest{SurvivorID: "survivor", MergedIDs: []string{merged.ID}},
+		model.AnyVersion, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.UserName != merged.UserName || stored.EmailID != merged.EmailID {
+		t.Errorf("survivor has userName %q and emailId %q, want those of the merged user", stored.UserName, stored.EmailID)
+	}
+	if _, err := c.FindUserDetails(merged.ID, ctx); errors.Cause(err) != model.ErrUserNotFound {
+		t.Errorf("merged user is still found: %v", err)
+	}
+	if into, err := c.MergedInto(merged.ID, ctx); err != nil || into != stored.ID {
+		t.Errorf("merged user redirects to %q (%v), want %q", into, err, stored.ID)
+	}
+	if after := lastSequence(t, c); after-before != 2 {
+		t.Errorf("merge appended %d events, want the deletion and the update", after-before)
+	}
+
+	// merging again finds the merged user redirected already
+	again, err := c.MergeUsers(model.MergeRequest{SurvivorID: "survivor", MergedIDs: []string{merged.ID}},
+		model.AnyVersion, ctx)
+	if err != nil {
+		t.Fatalf("merging again failed: %v", err)
+	}
+	if again.Version != stored.Version {
+		t.Errorf("merging again wrote version %d of the survivor, want it left at %d", again.Version, stored.Version)
+	}
+}
+
+func TestMergeUsersMovesConsents(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+
+	survivor, err := c.CreateUser(model.User{ID: "survivor", FirstName: "Ada", LastName: "Lovelace", UserName: "ada",
+		EmailID: "ada@example.com"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := c.CreateUser(model.User{ID: "merged", FirstName: "Ada", LastName: "Lovelace",
+		UserName: "lovelace", EmailID: "lovelace@example.com"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consents := []struct {
+		userId  string
+		purpose string
+		action  string
+	}{
+		{survivor.ID, model.PurposeSMS, model.ConsentGrant},
+		{merged.ID, model.PurposeMarketingEmail, model.ConsentRevoke},
+		{merged.ID, model.PurposeSMS, model.ConsentRevoke},
+		{survivor.ID, model.PurposeMarketingEmail, model.ConsentGrant},
+	}
+	for _, consent := range consents {
+		_, err := c.RecordConsent(consent.userId, model.Consent{Purpose: consent.purpose, Action: consent.action,
+			Source: "web", PolicyVersion: "1"}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := c.MergeUsers(model.MergeRequest{SurvivorID: survivor.ID, MergedIDs: []string{merged.ID}},
+		model.AnyVersion, ctx); err != nil {
+		t.Fatal(err)
+	}
+	history, err := c.UserConsents(survivor.ID, "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != len(consents) {
+		t.Fatalf("survivor has %d consents, want %d", len(history), len(consents))
+	}
+	for i, consent := range history {
+		want := consents[len(consents)-1-i]
+		if consent.Purpose != want.purpose || consent.Action != want.action {
+			t.Errorf("consent %d is to %s %s, want to %s %s", i, consent.Action, consent.Purpose, want.action,
+				want.purpose)
+		}
+	}
+
+	effective, err := c.EffectiveConsents(survivor.ID, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	granted := map[string]bool{model.PurposeMarketingEmail: true, model.PurposeSMS: false, model.PurposeDataSharing: false}
+	for _, state := range effective {
+		if state.Granted != granted[state.Purpose] {
+			t.Errorf("%s granted is %t, want %t", state.Purpose, state.Granted, granted[state.Purpose])
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"time"
+	"user-details/pkg/audit"
+	"user-details/pkg/model"
+	"user-details/pkg/tokenization"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EraseUser permanently removes the user stored under userId from every store, see db.ErasureRepository, and revokes
+// the tokens of its values. It returns the signed certificate of what was touched, which is kept as well.
+//
+// The store users are kept in erases in the transaction the erasure is audited and announced in. Erasing is
+// idempotent, so an erasure failing halfway is completed by erasing again. Users that were deleted already are erased
+// too, without announcing them deleted again.
+func (c *Controller) EraseUser(userId string, version int64, ctx context.Context) (model.ErasureCertificate, error) {
+	actor, requestID := audit.ActorFromContext(ctx)
+	certificate := model.ErasureCertificate{
+		ID:        primitive.NewObjectID().Hex(),
+		UserID:    userId,
+		Actor:     actor,
+		RequestID: requestID,
+		Steps:     make([]model.ErasureStep, 0),
+	}
+	if c.erasure == nil {
+		return certificate, errors.New("erasure certificates cannot be signed, erasure.signing-key is not configured")
+	}
+
+	user, err := c.user(userId, ctx)
+	found := err == nil
+	if err != nil && errors.Cause(err) != model.ErrUserNotFound {
+		return certificate, err
+	}
+	if found && version != model.AnyVersion && user.Version != version {
+		return certificate, errors.Wrapf(model.ErrVersionConflict, "unable to erase user %s", userId)
+	}
+
+	values, err := c.erasedValues(userId, user, found, ctx)
+	if err != nil {
+		return certificate, errors.Wrapf(err, "unable to erase user %s", userId)
+	}
+	var revoked int64
+	for _, v := range values {
+		n, err := c.datasource.Tokens().Revoke(v.Field, v.Value, ctx)
+		if err != nil {
+			return certificate, errors.Wrapf(err, "unable to revoke the tokens of user %s", userId)
+		}
+		revoked += n
+	}
+
+	// the erasure is audited without any value, and announced when the user was still stored
+	certificate.Timestamp = time.Now().UTC()
+	record := model.AuditRecord{
+		ID:        primitive.NewObjectID().Hex(),
+		UserID:    userId,
+		Operation: model.OpErase,
+		Actor:     actor,
+		RequestID: requestID,
+		Timestamp: certificate.Timestamp,
+		Version:   user.Version,
+		Changes:   []model.Change{},
+	}
+	// the stores of the datasource of users erase in the transaction of the event, so that the event is never lost
+	// and the watcher tells the delete apart as ours
+	err = c.datasource.Outbox().Transact(func(ctx context.Context) ([]model.UserEvent, error) {
+		steps, err := c.eraseStores(userId, ctx)
+		if err != nil {
+			return nil, err
+		}
+		certificate.Steps = append(steps, model.ErasureStep{Store: c.datasource.TokenStore(), Target: "tokens",
+			Action: model.ErasureDeleted, Count: revoked})
+		if err := c.datasource.Audit().Append(record, ctx); err != nil {
+			return nil, errors.Wrapf(err, "unable to audit the erasure of user %s", userId)
+		}
+		if !found {
+			return nil, nil
+		}
+		events, err := newEvents(model.OpErase, user, model.User{}, certificate.Timestamp, ctx)
+		return events, errors.Wrapf(err, "unable to record the change event of user %s", userId)
+	}, ctx)
+	if err != nil {
+		return certificate, err
+	}
+
+	if err := c.erasure.Sign(&certificate); err != nil {
+		return certificate, err
+	}
+	if err := c.datasource.Certificates().KeepCertificate(certificate, ctx); err != nil {
+		return certificate, errors.Wrapf(err, "unable to keep the erasure certificate of user %s", userId)
+	}
+	return certificate, nil
+}
+
+// eraseStores erases userId from every store, describing what it touched. Stores that are not connected are
+// skipped.
+func (c *Controller) eraseStores(userId string, ctx context.Context) ([]model.ErasureStep, error) {
+	stores := c.datasource.Stores()
+	names := make([]string, 0, len(stores))
+	for name := range stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	steps := make([]model.ErasureStep, 0)
+	for _, name := range names {
+		if stores[name] == nil {
+			steps = append(steps, model.ErasureStep{Store: name, Action: model.ErasureSkipped, Reason: "not connected"})
+			continue
+		}
+		erased, err := stores[name].Erase(userId, ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to erase user %s from %s", userId, name)
+		}
+		steps = append(steps, erased...)
+	}
+	return steps, nil
+}
+
+// erasedValues returns the tokenized values of user, found telling whether it is still stored, along with the values
+// of the versions of userId kept in its snapshots.
+func (c *Controller) erasedValues(userId string, user model.User, found bool, ctx context.Context) ([]model.Token, error) {
+	var values []model.Token
+	if found {
+		values = tokenization.Values(user)
+	}
+
+	latest, err := c.datasource.Snapshots().AsOf(userId, time.Now().UTC(), ctx)
+	if errors.Cause(err) == model.ErrSnapshotNotFound {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for version := int64(1); version <= latest.Version; version++ {
+		snapshot, err := c.datasource.Snapshots().Snapshot(userId, version, ctx)
+		if errors.Cause(err) == model.ErrSnapshotNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, tokenization.Values(snapshot.User)...)
+	}
+	return values, nil
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"user-details/pkg/config"
+	"user-details/pkg/erasure"
+	"user-details/pkg/model"
+)
+
+func TestEraseUserAnnouncesTheDeleteOnce(t *testing.T) {
+	var conf config.Config
+	conf.Erasure = erasure.Config{SigningKey: "secret"}
+	c := newTestController(t, conf)
+	ctx := context.Background()
+	if _, err := c.CreateUser(model.User{ID: "u1", FirstName: "Ada", LastName: "Lovelace", UserName: "ada",
+		EmailID: "ada@example.com", BusinessUnit: 7}, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.FindUserDetails("u1", ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		events int64
+		users  int64
+	}{
+		{"stored user", 1, 1},
+		{"erased user", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := lastSequence(t, c)
+			certificate, err := c.EraseUser("u1", model.AnyVersion, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if certificate.Signature == "" {
+				t.Errorf("certificate is not signed")
+			}
+			targets := make(map[string]model.ErasureStep)
+			for _, step := range certificate.Steps {
+				targets[step.Target] = step
+			}
+			for _, target := range []string{"users", "snapshots", "consents", "accesses", "redirects", "deliveries",
+				"outbox", "audit", "tokens"} {
+				if _, ok := targets[target]; !ok {
+					t.Errorf("certificate leaves out %s: %+v", target, certificate.Steps)
+				}
+			}
+			if got := targets["users"].Count; got != tt.users {
+				t.Errorf("erasure deleted %d users, want %d", got, tt.users)
+			}
+
+			after := lastSequence(t, c)
+			if after-before != tt.events {
+				t.Fatalf("erasure appended %d events, want %d", after-before, tt.events)
+			}
+			if tt.events == 0 {
+				return
+			}
+			events, err := c.datasource.Outbox().Since(before, 1, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e := events[0]; e.Type != model.EventDeleted || e.Operation != model.OpErase || e.BusinessUnit != 7 {
+				t.Errorf("erasure announced %+v, want the user deleted", e)
+			}
+		})
+	}
+
+	if accesses, err := c.datasource.Accesses().Accesses("u1", ctx); err != nil || len(accesses) != 0 {
+		t.Errorf("accesses of the erased user are left: %+v (%v)", accesses, err)
+	}
+	page, err := c.UserHistory("u1", 0, "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range page.Records {
+		for _, change := range record.Changes {
+			if change.Before != nil || change.After != nil {
+				t.Errorf("%s record keeps the values of %s", record.Operation, change.Field)
+			}
+		}
+	}
+}
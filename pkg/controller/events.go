@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"context"
+	"time"
+	"user-details/pkg/audit"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// storeUser stores userDetails like IngestUser, then appends the audit record and the event announcing the write to
+// the outbox in the same transaction. before is the user stored until then, the zero User when there was none.
+func (c *Controller) storeUser(operation string, before, userDetails model.User, version int64, ctx context.Context) (model.User, error) {
+	stored := userDetails
+	err := c.datasource.Outbox().Transact(func(ctx context.Context) ([]model.UserEvent, error) {
+		var err error
+		stored, err = c.IngestUser(userDetails, version, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.written(operation, before, stored, ctx)
+	}, ctx)
+	return stored, err
+}
+
+// deleteUser deletes user at its version, then appends the audit record and the event announcing it to the outbox in
+// the same transaction.
+func (c *Controller) deleteUser(operation string, user model.User, ctx context.Context) error {
+	err := c.datasource.Outbox().Transact(func(ctx context.Context) ([]model.UserEvent, error) {
+		if err := c.datasource.Users().Delete(user.ID, user.Version, ctx); err != nil {
+			return nil, err
+		}
+		return c.written(operation, user, model.User{}, ctx)
+	}, ctx)
+	return errors.Wrapf(err, "unable to delete user %s", user.ID)
+}
+
+// written appends the audit record of the write that turned before into after, keeps its snapshot and returns the
+// events announcing it, all dated alike. It is called within the transaction of the write, which fails along with the
+// record or the snapshot.
+func (c *Controller) written(operation string, before, after model.User, ctx context.Context) ([]model.UserEvent, error) {
+	at := time.Now().UTC()
+	if err := c.record(operation, before, after, at, ctx); err != nil {
+		return nil, err
+	}
+	// password checks only change what snapshots leave out
+	if operation != model.OpVerifyPassword {
+		if err := c.keep(before, after, at, ctx); err != nil {
+			return nil, err
+		}
+	}
+	events, err := newEvents(operation, before, after, at, ctx)
+	if err != nil {
+		userId := after.ID
+		if userId == "" {
+			userId = before.ID
+		}
+		return nil, errors.Wrapf(err, "unable to record the change event of user %s", userId)
+	}
+	return events, nil
+}
+
+// newEvents returns the event announcing the write that turned before into after at the time at, the zero User
+// standing for a user that did not exist. Events only name the fields of the user document, so updates changing none of them, such as
+// password checks counting failed attempts, are not announced and none is returned.
+func newEvents(operation string, before, after model.User, at time.Time, ctx context.Context) ([]model.UserEvent, error) {
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if change.Field != audit.PasswordField && change.Field != audit.LockoutField {
+			fields = append(fields, change.Field)
+		}
+	}
+	_, requestID := audit.ActorFromContext(ctx)
+	event := model.UserEvent{
+		ID:           primitive.NewObjectID().Hex(),
+		Type:         model.EventUpdated,
+		UserID:       after.ID,
+		BusinessUnit: after.BusinessUnit,
+		Version:      after.Version,
+		Operation:    operation,
+		Fields:       fields,
+		Timestamp:    at,
+		RequestID:    requestID,
+	}
+	switch {
+	case before.ID == "":
+		event.Type = model.EventCreated
+	case after.ID == "":
+		event.Type, event.UserID, event.BusinessUnit, event.Version = model.EventDeleted, before.ID, before.BusinessUnit,
+			before.Version
+	case len(fields) == 0:
+		return nil, nil
+	}
+	return []model.UserEvent{event}, nil
+}
+
+// RelayEvents publishes the events of the outbox every configured interval until ctx is done, oldest first, and
+// queues their deliveries to webhooks. An event is marked published once the publisher accepted it, so events are
+// published at least once; a failed event holds back the events after it until it is published.
+func (c *Controller) RelayEvents(ctx context.Context) {
+	ticker := time.NewTicker(c.events.Interval)
+	defer ticker.Stop()
+	for {
+		if err := c.relayEvents(ctx); err != nil {
+			log.Error().Stack().Caller().Err(err).Msg("event relay failed, retrying on the next tick")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayEvents publishes the pending events of the outbox, batch after batch.
+func (c *Controller) relayEvents(ctx context.Context) error {
+	batch := c.events.BatchSize
+	for {
+		pending, err := c.datasource.Outbox().Pending(batch, ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to read the outbox")
+		}
+		webhooks, err := c.datasource.Webhooks().Webhooks(ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to list webhooks")
+		}
+		for _, event := range pending {
+			if err := c.enqueueDeliveries(event, webhooks, ctx); err != nil {
+				return err
+			}
+			if err := c.publisher.Publish(event, ctx); err != nil {
+				return errors.Wrapf(err, "unable to publish event %s", event.ID)
+			}
+			if err := c.datasource.Outbox().MarkPublished(event.ID, time.Now().UTC(), ctx); err != nil {
+				return errors.Wrapf(err, "unable to mark event %s published", event.ID)
+			}
+		}
+		if len(pending) < batch {
+			return nil
+		}
+	}
+}
+
+// LastEventSequence returns the sequence of the latest user event, where event streams start by default.
+func (c *Controller) LastEventSequence(ctx context.Context) (int64, error) {
+	sequence, err := c.datasource.Outbox().LastSequence(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to find the latest user event")
+	}
+	return sequence, nil
+}
+
+// UserEvents returns the next user events numbered after sequence that concern users of one of units, along with
+// the sequence they were read up to, which the next call goes on from. Callers without business units see no event.
+// Users without a business unit belong to no caller's unit, so their events are streamed to no one.
+func (c *Controller) UserEvents(units []int, sequence int64, ctx context.Context) ([]model.UserEvent, int64, error) {
+	if len(units) == 0 {
+		return nil, sequence, errors.Wrap(model.ErrForbidden, "streaming user events requires a business unit")
+	}
+	read, err := c.datasource.Outbox().Since(sequence, c.events.BatchSize, ctx)
+	if err != nil {
+		return nil, sequence, errors.Wrapf(err, "unable to read the user events after %d", sequence)
+	}
+	events := make([]model.UserEvent, 0, len(read))
+	for _, event := range read {
+		sequence = event.Sequence
+		for _, unit := range units {
+			if event.BusinessUnit != 0 && event.BusinessUnit == unit {
+				events = append(events, event)
+				break
+			}
+		}
+	}
+	return events, sequence, nil
+}
+
+// EventStreamIntervals returns how often event streams check for new events and send heartbeats.
+func (c *Controller) EventStreamIntervals() (poll, heartbeat time.Duration) {
+	return c.events.StreamPoll, c.events.Heartbeat
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"user-details/pkg/config"
+	"user-details/pkg/db"
+	"user-details/pkg/model"
+	"user-details/pkg/password"
+)
+
+// newTestController returns a controller of conf keeping users in memory and hashing passwords cheaply.
+func newTestController(t *testing.T, conf config.Config) *Controller {
+	t.Helper()
+	conf.Users = db.MemoryUsers
+	conf.Passwords = password.Config{Iterations: 1, Memory: 64, MaxFailures: 2}
+	c, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// lastSequence returns the sequence of the latest event of c.
+func lastSequence(t *testing.T, c *Controller) int64 {
+	t.Helper()
+	sequence, err := c.LastEventSequence(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sequence
+}
+
+func TestPasswordChecksAreNotAnnounced(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+	if _, err := c.CreateUser(model.User{ID: "u1", FirstName: "Ada", LastName: "Lovelace", UserName: "ada",
+		EmailID: "ada@example.com", Password: "correct horse"}, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		locks    bool
+	}{
+		{"failed check", "wrong", false},
+		{"check locking the user", "wrong", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := lastSequence(t, c)
+			check, err := c.VerifyPassword("u1", tt.password, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if locked := check.LockedUntil != nil; locked != tt.locks {
+				t.Fatalf("check locked the user: %v, want %v", locked, tt.locks)
+			}
+			if after := lastSequence(t, c); after != before {
+				t.Errorf("check appended %d events, want none", after-before)
+			}
+		})
+	}
+
+	// the lockout is audited all the same
+	page, err := c.UserHistory("u1", 0, "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) == 0 || page.Records[0].Operation != model.OpVerifyPassword {
+		t.Errorf("latest record is not the lockout: %+v", page.Records)
+	}
+}
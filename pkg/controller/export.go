@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"context"
+	"user-details/pkg/audit"
+	"user-details/pkg/masking"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+// ExportUser gathers the user stored under userId along with its whole audit history and its consents, both newest
+// first, and the reads logged of it, oldest first. Only callers holding the compliance role may export users, and
+// the export is logged as a read of its own once gathered.
+func (c *Controller) ExportUser(userId string, ctx context.Context) (model.Export, error) {
+	export := model.Export{History: make([]model.AuditRecord, 0)}
+	if actor, _ := audit.ActorFromContext(ctx); !hasRole(actor.Roles, c.compliance) {
+		return export, errors.Wrap(model.ErrForbidden, "exports require the compliance role")
+	}
+	user, err := c.user(userId, ctx)
+	if err != nil {
+		return export, err
+	}
+	export.User = user
+	if export.Consents, err = c.UserConsents(userId, "", ctx); err != nil {
+		return export, err
+	}
+	if export.Accesses, err = c.datasource.Accesses().Accesses(userId, ctx); err != nil {
+		return export, errors.Wrapf(err, "unable to read accesses of user %s", userId)
+	}
+
+	query := model.HistoryQuery{UserID: userId, Limit: maxPageSize}
+	for {
+		records, err := c.datasource.Audit().History(query, ctx)
+		if err != nil {
+			return export, errors.Wrapf(err, "unable to read history of user %s", userId)
+		}
+		export.History = append(export.History, records...)
+		if len(records) < query.Limit {
+			return export, c.logAccesses(model.AccessExport, []model.User{user}, ctx)
+		}
+		query.Before = records[len(records)-1].ID
+	}
+}
+
+// ExportView returns the user fields exports show, those the compliance role may see.
+func (c *Controller) ExportView() masking.View {
+	return c.masking.For([]string{c.compliance})
+}
+
+// hasRole reports whether roles hold role, which no caller holds when it is empty.
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if role != "" && r == role {
+			return true
+		}
+	}
+	return false
+}
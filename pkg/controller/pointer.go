@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"user-details/pkg/model"
+)
+
+var (
+	unmarshalerType     = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// locate returns the first value of the JSON document data, in document order, that cannot be decoded into a value
+// of type t: a value of the wrong type or, when strict, a field t does not have. Its pointer is built from the path
+// to the value, array indices included, and escaped as RFC 6901 asks. encoding/json only names the dotted struct
+// fields leading to a value of the wrong type and the bare name of an unknown field, so decode calls locate to point
+// at the value the decoder rejected. ok is false when data holds no such value or is not a JSON document.
+func locate(data []byte, t reflect.Type, strict bool) (model.FieldError, bool) {
+	l := locator{decoder: json.NewDecoder(bytes.NewReader(data)), strict: strict}
+	l.decoder.UseNumber()
+	found, err := l.value(t, "")
+	if err != nil || found == nil {
+		return model.FieldError{}, false
+	}
+	return *found, true
+}
+
+type locator struct {
+	decoder *json.Decoder
+	strict  bool
+}
+
+// value walks the next value of the document, which is decoded into a value of type t at pointer.
+func (l *locator) value(t reflect.Type, pointer string) (*model.FieldError, error) {
+	token, err := l.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	mismatch := &model.FieldError{Pointer: pointer, Message: "must be a " + t.String()}
+	custom := t.Kind() == reflect.Interface || reflect.PtrTo(t).Implements(unmarshalerType) ||
+		reflect.PtrTo(t).Implements(textUnmarshalerType)
+
+	switch token {
+	case json.Delim('{'):
+		switch {
+		case custom:
+			return nil, l.skip(1)
+		case t.Kind() == reflect.Struct:
+			return l.object(pointer, func(name string) (reflect.Type, bool) { return field(t, name) })
+		case t.Kind() == reflect.Map:
+			return l.object(pointer, func(string) (reflect.Type, bool) { return t.Elem(), true })
+		}
+		return mismatch, l.skip(1)
+	case json.Delim('['):
+		switch {
+		case custom:
+			return nil, l.skip(1)
+		case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+			for i := 0; l.decoder.More(); i++ {
+				if found, err := l.value(t.Elem(), pointer+"/"+strconv.Itoa(i)); found != nil || err != nil {
+					return found, err
+				}
+			}
+			_, err := l.decoder.Token()
+			return nil, err
+		}
+		return mismatch, l.skip(1)
+	}
+
+	// scalars are decoded on their own, so they are rejected exactly as encoding/json rejects them
+	raw, err := json.Marshal(token)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := json.Unmarshal(raw, reflect.New(t).Interface()).(*json.UnmarshalTypeError); ok {
+		return &model.FieldError{Pointer: pointer, Message: "must be a " + e.Type.String()}, nil
+	}
+	return nil, nil
+}
+
+// object walks the members of the object whose opening brace was read, decoding each into the type member returns
+// for its name. Members without a type are unknown.
+func (l *locator) object(pointer string, member func(name string) (reflect.Type, bool)) (*model.FieldError, error) {
+	for l.decoder.More() {
+		token, err := l.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		name, _ := token.(string)
+		memberPointer := pointer + "/" + escapeToken(name)
+		t, ok := member(name)
+		if !ok {
+			if l.strict {
+				return &model.FieldError{Pointer: memberPointer, Message: "unknown field"}, nil
+			}
+			if err := l.skip(0); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if found, err := l.value(t, memberPointer); found != nil || err != nil {
+			return found, err
+		}
+	}
+	_, err := l.decoder.Token()
+	return nil, err
+}
+
+// skip reads past the rest of the value depth levels deep, or past the whole next value when depth is 0.
+func (l *locator) skip(depth int) error {
+	for {
+		token, err := l.decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// field returns the type of the field of the struct type t that encoding/json decodes the member name into: the
+// field of that json name, or failing that of a name equal to it under case folding. Fields of embedded structs
+// without a json name are fields of t.
+func field(t reflect.Type, name string) (reflect.Type, bool) {
+	var folded reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		fieldName := strings.Split(tag, ",")[0]
+		if f.Anonymous && fieldName == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if ft, ok := field(embedded, name); ok {
+					return ft, true
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if fieldName == "" {
+			fieldName = f.Name
+		}
+		if fieldName == name {
+			return f.Type, true
+		}
+		if folded == nil && strings.EqualFold(fieldName, name) {
+			folded = f.Type
+		}
+	}
+	return folded, folded != nil
+}
+
+// escapeToken encodes a reference token of a JSON pointer, see RFC 6901.
+func escapeToken(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
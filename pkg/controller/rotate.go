@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"reflect"
+	"user-details/pkg/config"
+	"user-details/pkg/rotation"
+
+	common "vendor.lib/tng/tng-lib/http"
+)
+
+// Rotate applies the credentials of cfg, rebuilding the clients and reconnecting the databases whose settings
+// changed. The other settings of cfg take effect on restart.
+func (c *Controller) Rotate(cfg config.Config) {
+	c.mu.RLock()
+	current := c.clientsCfg
+	c.mu.RUnlock()
+
+	clients := make(map[string]*common.Client, len(cfg.Clients))
+	configs := make(map[string]common.Config, len(cfg.Clients))
+	for name, conf := range cfg.Clients {
+		if previous, ok := current[name]; ok && reflect.DeepEqual(previous, conf) {
+			clients[name], configs[name] = c.client(name), conf
+			continue
+		}
+		client, err := common.New(conf)
+		rotation.Record("client "+name, err)
+		if err != nil {
+			if previous, ok := current[name]; ok {
+				clients[name], configs[name] = c.client(name), previous
+			}
+			continue
+		}
+		// requests in flight keep the client they started with, whose idle connections expire on their own
+		clients[name], configs[name] = client, conf
+	}
+
+	c.mu.Lock()
+	c.clients, c.clientsCfg = clients, configs
+	c.mu.Unlock()
+
+	c.datasource.Rotate(cfg)
+}
+
+// client returns the client configured under name, nil when there is none.
+func (c *Controller) client(name string) *common.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.clients[name]
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"time"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FindUserAsOf returns the user stored under userId as it was at the time at. Users not written since versions are
+// kept are assumed to have been as they are now.
+func (c *Controller) FindUserAsOf(userId string, at time.Time, ctx context.Context) (model.User, error) {
+	snapshot, err := c.datasource.Snapshots().AsOf(userId, at, ctx)
+	if errors.Cause(err) == model.ErrSnapshotNotFound {
+		if _, err := c.datasource.Snapshots().AsOf(userId, time.Now().UTC(), ctx); errors.Cause(err) != model.ErrSnapshotNotFound {
+			if err != nil {
+				return model.User{}, errors.Wrapf(err, "unable to find user %s as of %s", userId, at)
+			}
+			return model.User{}, errors.Wrapf(model.ErrUserNotFound, "user %s did not exist as of %s", userId, at)
+		}
+		return c.FindUserDetails(userId, ctx)
+	}
+	if err != nil {
+		return model.User{}, errors.Wrapf(err, "unable to find user %s as of %s", userId, at)
+	}
+	if snapshot.Deleted {
+		return model.User{}, errors.Wrapf(model.ErrUserNotFound, "user %s was deleted as of %s", userId, at)
+	}
+	user := snapshot.User
+	user.Version = snapshot.Version
+	user.MigrateContact()
+	return user, c.logAccesses(model.AccessRead, []model.User{user}, ctx)
+}
+
+// RevertUser stores the kept version toVersion of the user stored under userId as a new write, when the user is at
+// version, see model.AnyVersion. Deleted users are restored. The password and lockout state of the user are not
+// part of versions and stay as they are.
+func (c *Controller) RevertUser(userId string, toVersion, version int64, ctx context.Context) (model.User, error) {
+	snapshot, err := c.datasource.Snapshots().Snapshot(userId, toVersion, ctx)
+	if err != nil {
+		return model.User{}, errors.Wrapf(err, "unable to revert user %s to version %d", userId, toVersion)
+	}
+	current, err := c.user(userId, ctx)
+	if errors.Cause(err) == model.ErrUserNotFound {
+		current = model.User{}
+	} else if err != nil {
+		return current, err
+	}
+	if version != model.AnyVersion && current.Version != version {
+		return current, errors.Wrapf(model.ErrVersionConflict, "unable to revert user %s", userId)
+	}
+
+	restored := snapshot.User
+	restored.ID = userId
+	restored.MigrateContact()
+	if errs := checkUser(&restored); len(errs) > 0 {
+		return current, errs
+	}
+	if err := c.hashPassword(&restored, current); err != nil {
+		return current, err
+	}
+	return c.storeUser(model.OpRevert, current, restored, current.Version, ctx)
+}
+
+// keep stores the snapshot of the write that turned before into after at the time at, the zero User standing for a
+// user that did not exist. The state of users written before versions were kept is stored first, so that it can be
+// read and reverted to. It is called within the transaction of the write, which fails along with the snapshot.
+func (c *Controller) keep(before, after model.User, at time.Time, ctx context.Context) error {
+	snapshots := make([]model.Snapshot, 0, 2)
+	if before.ID != "" {
+		_, err := c.datasource.Snapshots().AsOf(before.ID, at, ctx)
+		if errors.Cause(err) == model.ErrSnapshotNotFound {
+			snapshots = append(snapshots, model.Snapshot{UserID: before.ID, Version: before.Version, User: withoutCredentials(before)})
+		} else if err != nil {
+			return errors.Wrapf(err, "unable to find earlier versions of user %s", before.ID)
+		}
+	}
+	if after.ID != "" {
+		snapshots = append(snapshots, model.Snapshot{UserID: after.ID, Version: after.Version, Timestamp: at, User: withoutCredentials(after)})
+	} else {
+		snapshots = append(snapshots, model.Snapshot{UserID: before.ID, Version: before.Version, Timestamp: at, Deleted: true})
+	}
+
+	for _, snapshot := range snapshots {
+		snapshot.ID = primitive.NewObjectID().Hex()
+		if err := c.datasource.Snapshots().Keep(snapshot, ctx); err != nil {
+			return errors.Wrapf(err, "unable to keep version %d of user %s", snapshot.Version, snapshot.UserID)
+		}
+	}
+	return nil
+}
+
+// withoutCredentials returns user without its password and lockout state.
+func withoutCredentials(user model.User) model.User {
+	user.Password, user.PasswordHash, user.LegacyPassword = "", "", ""
+	user.FailedLogins, user.LockedUntil = 0, nil
+	return user
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+	"user-details/pkg/config"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+// writeTimes returns the times of the audit records of userId by the version they wrote, oldest first.
+func writeTimes(t *testing.T, c *Controller, userId string) []time.Time {
+	t.Helper()
+	page, err := c.UserHistory(userId, 0, "", context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := make([]time.Time, len(page.Records))
+	for i, record := range page.Records {
+		times[len(times)-1-i] = record.Timestamp
+	}
+	return times
+}
+
+func TestFindUserAsOf(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+	user := model.User{ID: "u1", FirstName: "Ada", LastName: "Byron", UserName: "ada", EmailID: "ada@example.com"}
+	if _, err := c.CreateUser(user, ctx); err != nil {
+		t.Fatal(err)
+	}
+	user.LastName = "Lovelace"
+	if _, _, err := c.ReplaceUser(user, 1, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveUser("u1", 2, ctx); err != nil {
+		t.Fatal(err)
+	}
+	times := writeTimes(t, c, "u1")
+	if len(times) != 3 {
+		t.Fatalf("history has %d records, want 3", len(times))
+	}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		lastName string
+		version  int64
+		err      error
+	}{
+		{"before the creation", times[0].Add(-time.Nanosecond), "", 0, model.ErrUserNotFound},
+		{"at the creation", times[0], "Byron", 1, nil},
+		{"between the writes", times[1].Add(-time.Nanosecond), "Byron", 1, nil},
+		{"at the replace", times[1], "Lovelace", 2, nil},
+		{"at the delete", times[2], "", 0, model.ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.FindUserAsOf("u1", tt.at, ctx)
+			if errors.Cause(err) != tt.err {
+				t.Fatalf("reading as of %s failed with %v, want %v", tt.at, err, tt.err)
+			}
+			if got.LastName != tt.lastName || got.Version != tt.version {
+				t.Errorf("read %q at version %d, want %q at version %d", got.LastName, got.Version, tt.lastName,
+					tt.version)
+			}
+		})
+	}
+}
+
+func TestRevertUser(t *testing.T) {
+	c := newTestController(t, config.Config{})
+	ctx := context.Background()
+	user := model.User{ID: "u1", FirstName: "Ada", LastName: "Byron", UserName: "ada", EmailID: "ada@example.com",
+		Password: "correct horse"}
+	if _, err := c.CreateUser(user, ctx); err != nil {
+		t.Fatal(err)
+	}
+	user.LastName, user.Password = "Lovelace", ""
+	if _, _, err := c.ReplaceUser(user, 1, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		toVersion int64
+		version   int64
+		stored    int64
+		lastName  string
+		err       error
+	}{
+		{"unknown version", 9, model.AnyVersion, 0, "", model.ErrSnapshotNotFound},
+		{"stale version", 1, 1, 0, "", model.ErrVersionConflict},
+		{"first version", 1, 2, 3, "Byron", nil},
+		{"reverted revert", 2, model.AnyVersion, 4, "Lovelace", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, err := c.RevertUser("u1", tt.toVersion, tt.version, ctx)
+			if errors.Cause(err) != tt.err {
+				t.Fatalf("revert failed with %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if stored.LastName != tt.lastName || stored.Version != tt.stored {
+				t.Errorf("stored %q at version %d, want %q at version %d", stored.LastName, stored.Version,
+					tt.lastName, tt.stored)
+			}
+			if check, err := c.VerifyPassword("u1", "correct horse", ctx); err != nil || !check.Valid {
+				t.Errorf("revert changed the password: %+v (%v)", check, err)
+			}
+		})
+	}
+
+	// deleted users are restored
+	if err := c.RemoveUser("u1", model.AnyVersion, ctx); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := c.RevertUser("u1", 1, model.AnyVersion, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.LastName != "Byron" || restored.Version != 1 {
+		t.Errorf("restored %q at version %d, want Byron at version 1", restored.LastName, restored.Version)
+	}
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"context"
+	"time"
+	"user-details/pkg/audit"
+	"user-details/pkg/model"
+	"user-details/pkg/tokenization"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TokenizeUser returns user with the values of tokenization.Fields replaced by their tokens.
+func (c *Controller) TokenizeUser(user model.User, ctx context.Context) (model.User, error) {
+	user, err := tokenization.User(c.datasource.Tokens(), user, ctx)
+	if err != nil {
+		return user, errors.Wrapf(err, "unable to tokenize user %s", user.ID)
+	}
+	return user, nil
+}
+
+// Detokenize returns the values tokens stand for, leaving unknown tokens out. Only callers with one of the
+// configured roles may detokenize, and every detokenization is audited before any value is returned.
+func (c *Controller) Detokenize(tokens []string, ctx context.Context) ([]model.Token, error) {
+	actor, requestID := audit.ActorFromContext(ctx)
+	if !c.tokens.MayDetokenize(actor.Roles) {
+		return nil, errors.Wrap(model.ErrForbidden, "detokenization requires one of the configured roles")
+	}
+	if len(tokens) == 0 {
+		return nil, errors.Wrap(model.ErrInvalidQuery, "tokens are required")
+	}
+	if len(tokens) > maxPageSize {
+		return nil, errors.Wrapf(model.ErrInvalidQuery, "at most %d tokens can be detokenized at once", maxPageSize)
+	}
+
+	unique := make([]string, 0, len(tokens))
+	seen := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			unique = append(unique, token)
+		}
+	}
+
+	found, err := c.datasource.Tokens().Detokenize(unique, ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to detokenize")
+	}
+	if len(found) == 0 {
+		return found, nil
+	}
+
+	record := model.AuditRecord{
+		ID:        primitive.NewObjectID().Hex(),
+		Operation: model.OpDetokenize,
+		Actor:     actor,
+		RequestID: requestID,
+		Timestamp: time.Now().UTC(),
+		Changes:   []model.Change{},
+		Tokens:    make([]string, len(found)),
+	}
+	for i := range found {
+		record.Tokens[i] = found[i].Token
+	}
+	// unlike writes, a detokenization that cannot be audited must not happen
+	if err := c.datasource.Audit().Append(record, ctx); err != nil {
+		return nil, errors.Wrap(err, "unable to audit detokenization")
+	}
+	return found, nil
+}
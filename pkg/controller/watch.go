@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"context"
+	"time"
+	"user-details/pkg/db/mongo"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WatchUsers tails the mongo user collection until ctx is done and appends the events of the writes other
+// applications make to it to the outbox, so that they are relayed, delivered and streamed like the writes of this
+// service. The watcher starts over after the configured retry delay when its change stream fails.
+func (c *Controller) WatchUsers(ctx context.Context) {
+	for {
+		err := c.datasource.Mongo().WatchUsers(c.watcher.Name, c.watcher.MaxAwait, func(change mongo.UserChange) error {
+			return c.announceChange(change, ctx)
+		}, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Error().Stack().Caller().Err(err).Msg("user collection watcher failed, watching again after the retry delay")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.watcher.Retry):
+		}
+	}
+}
+
+// announceChange appends the event of change to the outbox. Changes naming no user are logged and skipped.
+func (c *Controller) announceChange(change mongo.UserChange, ctx context.Context) error {
+	if change.UserID == "" {
+		log.Warn().Str("operation", change.Operation).Str("documentKey", change.DocumentKey).
+			Msg("skipping a change of the user collection that names no user id")
+		return nil
+	}
+	event := model.UserEvent{
+		ID:           primitive.NewObjectID().Hex(),
+		Type:         model.EventUpdated,
+		UserID:       change.UserID,
+		BusinessUnit: change.BusinessUnit,
+		Version:      change.Version,
+		Operation:    model.OpExternal,
+		Fields:       change.Fields,
+		Timestamp:    change.Committed,
+	}
+	switch change.Operation {
+	case mongo.ChangeInsert:
+		event.Type = model.EventCreated
+	case mongo.ChangeDelete:
+		event.Type = model.EventDeleted
+	}
+	if event.Fields == nil {
+		event.Fields = make([]string, 0)
+	}
+	err := c.datasource.Outbox().Transact(func(ctx context.Context) ([]model.UserEvent, error) {
+		return []model.UserEvent{event}, nil
+	}, ctx)
+	return errors.Wrapf(err, "unable to record the change event of user %s", change.UserID)
+}
@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"testing"
+	"user-details/pkg/config"
+	"user-details/pkg/db"
+)
+
+func TestNewRefusesWatcherWithoutMongoUsers(t *testing.T) {
+	tests := []struct {
+		users string
+		fails bool
+	}{
+		{db.MemoryUsers, true},
+		{db.MssqlUsers, true},
+		{db.MongoUsers, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.users, func(t *testing.T) {
+			var conf config.Config
+			conf.Users = tt.users
+			conf.Watcher.Enabled = true
+			if _, err := New(conf); (err != nil) != tt.fails {
+				t.Errorf("New returned %v, want failure %v", err, tt.fails)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"user-details/pkg/audit"
+	"user-details/pkg/model"
+	"user-details/pkg/validate"
+	"user-details/pkg/webhook"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	common "vendor.lib/tng/tng-lib/http"
+)
+
+// maxLoggedAttempts bounds the attempts kept in the log of a delivery, the latest are kept.
+const maxLoggedAttempts = 20
+
+// DecodeWebhook reads a JSON webhook from body, see DecodeUser.
+func (c *Controller) DecodeWebhook(body io.Reader) (model.Webhook, error) {
+	var w model.Webhook
+	err := c.decode(body, &w)
+	return w, err
+}
+
+// CreateWebhook stores w as a new webhook under a generated id. The stored webhook is returned without its secret.
+func (c *Controller) CreateWebhook(w model.Webhook, ctx context.Context) (model.Webhook, error) {
+	if err := c.mayManageWebhooks(ctx); err != nil {
+		return w, err
+	}
+	if errs := checkWebhook(w); len(errs) > 0 {
+		return w, errs
+	}
+	w.ID = primitive.NewObjectID().Hex()
+	w.Created = time.Now().UTC()
+	w.Updated = w.Created
+	if err := c.datasource.Webhooks().SaveWebhook(w, ctx); err != nil {
+		return w, errors.Wrap(err, "unable to create webhook")
+	}
+	w.Secret = ""
+	return w, nil
+}
+
+// ReplaceWebhook stores w in place of the webhook stored under webhookId, secret included.
+func (c *Controller) ReplaceWebhook(webhookId string, w model.Webhook, ctx context.Context) (model.Webhook, error) {
+	current, err := c.FindWebhook(webhookId, ctx)
+	if err != nil {
+		return current, err
+	}
+	if w.ID != "" && w.ID != webhookId {
+		return current, model.FieldErrors{{Pointer: "/id", Message: "field is immutable"}}
+	}
+	if errs := checkWebhook(w); len(errs) > 0 {
+		return current, errs
+	}
+	w.ID, w.Created, w.Updated = webhookId, current.Created, time.Now().UTC()
+	if err := c.datasource.Webhooks().SaveWebhook(w, ctx); err != nil {
+		return current, errors.Wrapf(err, "unable to replace webhook %s", webhookId)
+	}
+	w.Secret = ""
+	return w, nil
+}
+
+// FindWebhook returns the webhook stored under webhookId without its secret.
+func (c *Controller) FindWebhook(webhookId string, ctx context.Context) (model.Webhook, error) {
+	if err := c.mayManageWebhooks(ctx); err != nil {
+		return model.Webhook{}, err
+	}
+	w, err := c.datasource.Webhooks().Webhook(webhookId, ctx)
+	if err != nil {
+		return w, errors.Wrapf(err, "unable to find webhook %s", webhookId)
+	}
+	w.Secret = ""
+	return w, nil
+}
+
+// ListWebhooks returns every webhook, by id, without their secrets.
+func (c *Controller) ListWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	if err := c.mayManageWebhooks(ctx); err != nil {
+		return nil, err
+	}
+	webhooks, err := c.datasource.Webhooks().Webhooks(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list webhooks")
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+// RemoveWebhook deletes the webhook stored under webhookId along with its deliveries.
+func (c *Controller) RemoveWebhook(webhookId string, ctx context.Context) error {
+	if err := c.mayManageWebhooks(ctx); err != nil {
+		return err
+	}
+	if err := c.datasource.Webhooks().DeleteWebhook(webhookId, ctx); err != nil {
+		return errors.Wrapf(err, "unable to remove webhook %s", webhookId)
+	}
+	return nil
+}
+
+// WebhookDeliveries returns up to limit deliveries of the webhook stored under webhookId, newest first, only those
+// in status unless it is empty. Dead deliveries are the dead letters of the webhook.
+func (c *Controller) WebhookDeliveries(webhookId, status string, limit int, ctx context.Context) ([]model.Delivery, error) {
+	if _, err := c.FindWebhook(webhookId, ctx); err != nil {
+		return nil, err
+	}
+	switch status {
+	case "", model.DeliveryPending, model.DeliverySucceeded, model.DeliveryDead:
+	default:
+		return nil, errors.Wrap(model.ErrInvalidQuery, "status must be pending, succeeded or dead")
+	}
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit < 0 || limit > maxPageSize {
+		return nil, errors.Wrapf(model.ErrInvalidQuery, "limit must be between 1 and %d", maxPageSize)
+	}
+	deliveries, err := c.datasource.Webhooks().Deliveries(webhookId, status, limit, ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list the deliveries of webhook %s", webhookId)
+	}
+	return deliveries, nil
+}
+
+// Redeliver sends the delivery of the webhook stored under webhookId stored under deliveryId again right away,
+// whatever its status. Its failures are counted anew, its log is kept.
+func (c *Controller) Redeliver(webhookId, deliveryId string, ctx context.Context) (model.Delivery, error) {
+	if _, err := c.FindWebhook(webhookId, ctx); err != nil {
+		return model.Delivery{}, err
+	}
+	delivery, err := c.datasource.Webhooks().Delivery(webhookId, deliveryId, ctx)
+	if err != nil {
+		return delivery, errors.Wrapf(err, "unable to find delivery %s of webhook %s", deliveryId, webhookId)
+	}
+	now := time.Now().UTC()
+	delivery.Status, delivery.Failures, delivery.NextAttempt, delivery.Updated = model.DeliveryPending, 0, &now, now
+	if err := c.datasource.Webhooks().SaveDelivery(delivery, ctx); err != nil {
+		return delivery, errors.Wrapf(err, "unable to redeliver delivery %s of webhook %s", deliveryId, webhookId)
+	}
+	return delivery, nil
+}
+
+// mayManageWebhooks fails with model.ErrForbidden unless the caller has one of the roles managing webhooks.
+func (c *Controller) mayManageWebhooks(ctx context.Context) error {
+	actor, _ := audit.ActorFromContext(ctx)
+	if !c.webhooks.MayManage(actor.Roles) {
+		return errors.Wrap(model.ErrForbidden, "managing webhooks requires one of the configured roles")
+	}
+	return nil
+}
+
+func checkWebhook(w model.Webhook) model.FieldErrors {
+	errs := validate.Struct(w)
+	if w.URL != "" {
+		u, err := url.Parse(w.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, model.FieldError{Pointer: "/url", Message: "must be an absolute http or https URL"})
+		}
+	}
+	return errs
+}
+
+// enqueueDeliveries adds the deliveries of event to the webhooks subscribed to its type. Enqueuing an event again
+// adds nothing, so events relayed more than once are delivered once.
+func (c *Controller) enqueueDeliveries(event model.UserEvent, webhooks []model.Webhook, ctx context.Context) error {
+	now := time.Now().UTC()
+	for _, w := range webhooks {
+		if !webhook.Matches(w, event.Type) {
+			continue
+		}
+		delivery := model.Delivery{
+			ID:          webhook.DeliveryID(event.ID, w.ID),
+			WebhookID:   w.ID,
+			Event:       event,
+			Status:      model.DeliveryPending,
+			NextAttempt: &now,
+			Attempts:    make([]model.DeliveryAttempt, 0),
+			Created:     now,
+			Updated:     now,
+		}
+		if err := c.datasource.Webhooks().AddDelivery(delivery, ctx); err != nil {
+			return errors.Wrapf(err, "unable to deliver event %s to webhook %s", event.ID, w.ID)
+		}
+	}
+	return nil
+}
+
+// DeliverWebhooks sends the due deliveries every configured interval until ctx is done. A failed delivery is
+// attempted again after a delay doubling with every failure, and dead once it failed the configured number of times.
+func (c *Controller) DeliverWebhooks(ctx context.Context) {
+	ticker := time.NewTicker(c.webhooks.Interval)
+	defer ticker.Stop()
+	for {
+		if err := c.deliverDue(ctx); err != nil {
+			log.Error().Stack().Caller().Err(err).Msg("webhook deliveries failed, retrying on the next tick")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue sends the deliveries that are due, batch after batch.
+func (c *Controller) deliverDue(ctx context.Context) error {
+	webhooks := make(map[string]model.Webhook)
+	for {
+		due, err := c.datasource.Webhooks().DueDeliveries(time.Now().UTC(), c.webhooks.BatchSize, ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to find due deliveries")
+		}
+		sent := 0
+		for _, delivery := range due {
+			w, ok := webhooks[delivery.WebhookID]
+			if !ok {
+				w, err = c.datasource.Webhooks().Webhook(delivery.WebhookID, ctx)
+				if errors.Cause(err) == model.ErrWebhookNotFound {
+					// deleted while the delivery was read
+					continue
+				}
+				if err != nil {
+					return errors.Wrapf(err, "unable to find webhook %s", delivery.WebhookID)
+				}
+				webhooks[w.ID] = w
+			}
+			delivery = c.deliver(w, delivery, ctx)
+			sent++
+			err = c.datasource.Webhooks().SaveDelivery(delivery, ctx)
+			if err != nil && errors.Cause(err) != model.ErrDeliveryNotFound {
+				return errors.Wrapf(err, "unable to record delivery %s", delivery.ID)
+			}
+		}
+		// deliveries of deleted webhooks stay due until they are deleted with their webhook
+		if len(due) < c.webhooks.BatchSize || sent == 0 {
+			return nil
+		}
+	}
+}
+
+// deliver attempts delivery to w once and returns it with the attempt logged and its status updated.
+func (c *Controller) deliver(w model.Webhook, delivery model.Delivery, ctx context.Context) model.Delivery {
+	started := time.Now().UTC()
+	statusCode, err := c.post(w, delivery, started, ctx)
+	attempt := model.DeliveryAttempt{Timestamp: started, StatusCode: statusCode,
+		DurationMs: time.Since(started).Milliseconds()}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	if len(delivery.Attempts) > maxLoggedAttempts {
+		delivery.Attempts = delivery.Attempts[len(delivery.Attempts)-maxLoggedAttempts:]
+	}
+
+	now := time.Now().UTC()
+	delivery.Updated = now
+	switch {
+	case err == nil:
+		delivery.Status, delivery.NextAttempt = model.DeliverySucceeded, nil
+	case delivery.Failures+1 >= c.webhooks.MaxAttempts:
+		delivery.Failures++
+		delivery.Status, delivery.NextAttempt = model.DeliveryDead, nil
+		log.Warn().Str("webhookId", w.ID).Str("deliveryId", delivery.ID).Err(err).Msg("webhook delivery is dead")
+	default:
+		delivery.Failures++
+		next := now.Add(c.webhooks.Delay(delivery.Failures))
+		delivery.NextAttempt = &next
+	}
+	return delivery
+}
+
+// post sends the event of delivery to w, signed at at, returning the status it was answered with.
+func (c *Controller) post(w model.Webhook, delivery model.Delivery, at time.Time, ctx context.Context) (int, error) {
+	client := c.client(c.webhooks.Client)
+	if client == nil {
+		return 0, errors.Errorf("client %s is not configured", c.webhooks.Client)
+	}
+	target, err := url.Parse(w.URL)
+	if err != nil {
+		return 0, err
+	}
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+	timestamp := at.Unix()
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	headers.Set(webhook.TimestampHeader, strconv.FormatInt(timestamp, 10))
+	headers.Set(webhook.SignatureHeader, webhook.Sign(w.Secret, timestamp, body))
+	headers.Set(webhook.EventHeader, delivery.Event.Type)
+	headers.Set(webhook.DeliveryHeader, delivery.ID)
+	resp, err := client.PostWithContext(ctx, target, headers, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if !common.IsSuccessful(resp.StatusCode) {
+		return resp.StatusCode, errors.Errorf("answered with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -1,40 +1,293 @@
 package db
 
 import (
+	"context"
+	"sync"
+	"time"
 	"user-details/pkg/config"
+	"user-details/pkg/db/memory"
 	"user-details/pkg/db/mongo"
 	"user-details/pkg/db/mssql"
+	"user-details/pkg/encryption"
 	_ "github.com/denisenkom/go-mssqldb" // needed for sql driver.
 
 	"github.com/rs/zerolog/log"
 )
 
-// Datasource represents the sql and mongo connected databases utilized by the application.
+// Datasource represents the sql and mongo connected databases utilized by the application. Its connections are
+// replaced when their credentials are rotated, see Rotate.
 type Datasource struct {
-	Mongo mongo.Mongo
-	Mssql mssql.Mssql
+	mu        sync.RWMutex
+	conf      config.Config
+	cipher    *encryption.Cipher
+	memory    *memory.Memory
+	mongo     *mongo.Mongo
+	mssql     *mssql.Mssql
+	users     UserRepository
+	audit     AuditRepository
+	snapshots SnapshotRepository
+	consents  ConsentRepository
+	accesses  AccessLogRepository
+	merges    MergeRepository
+	outbox    OutboxRepository
+	webhooks  WebhookRepository
+	tokens    TokenRepository
 }
 
 // Initialize creates a new Datasource object and populates it with tested connections to sql and mongo databases.
-func Initialize(conf config.Config) *Datasource {
+// Users, their audit trail and snapshots are encrypted with cipher unless it is nil.
+func Initialize(conf config.Config, cipher *encryption.Cipher) *Datasource {
 
-	mgo := mongo.Mongo{Collection: conf.Collection}
+	mgo, mongoConnected := connectMongo(conf, cipher)
+	mssql, mssqlConnected := connectMssql(conf)
+
+	ds := &Datasource{conf: conf, cipher: cipher, memory: memory.New()}
+	ds.use(mgo, mssql)
+
+	switch conf.Users {
+	case MssqlUsers:
+		if mssqlConnected {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := mssql.EnsureIndexes(ctx); err != nil {
+				log.Warn().Err(err).Msg("Unable to ensure user indexes")
+			}
+			cancel()
+		}
+	case MemoryUsers:
+	default:
+		if conf.Users != MongoUsers {
+			log.Warn().Msgf("unknown users datasource %q, users are stored in mongo", conf.Users)
+		}
+		if mongoConnected {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := mgo.EnsureIndexes(ctx); err != nil {
+				log.Warn().Err(err).Msg("Unable to ensure user indexes")
+			}
+			if err := mgo.EnsureAuditIndexes(ctx); err != nil {
+				log.Warn().Err(err).Msg("Unable to ensure audit indexes")
+			}
+			if err := mgo.EnsureSnapshotIndexes(ctx); err != nil {
+				log.Warn().Err(err).Msg("Unable to ensure snapshot indexes")
+			}
+			if err := mgo.EnsureConsentIndexes(ctx); err != nil {
+				log.Warn().Err(err).Msg("Unable to ensure consent indexes")
+			}
+			if err := mgo.EnsureAccessIndexes(ctx); err != nil {
+				log.Warn().Err(err).Msg("Unable to ensure access indexes")
+			}
+			if err := mgo.EnsureMergeIndexes(ctx); err != nil {
+				log.Warn().Err(err).Msg("Unable to ensure merge indexes")
+			}
+			if err := mgo.EnsureOutboxIndexes(ctx); err != nil {
+				log.Warn().Err(err).Msg("Unable to ensure outbox indexes")
+			}
+			if err := mgo.EnsureWebhookIndexes(ctx); err != nil {
+				log.Warn().Err(err).Msg("Unable to ensure webhook indexes")
+			}
+			if err := mgo.EnsureWatchIndexes(ctx); err != nil {
+				log.Warn().Err(err).Msg("Unable to ensure watch indexes")
+			}
+			cancel()
+		}
+	}
+	if conf.Users != MemoryUsers && mongoConnected {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := mgo.EnsureTokenIndexes(ctx); err != nil {
+			log.Warn().Err(err).Msg("Unable to ensure token indexes")
+		}
+		if err := mgo.EnsureErasureIndexes(ctx); err != nil {
+			log.Warn().Err(err).Msg("Unable to ensure erasure indexes")
+		}
+		cancel()
+	}
+	return ds
+}
+
+// newMongo returns the mongo datasource of the collections named in conf, not connected yet. The watcher digests field
+// values with the blind index of cipher unless it is nil.
+func newMongo(conf config.Config, cipher *encryption.Cipher) *mongo.Mongo {
+	mgo := &mongo.Mongo{Collection: conf.Collection, AuditCollection: conf.AuditCollection,
+		SnapshotCollection: conf.SnapshotCollection, ConsentCollection: conf.ConsentCollection,
+		AccessCollection: conf.AccessCollection, MergeCollection: conf.MergeCollection, TokenCollection: conf.TokenCollection,
+		ErasureCollection: conf.ErasureCollection, OutboxCollection: conf.OutboxCollection,
+		WebhookCollection: conf.WebhookCollection, DeliveryCollection: conf.DeliveryCollection,
+		SequenceCollection: conf.SequenceCollection, WatchCollection: conf.WatchCollection,
+		WatchKeyCollection: conf.WatchKeyCollection}
+	if cipher != nil {
+		mgo.FieldDigest = cipher.BlindIndex
+	}
+	return mgo
+}
+
+// newMssql returns the sql datasource of the tables named in conf, not connected yet.
+func newMssql(conf config.Config) *mssql.Mssql {
+	return &mssql.Mssql{Table: conf.Collection, AuditTable: conf.AuditCollection,
+		SnapshotTable: conf.SnapshotCollection, ConsentTable: conf.ConsentCollection, MergeTable: conf.MergeCollection,
+		AccessTable: conf.AccessCollection, OutboxTable: conf.OutboxCollection, WebhookTable: conf.WebhookCollection, DeliveryTable: conf.DeliveryCollection}
+}
+
+// connectMongo connects to the mongo database of conf, reporting whether it answers.
+func connectMongo(conf config.Config, cipher *encryption.Cipher) (*mongo.Mongo, bool) {
+	mgo := newMongo(conf, cipher)
 	err := mgo.Connect(conf.Datasource.Mongo["cm"])
-	
+
 	if err == nil {
-		if mgo.Ping() != nil {
+		if err = mgo.Ping(); err != nil {
 			log.Warn().Err(err).Msg("Unable to connect to mongo")
 		}
 	}
+	return mgo, err == nil
+}
 
-	mssql := mssql.Mssql{}
-	err = mssql.Connect(conf.SQL)
+// connectMssql connects to the sql database of conf, reporting whether it answers.
+func connectMssql(conf config.Config) (*mssql.Mssql, bool) {
+	mssql := newMssql(conf)
+	err := mssql.Connect(conf.SQL)
 
 	if err == nil {
-		if mssql.Ping() != nil {
+		if err = mssql.Ping(); err != nil {
 			log.Warn().Err(err).Msg("Unable to connect to sql")
 		}
 	}
+	return mssql, err == nil
+}
+
+// use serves users from mgo or mssql, as configured. Tokens are kept in mongo unless users are kept in memory. It is
+// called with ds.mu held, or before ds is shared.
+func (ds *Datasource) use(mgo *mongo.Mongo, mssql *mssql.Mssql) {
+	ds.mongo, ds.mssql = mgo, mssql
+	ds.tokens = mgo
+	switch ds.conf.Users {
+	case MssqlUsers:
+		ds.users, ds.audit, ds.snapshots, ds.consents, ds.merges = mssql, mssql, mssql, mssql, mssql
+		ds.accesses, ds.outbox, ds.webhooks = mssql, mssql, mssql
+	case MemoryUsers:
+		ds.users, ds.audit, ds.snapshots, ds.consents = ds.memory, ds.memory, ds.memory, ds.memory
+		ds.accesses, ds.merges, ds.outbox, ds.webhooks = ds.memory, ds.memory, ds.memory, ds.memory
+		ds.tokens = ds.memory
+	default:
+		ds.users, ds.audit, ds.snapshots, ds.consents, ds.merges = mgo, mgo, mgo, mgo, mgo
+		ds.accesses, ds.outbox, ds.webhooks = mgo, mgo, mgo
+	}
+	if ds.cipher != nil {
+		ds.users = &encryptedUsers{users: ds.users, cipher: ds.cipher}
+		ds.audit = &encryptedAudit{audit: ds.audit, cipher: ds.cipher}
+		ds.snapshots = &encryptedSnapshots{snapshots: ds.snapshots, cipher: ds.cipher}
+		ds.tokens = &encryptedTokens{tokens: ds.tokens, cipher: ds.cipher}
+		ds.webhooks = &encryptedWebhooks{WebhookRepository: ds.webhooks, cipher: ds.cipher}
+	}
+}
+
+// Mongo returns the current mongo connection.
+func (ds *Datasource) Mongo() *mongo.Mongo {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.mongo
+}
 
-	return &Datasource{Mongo: mgo, Mssql: mssql}
-}
\ No newline at end of file
+// Mssql returns the current sql connection.
+func (ds *Datasource) Mssql() *mssql.Mssql {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.mssql
+}
+
+// Users returns the repository users are stored in.
+func (ds *Datasource) Users() UserRepository {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.users
+}
+
+// Audit returns the repository the audit trail of users is stored in.
+func (ds *Datasource) Audit() AuditRepository {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.audit
+}
+
+// Snapshots returns the repository the earlier versions of users are kept in.
+func (ds *Datasource) Snapshots() SnapshotRepository {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.snapshots
+}
+
+// Consents returns the repository the consents of users are kept in.
+func (ds *Datasource) Consents() ConsentRepository {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.consents
+}
+
+// Accesses returns the repository the reads of users are logged in.
+func (ds *Datasource) Accesses() AccessLogRepository {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.accesses
+}
+
+// Merges returns the repository the redirects of merged users are kept in.
+func (ds *Datasource) Merges() MergeRepository {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.merges
+}
+
+// Outbox returns the repository the change events of users are kept in until they are published.
+func (ds *Datasource) Outbox() OutboxRepository {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.outbox
+}
+
+// Webhooks returns the repository webhooks and their deliveries are kept in.
+func (ds *Datasource) Webhooks() WebhookRepository {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.webhooks
+}
+
+// Tokens returns the repository the tokens standing for user field values are kept in.
+func (ds *Datasource) Tokens() TokenRepository {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.tokens
+}
+
+// Stores returns the stores that may hold the data of users, by name. Stores that are not connected are nil.
+func (ds *Datasource) Stores() map[string]ErasureRepository {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	stores := map[string]ErasureRepository{MongoUsers: nil, MssqlUsers: nil}
+	if ds.mongo.Database != nil {
+		stores[MongoUsers] = ds.mongo
+	}
+	if ds.mssql.Database != nil {
+		stores[MssqlUsers] = ds.mssql
+	}
+	if ds.conf.Users == MemoryUsers {
+		stores[MemoryUsers] = ds.memory
+	}
+	return stores
+}
+
+// TokenStore names the store tokens are kept in.
+func (ds *Datasource) TokenStore() string {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	if ds.conf.Users == MemoryUsers {
+		return MemoryUsers
+	}
+	return MongoUsers
+}
+
+// Certificates returns the repository erasure certificates are kept in, mongo unless users are kept in memory.
+func (ds *Datasource) Certificates() CertificateRepository {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	if ds.conf.Users == MemoryUsers {
+		return ds.memory
+	}
+	return ds.mongo
+}
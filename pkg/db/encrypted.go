@@ -0,0 +1,328 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+	"user-details/pkg/encryption"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+// encryptedUsers encrypts the tagged fields of users on their way into users and decrypts them on their way out.
+type encryptedUsers struct {
+	users  UserRepository
+	cipher *encryption.Cipher
+}
+
+func (e *encryptedUsers) Get(userId string, ctx context.Context) (model.User, error) {
+	user, err := e.users.Get(userId, ctx)
+	if err != nil {
+		return user, err
+	}
+	return user, e.cipher.Decrypt(&user)
+}
+
+// Upsert stores the blind indexes of the email and of its prefixes along with the encrypted user, as encrypting the
+// same email with another key or in another case gives another ciphertext.
+func (e *encryptedUsers) Upsert(user model.User, version int64, ctx context.Context) (model.User, error) {
+	encrypted := user
+	encrypted.EmailIndex, encrypted.EmailPrefixes = "", nil
+	if user.EmailID != "" {
+		email := strings.ToLower(user.EmailID)
+		encrypted.EmailIndex = e.cipher.BlindIndex("emailId", email)
+		encrypted.EmailPrefixes = e.emailPrefixes(email)
+	}
+	if err := e.cipher.Encrypt(&encrypted); err != nil {
+		return user, err
+	}
+	stored, err := e.users.Upsert(encrypted, version, ctx)
+	user.Version = stored.Version
+	return user, err
+}
+
+// emailPrefixes returns the blind indexes of every prefix of email, cut between its characters.
+func (e *encryptedUsers) emailPrefixes(email string) []string {
+	prefixes := make([]string, 0, len(email))
+	for i := range email {
+		if i > 0 {
+			prefixes = append(prefixes, e.cipher.BlindIndex("emailPrefix", email[:i]))
+		}
+	}
+	return append(prefixes, e.cipher.BlindIndex("emailPrefix", email))
+}
+
+func (e *encryptedUsers) Delete(userId string, version int64, ctx context.Context) error {
+	return e.users.Delete(userId, version, ctx)
+}
+
+// List matches the last name and phone filters once with every key, and once in clear text for users written before
+// encryption was enabled. Email prefixes are matched in lower case by their blind index, which users written before
+// encryption was enabled do not have yet. Encrypted values cannot be ordered, so sorts by encrypted fields are
+// rejected.
+func (e *encryptedUsers) List(query model.UserQuery, ctx context.Context) ([]model.User, error) {
+	if encryption.Encrypted(model.User{}, query.Sort) {
+		return nil, errors.Wrapf(model.ErrInvalidQuery, "%s is encrypted and cannot be sorted by", query.Sort)
+	}
+	var err error
+	if query.LastNames, err = e.encryptedForms("lastName", query.LastName); err != nil {
+		return nil, err
+	}
+	if query.Phones, err = e.encryptedForms("number", query.Phone); err != nil {
+		return nil, err
+	}
+	if query.EmailPrefix != "" {
+		query.EmailPrefixIndex = e.cipher.BlindIndex("emailPrefix", strings.ToLower(query.EmailPrefix))
+	}
+	query.LastName, query.Phone, query.EmailPrefix = "", "", ""
+
+	users, err := e.users.List(query, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return users, e.decryptAll(users)
+}
+
+// encryptedForms returns value of field in clear text and encrypted with every key, none when value is empty.
+func (e *encryptedUsers) encryptedForms(field, value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	forms := []string{value}
+	for _, id := range e.cipher.KeyIDs() {
+		encrypted, err := e.cipher.EncryptValue(id, field, value)
+		if err != nil {
+			return nil, err
+		}
+		forms = append(forms, encrypted)
+	}
+	return forms, nil
+}
+
+// Search matches the filter once with every key, and once in clear text for users written before encryption was
+// enabled.
+func (e *encryptedUsers) Search(filter model.UserFilter, ctx context.Context) ([]model.User, error) {
+	filters := []model.UserFilter{filter}
+	for _, id := range e.cipher.KeyIDs() {
+		encrypted := filter
+		if err := e.cipher.EncryptWith(id, &encrypted); err != nil {
+			return nil, err
+		}
+		if encrypted == filter {
+			// the filter has no encrypted field
+			break
+		}
+		filters = append(filters, encrypted)
+	}
+
+	seen := make(map[string]bool)
+	users := make([]model.User, 0)
+	for _, f := range filters {
+		found, err := e.users.Search(f, ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range found {
+			if !seen[u.ID] {
+				seen[u.ID] = true
+				users = append(users, u)
+			}
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, e.decryptAll(users)
+}
+
+func (e *encryptedUsers) decryptAll(users []model.User) error {
+	for i := range users {
+		if err := e.cipher.Decrypt(&users[i]); err != nil {
+			return errors.Wrapf(err, "unable to decrypt user %s", users[i].ID)
+		}
+	}
+	return nil
+}
+
+// encryptedSnapshots encrypts the users kept by snapshots, see encryptedUsers.
+type encryptedSnapshots struct {
+	snapshots SnapshotRepository
+	cipher    *encryption.Cipher
+}
+
+func (e *encryptedSnapshots) Keep(snapshot model.Snapshot, ctx context.Context) error {
+	if err := e.cipher.Encrypt(&snapshot); err != nil {
+		return err
+	}
+	return e.snapshots.Keep(snapshot, ctx)
+}
+
+func (e *encryptedSnapshots) AsOf(userId string, at time.Time, ctx context.Context) (model.Snapshot, error) {
+	snapshot, err := e.snapshots.AsOf(userId, at, ctx)
+	if err != nil {
+		return snapshot, err
+	}
+	return snapshot, e.cipher.Decrypt(&snapshot)
+}
+
+func (e *encryptedSnapshots) Snapshot(userId string, version int64, ctx context.Context) (model.Snapshot, error) {
+	snapshot, err := e.snapshots.Snapshot(userId, version, ctx)
+	if err != nil {
+		return snapshot, err
+	}
+	return snapshot, e.cipher.Decrypt(&snapshot)
+}
+
+// encryptedAudit encrypts the values of changes to user fields holding encrypted values. An encrypted value is
+// stored as a JSON string in place of the JSON value of the field.
+type encryptedAudit struct {
+	audit  AuditRepository
+	cipher *encryption.Cipher
+}
+
+func (e *encryptedAudit) Append(record model.AuditRecord, ctx context.Context) error {
+	changes := make([]model.Change, len(record.Changes))
+	for i, change := range record.Changes {
+		if encryption.Encrypted(model.User{}, strings.TrimPrefix(change.Field, "/")) {
+			var err error
+			if change.Before, err = e.encryptValue(change.Field, change.Before); err != nil {
+				return err
+			}
+			if change.After, err = e.encryptValue(change.Field, change.After); err != nil {
+				return err
+			}
+		}
+		changes[i] = change
+	}
+	record.Changes = changes
+	return e.audit.Append(record, ctx)
+}
+
+func (e *encryptedAudit) History(query model.HistoryQuery, ctx context.Context) ([]model.AuditRecord, error) {
+	records, err := e.audit.History(query, ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		for j := range record.Changes {
+			change := &record.Changes[j]
+			if change.Before, err = e.decryptValue(change.Field, change.Before); err != nil {
+				return nil, err
+			}
+			if change.After, err = e.decryptValue(change.Field, change.After); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return records, nil
+}
+
+func (e *encryptedAudit) encryptValue(field string, value json.RawMessage) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	encrypted, err := e.cipher.EncryptValue(e.cipher.ActiveKey(), field, string(value))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encrypted)
+}
+
+// decryptValue reverts encryptValue, returning values that were not encrypted as they are.
+func (e *encryptedAudit) decryptValue(field string, value json.RawMessage) (json.RawMessage, error) {
+	var s string
+	if value == nil || json.Unmarshal(value, &s) != nil || !encryption.IsEncrypted(s) {
+		return value, nil
+	}
+	plain, err := e.cipher.DecryptValue(field, s)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(plain), nil
+}
+
+// encryptedTokens encrypts the values tokens stand for. Values are matched under the active key only, so a value
+// stored under an earlier key is given a new token.
+type encryptedTokens struct {
+	tokens TokenRepository
+	cipher *encryption.Cipher
+}
+
+func (e *encryptedTokens) Tokenize(token model.Token, ctx context.Context) (model.Token, error) {
+	if err := e.cipher.Encrypt(&token); err != nil {
+		return token, err
+	}
+	stored, err := e.tokens.Tokenize(token, ctx)
+	if err != nil {
+		return stored, err
+	}
+	return stored, e.cipher.Decrypt(&stored)
+}
+
+// Revoke deletes the tokens of value stored in clear text or under any key.
+func (e *encryptedTokens) Revoke(field, value string, ctx context.Context) (int64, error) {
+	revoked, err := e.tokens.Revoke(field, value, ctx)
+	if err != nil {
+		return revoked, err
+	}
+	for _, id := range e.cipher.KeyIDs() {
+		encrypted, err := e.cipher.EncryptValue(id, "token", value)
+		if err != nil {
+			return revoked, err
+		}
+		n, err := e.tokens.Revoke(field, encrypted, ctx)
+		if err != nil {
+			return revoked, err
+		}
+		revoked += n
+	}
+	return revoked, nil
+}
+
+func (e *encryptedTokens) Detokenize(tokens []string, ctx context.Context) ([]model.Token, error) {
+	found, err := e.tokens.Detokenize(tokens, ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range found {
+		if err := e.cipher.Decrypt(&found[i]); err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+// encryptedWebhooks encrypts the secrets of webhooks. Deliveries carry no values and are stored as they are.
+type encryptedWebhooks struct {
+	WebhookRepository
+	cipher *encryption.Cipher
+}
+
+func (e *encryptedWebhooks) SaveWebhook(webhook model.Webhook, ctx context.Context) error {
+	if err := e.cipher.Encrypt(&webhook); err != nil {
+		return err
+	}
+	return e.WebhookRepository.SaveWebhook(webhook, ctx)
+}
+
+func (e *encryptedWebhooks) Webhook(webhookId string, ctx context.Context) (model.Webhook, error) {
+	webhook, err := e.WebhookRepository.Webhook(webhookId, ctx)
+	if err != nil {
+		return webhook, err
+	}
+	return webhook, e.cipher.Decrypt(&webhook)
+}
+
+func (e *encryptedWebhooks) Webhooks(ctx context.Context) ([]model.Webhook, error) {
+	webhooks, err := e.WebhookRepository.Webhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		if err := e.cipher.Decrypt(&webhooks[i]); err != nil {
+			return nil, err
+		}
+	}
+	return webhooks, nil
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"user-details/pkg/db/memory"
+	"user-details/pkg/encryption"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+// testKey returns a key of 32 bytes made of b.
+func testKey(id string, b byte) encryption.Key {
+	return encryption.Key{ID: id, Secret: strings.Repeat(string(rune(b)), 32)}
+}
+
+func TestEncryptedEmailsStayUnique(t *testing.T) {
+	index := testKey("index", 'i')
+	rotated := encryption.Config{ActiveKey: "k2", Keys: []encryption.Key{testKey("k1", 1), testKey("k2", 2)}, IndexKey: index}
+	original := rotated
+	original.ActiveKey = "k1"
+
+	tests := []struct {
+		name   string
+		stored string
+		cipher encryption.Config
+		email  string
+		taken  bool
+	}{
+		{"same email", "ada@example.com", original, "ada@example.com", true},
+		{"other case", "Ada@Example.com", original, "ada@example.com", true},
+		{"other key", "ada@example.com", rotated, "ADA@example.com", true},
+		{"other email", "ada@example.com", rotated, "grace@example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memory.New()
+			users := make([]*encryptedUsers, 0, 2)
+			for _, conf := range []encryption.Config{original, tt.cipher} {
+				cipher, err := encryption.New(conf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				users = append(users, &encryptedUsers{users: store, cipher: cipher})
+			}
+			ctx := context.Background()
+			if _, err := users[0].Upsert(model.User{ID: "u1", EmailID: tt.stored}, 0, ctx); err != nil {
+				t.Fatal(err)
+			}
+			_, err := users[1].Upsert(model.User{ID: "u2", EmailID: tt.email}, 0, ctx)
+			if taken := errors.Cause(err) == (model.DuplicateError{Field: "emailId"}); taken != tt.taken {
+				t.Errorf("storing %s next to %s failed with %v, want taken %v", tt.email, tt.stored, err, tt.taken)
+			}
+		})
+	}
+}
+
+func TestEncryptedListsMatchUnderEveryKey(t *testing.T) {
+	conf := encryption.Config{ActiveKey: "k1", Keys: []encryption.Key{testKey("k1", 1), testKey("k2", 2)},
+		IndexKey: testKey("index", 'i')}
+	store := memory.New()
+	ctx := context.Background()
+	// ada was written before encryption was enabled, grace under k1 and alan under k2
+	if _, err := store.Upsert(model.User{ID: "ada", LastName: "Smith", Phones: []model.Phone{{Number: "555"}}}, 0,
+		ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []struct {
+		key  string
+		user model.User
+	}{
+		{"k1", model.User{ID: "grace", LastName: "Smith", EmailID: "Grace@navy.mil",
+			Phones: []model.Phone{{Number: "555"}}}},
+		{"k2", model.User{ID: "alan", LastName: "Smith", EmailID: "alan@bletchley.uk",
+			Phones: []model.Phone{{Number: "556"}}}},
+	} {
+		conf.ActiveKey = u.key
+		cipher, err := encryption.New(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := (&encryptedUsers{users: store, cipher: cipher}).Upsert(u.user, 0, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cipher, err := encryption.New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &encryptedUsers{users: store, cipher: cipher}
+
+	tests := []struct {
+		name    string
+		query   model.UserQuery
+		want    []string
+		invalid bool
+	}{
+		{"last name", model.UserQuery{LastName: "Smith", Sort: "id", Limit: 10}, []string{"ada", "alan", "grace"}, false},
+		{"phone", model.UserQuery{Phone: "555", Sort: "id", Limit: 10}, []string{"ada", "grace"}, false},
+		{"user name sort", model.UserQuery{Sort: "userName", Limit: 10}, []string{"ada", "alan", "grace"}, false},
+		{"last name sort", model.UserQuery{Sort: "lastName"}, nil, true},
+		{"email sort", model.UserQuery{Sort: "emailId"}, nil, true},
+		{"email prefix", model.UserQuery{EmailPrefix: "gr", Sort: "id", Limit: 10}, []string{"grace"}, false},
+		{"email prefix in another case", model.UserQuery{EmailPrefix: "GRACE@N", Sort: "id", Limit: 10},
+			[]string{"grace"}, false},
+		{"whole email", model.UserQuery{EmailPrefix: "alan@bletchley.uk", Sort: "id", Limit: 10}, []string{"alan"},
+			false},
+		{"longer than the email", model.UserQuery{EmailPrefix: "alan@bletchley.uk.", Sort: "id", Limit: 10}, nil,
+			false},
+		{"unknown email prefix", model.UserQuery{EmailPrefix: "ada", Sort: "id", Limit: 10}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := users.List(tt.query, ctx)
+			if invalid := errors.Cause(err) == model.ErrInvalidQuery; invalid != tt.invalid {
+				t.Fatalf("listing failed with %v, want invalid %v", err, tt.invalid)
+			}
+			var got []string
+			for _, u := range found {
+				got = append(got, u.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package memory
+
+import (
+	"context"
+	"user-details/pkg/model"
+)
+
+// LogAccesses stores accesses.
+func (ss *Memory) LogAccesses(accesses []model.Access, ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.accesses = append(ss.accesses, accesses...)
+	return nil
+}
+
+// Accesses returns the accesses of userId, oldest first.
+func (ss *Memory) Accesses(userId string, ctx context.Context) ([]model.Access, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	accesses := make([]model.Access, 0)
+	// accesses are appended in id order
+	for _, a := range ss.accesses {
+		if a.UserID == userId {
+			a.Actor.Roles = append([]string(nil), a.Actor.Roles...)
+			accesses = append(accesses, a)
+		}
+	}
+	return accesses, nil
+}
@@ -0,0 +1,29 @@
+package memory
+
+import (
+	"context"
+	"user-details/pkg/model"
+)
+
+// Append stores record.
+func (ss *Memory) Append(record model.AuditRecord, ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.records = append(ss.records, record)
+	return nil
+}
+
+// History returns up to query.Limit records of query.UserID older than query.Before, newest first.
+func (ss *Memory) History(query model.HistoryQuery, ctx context.Context) ([]model.AuditRecord, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	records := make([]model.AuditRecord, 0, query.Limit)
+	// records are appended in id order
+	for i := len(ss.records) - 1; i >= 0 && len(records) < query.Limit; i-- {
+		r := ss.records[i]
+		if r.UserID == query.UserID && (query.Before == "" || r.ID < query.Before) {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,41 @@
+package memory
+
+import (
+	"context"
+	"user-details/pkg/model"
+)
+
+// Record stores consent.
+func (ss *Memory) Record(consent model.Consent, ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.consents = append(ss.consents, consent)
+	return nil
+}
+
+// MoveConsents hands the consents of fromUserId over to toUserId.
+func (ss *Memory) MoveConsents(fromUserId, toUserId string, ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for i := range ss.consents {
+		if ss.consents[i].UserID == fromUserId {
+			ss.consents[i].UserID = toUserId
+		}
+	}
+	return nil
+}
+
+// Consents returns the consents of userId, oldest first.
+func (ss *Memory) Consents(userId string, ctx context.Context) ([]model.Consent, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	consents := make([]model.Consent, 0)
+	// consents are appended in id order
+	for _, c := range ss.consents {
+		if c.UserID == userId {
+			c.Actor.Roles = append([]string(nil), c.Actor.Roles...)
+			consents = append(consents, c)
+		}
+	}
+	return consents, nil
+}
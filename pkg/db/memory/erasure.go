@@ -0,0 +1,130 @@
+package memory
+
+import (
+	"context"
+	"user-details/pkg/model"
+)
+
+// Erase deletes the user stored under userId, its snapshots, its consents, its accesses, the redirects from and to it
+// and the deliveries of its events, and removes the values from the changes of its audit records and the business
+// unit, fields and request id from its events.
+func (ss *Memory) Erase(userId string, ctx context.Context) ([]model.ErasureStep, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	var users int64
+	if _, ok := ss.users[userId]; ok {
+		delete(ss.users, userId)
+		users = 1
+	}
+
+	snapshots := ss.snapshots[:0]
+	for _, s := range ss.snapshots {
+		if s.UserID != userId {
+			snapshots = append(snapshots, s)
+		}
+	}
+	erased := int64(len(ss.snapshots) - len(snapshots))
+	ss.snapshots = snapshots
+
+	consents := ss.consents[:0]
+	for _, c := range ss.consents {
+		if c.UserID != userId {
+			consents = append(consents, c)
+		}
+	}
+	erasedConsents := int64(len(ss.consents) - len(consents))
+	ss.consents = consents
+
+	accesses := ss.accesses[:0]
+	for _, a := range ss.accesses {
+		if a.UserID != userId {
+			accesses = append(accesses, a)
+		}
+	}
+	erasedAccesses := int64(len(ss.accesses) - len(accesses))
+	ss.accesses = accesses
+
+	redirects := ss.redirects[:0]
+	for _, r := range ss.redirects {
+		if r.ID != userId && r.SurvivorID != userId {
+			redirects = append(redirects, r)
+		}
+	}
+	erasedRedirects := int64(len(ss.redirects) - len(redirects))
+	ss.redirects = redirects
+
+	deliveries := ss.deliveries[:0]
+	for _, d := range ss.deliveries {
+		if d.Event.UserID != userId {
+			deliveries = append(deliveries, d)
+		}
+	}
+	erasedDeliveries := int64(len(ss.deliveries) - len(deliveries))
+	ss.deliveries = deliveries
+
+	// events keep their place in the outbox, which numbers them
+	var events int64
+	for i, e := range ss.outbox {
+		if e.UserID == userId && (e.BusinessUnit != 0 || len(e.Fields) > 0 || e.RequestID != "") {
+			ss.outbox[i] = anonymizedEvent(e)
+			events++
+		}
+	}
+
+	var records int64
+	for i, r := range ss.records {
+		if r.UserID != userId || len(r.Changes) == 0 {
+			continue
+		}
+		changes := make([]model.Change, len(r.Changes))
+		anonymized := false
+		for j, c := range r.Changes {
+			changes[j] = model.Change{Field: c.Field}
+			anonymized = anonymized || c.Before != nil || c.After != nil
+		}
+		ss.records[i].Changes = changes
+		if anonymized {
+			records++
+		}
+	}
+
+	return []model.ErasureStep{
+		{Store: "memory", Target: "users", Action: model.ErasureDeleted, Count: users},
+		{Store: "memory", Target: "snapshots", Action: model.ErasureDeleted, Count: erased},
+		{Store: "memory", Target: "consents", Action: model.ErasureDeleted, Count: erasedConsents},
+		{Store: "memory", Target: "accesses", Action: model.ErasureDeleted, Count: erasedAccesses},
+		{Store: "memory", Target: "redirects", Action: model.ErasureDeleted, Count: erasedRedirects},
+		{Store: "memory", Target: "deliveries", Action: model.ErasureDeleted, Count: erasedDeliveries},
+		{Store: "memory", Target: "outbox", Action: model.ErasureAnonymized, Count: events},
+		{Store: "memory", Target: "audit", Action: model.ErasureAnonymized, Count: records},
+	}, nil
+}
+
+// anonymizedEvent returns event without the business unit, fields and request id of its user.
+func anonymizedEvent(event model.UserEvent) model.UserEvent {
+	event.BusinessUnit, event.Fields, event.RequestID = 0, []string{}, ""
+	return event
+}
+
+// Revoke deletes the tokens standing for value of field.
+func (ss *Memory) Revoke(field, value string, ctx context.Context) (int64, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	var revoked int64
+	for token, t := range ss.tokens {
+		if t.Field == field && t.Value == value {
+			delete(ss.tokens, token)
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+// KeepCertificate stores certificate.
+func (ss *Memory) KeepCertificate(certificate model.ErasureCertificate, ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.certificates = append(ss.certificates, certificate)
+	return nil
+}
@@ -0,0 +1,203 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"user-details/pkg/model"
+)
+
+// Memory stores users in process memory. It is meant for local development and has no persistence.
+type Memory struct {
+	mu         sync.RWMutex
+	users      map[string]model.User
+	records    []model.AuditRecord
+	snapshots  []model.Snapshot
+	tokens     map[string]model.Token
+	consents   []model.Consent
+	accesses   []model.Access
+	redirects  []model.Redirect
+	outbox     []model.UserEvent
+	webhooks   map[string]model.Webhook
+	deliveries []model.Delivery
+	// certificates are kept for the process lifetime like everything else
+	certificates []model.ErasureCertificate
+}
+
+// New creates an empty Memory.
+func New() *Memory {
+	return &Memory{users: make(map[string]model.User), tokens: make(map[string]model.Token),
+		webhooks: make(map[string]model.Webhook)}
+}
+
+// Get returns the user stored under userId.
+func (ss *Memory) Get(userId string, ctx context.Context) (model.User, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	user, ok := ss.users[userId]
+	if !ok {
+		return user, model.ErrUserNotFound
+	}
+	return clone(user), nil
+}
+
+// Upsert stores user as version+1 when the user stored under user.ID is at version, 0 meaning it may not exist yet.
+func (ss *Memory) Upsert(user model.User, version int64, ctx context.Context) (model.User, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.users[user.ID].Version != version {
+		return user, model.ErrVersionConflict
+	}
+	for _, other := range ss.users {
+		if other.ID == user.ID {
+			continue
+		}
+		if user.UserName != "" && strings.EqualFold(other.UserName, user.UserName) {
+			return user, model.DuplicateError{Field: "userName"}
+		}
+		if user.EmailID != "" && strings.EqualFold(other.EmailID, user.EmailID) ||
+			user.EmailIndex != "" && other.EmailIndex == user.EmailIndex {
+			return user, model.DuplicateError{Field: "emailId"}
+		}
+	}
+	user.Version = version + 1
+	ss.users[user.ID] = clone(user)
+	return user, nil
+}
+
+// Delete removes the user stored under userId when it is at version.
+func (ss *Memory) Delete(userId string, version int64, ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	user, ok := ss.users[userId]
+	if !ok {
+		return model.ErrUserNotFound
+	}
+	if user.Version != version {
+		return model.ErrVersionConflict
+	}
+	delete(ss.users, userId)
+	return nil
+}
+
+// List returns up to query.Limit users matching query, ordered by query.Sort then id.
+func (ss *Memory) List(query model.UserQuery, ctx context.Context) ([]model.User, error) {
+	users := ss.sorted(func(u model.User) bool {
+		return matches(query.LastName, u.LastName) &&
+			matches(query.UserName, u.UserName) &&
+			hasPhone(query.Phone, u.Phones) &&
+			strings.HasPrefix(u.EmailID, query.EmailPrefix) &&
+			hasIndex(query.EmailPrefixIndex, u.EmailPrefixes) &&
+			matchesAny(query.LastNames, u.LastName) &&
+			hasAnyPhone(query.Phones, u.Phones)
+	})
+
+	// before reports whether the position (av, aid) comes before (bv, bid) in the requested order
+	before := func(av, aid, bv, bid string) bool {
+		if av == bv {
+			av, bv = aid, bid
+		}
+		if query.Descending {
+			return av > bv
+		}
+		return av < bv
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		return before(users[i].SortValue(query.Sort), users[i].ID, users[j].SortValue(query.Sort), users[j].ID)
+	})
+
+	page := make([]model.User, 0, query.Limit)
+	for _, u := range users {
+		if len(page) == query.Limit {
+			break
+		}
+		if query.After == nil || before(query.After.Value, query.After.ID, u.SortValue(query.Sort), u.ID) {
+			page = append(page, u)
+		}
+	}
+	return page, nil
+}
+
+// Search returns every user matching all non-empty fields of filter.
+func (ss *Memory) Search(filter model.UserFilter, ctx context.Context) ([]model.User, error) {
+	return ss.sorted(func(u model.User) bool {
+		return matches(filter.FirstName, u.FirstName) &&
+			matches(filter.LastName, u.LastName) &&
+			matches(filter.UserName, u.UserName) &&
+			matches(filter.EmailID, u.EmailID) &&
+			hasPhone(filter.Phone, u.Phones) &&
+			matches(filter.CanonicalEmail, u.CanonicalEmail) &&
+			matches(filter.CanonicalUserName, u.CanonicalUserName)
+	}), nil
+}
+
+func (ss *Memory) sorted(keep func(model.User) bool) []model.User {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	users := make([]model.User, 0, len(ss.users))
+	for _, u := range ss.users {
+		if keep(u) {
+			users = append(users, clone(u))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+func matches(want, got string) bool {
+	return want == "" || want == got
+}
+
+// matchesAny reports whether got is one of want, which matches everything when empty.
+func matchesAny(want []string, got string) bool {
+	for _, w := range want {
+		if w == got {
+			return true
+		}
+	}
+	return len(want) == 0
+}
+
+// hasIndex reports whether indexes hold want, which matches everything when empty.
+func hasIndex(want string, indexes []string) bool {
+	for _, index := range indexes {
+		if index == want {
+			return true
+		}
+	}
+	return want == ""
+}
+
+// hasAnyPhone reports whether phones hold one of the numbers of want, which matches everything when empty.
+func hasAnyPhone(want []string, phones []model.Phone) bool {
+	for _, w := range want {
+		if hasPhone(w, phones) {
+			return true
+		}
+	}
+	return len(want) == 0
+}
+
+func hasPhone(want string, phones []model.Phone) bool {
+	if want == "" {
+		return true
+	}
+	for _, p := range phones {
+		if p.Number == want {
+			return true
+		}
+	}
+	return false
+}
+
+// clone copies the contact slices of user so callers cannot modify stored users in place.
+func clone(user model.User) model.User {
+	user.Phones = append([]model.Phone(nil), user.Phones...)
+	user.Emails = append([]model.Email(nil), user.Emails...)
+	user.Addresses = append([]model.Address(nil), user.Addresses...)
+	for i := range user.Addresses {
+		user.Addresses[i].Lines = append([]string(nil), user.Addresses[i].Lines...)
+	}
+	return user
+}
@@ -0,0 +1,174 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+func TestUpsertComparesVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  bool
+		version int64
+		err     error
+	}{
+		{"new user", false, 0, nil},
+		{"new user at a version", false, 1, model.ErrVersionConflict},
+		{"current version", true, 1, nil},
+		{"stale version", true, 0, model.ErrVersionConflict},
+		{"future version", true, 2, model.ErrVersionConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := New()
+			ctx := context.Background()
+			if tt.stored {
+				if _, err := ss.Upsert(model.User{ID: "u1", FirstName: "Ada"}, 0, ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			stored, err := ss.Upsert(model.User{ID: "u1", FirstName: "Augusta"}, tt.version, ctx)
+			if errors.Cause(err) != tt.err {
+				t.Fatalf("upsert at version %d failed with %v, want %v", tt.version, err, tt.err)
+			}
+			got, _ := ss.Get("u1", ctx)
+			if err == nil && (stored.Version != tt.version+1 || got.FirstName != "Augusta") {
+				t.Errorf("upsert stored %q at version %d, want Augusta at %d", got.FirstName, stored.Version,
+					tt.version+1)
+			}
+			if err != nil && tt.stored && (got.FirstName != "Ada" || got.Version != 1) {
+				t.Errorf("failed upsert changed the user to %q at version %d", got.FirstName, got.Version)
+			}
+		})
+	}
+}
+
+func TestUpsertKeepsFieldsUnique(t *testing.T) {
+	stored := model.User{ID: "u1", UserName: "ada", EmailID: "ada@example.com", EmailIndex: "i1"}
+	tests := []struct {
+		name  string
+		user  model.User
+		field string
+	}{
+		{"other fields", model.User{ID: "u2", UserName: "grace", EmailID: "grace@example.com"}, ""},
+		{"same user", model.User{ID: "u1", UserName: "ada", EmailID: "ada@example.com"}, ""},
+		{"empty fields", model.User{ID: "u2"}, ""},
+		{"user name", model.User{ID: "u2", UserName: "ada"}, "userName"},
+		{"user name in another case", model.User{ID: "u2", UserName: "ADA"}, "userName"},
+		{"email in another case", model.User{ID: "u2", EmailID: "Ada@Example.com"}, "emailId"},
+		{"blind index", model.User{ID: "u2", EmailID: "enc:k2:...", EmailIndex: "i1"}, "emailId"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := New()
+			ctx := context.Background()
+			if _, err := ss.Upsert(stored, 0, ctx); err != nil {
+				t.Fatal(err)
+			}
+			current, _ := ss.Get(tt.user.ID, ctx)
+			_, err := ss.Upsert(tt.user, current.Version, ctx)
+			var want error
+			if tt.field != "" {
+				want = model.DuplicateError{Field: tt.field}
+			}
+			if errors.Cause(err) != want {
+				t.Errorf("upsert failed with %v, want %v", err, want)
+			}
+		})
+	}
+}
+
+func TestDeleteComparesVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		userId  string
+		version int64
+		err     error
+	}{
+		{"current version", "u1", 1, nil},
+		{"stale version", "u1", 0, model.ErrVersionConflict},
+		{"unknown user", "u2", 1, model.ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := New()
+			ctx := context.Background()
+			if _, err := ss.Upsert(model.User{ID: "u1"}, 0, ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := ss.Delete(tt.userId, tt.version, ctx); errors.Cause(err) != tt.err {
+				t.Fatalf("delete failed with %v, want %v", err, tt.err)
+			}
+			_, err := ss.Get("u1", ctx)
+			if deleted := errors.Cause(err) == model.ErrUserNotFound; deleted != (tt.err == nil) {
+				t.Errorf("user deleted: %v, want %v", deleted, tt.err == nil)
+			}
+		})
+	}
+}
+
+func TestEraseTouchesEveryStore(t *testing.T) {
+	ss := New()
+	ctx := context.Background()
+	for _, userId := range []string{"u1", "u2"} {
+		if _, err := ss.Upsert(model.User{ID: userId}, 0, ctx); err != nil {
+			t.Fatal(err)
+		}
+		ss.Keep(model.Snapshot{UserID: userId, Version: 1}, ctx)
+		ss.Record(model.Consent{UserID: userId}, ctx)
+		ss.LogAccesses([]model.Access{{UserID: userId}}, ctx)
+		ss.Append(model.AuditRecord{UserID: userId, Changes: []model.Change{{Field: "/lastName", After: []byte(`"Lovelace"`)}}}, ctx)
+		event := model.UserEvent{ID: "e-" + userId, UserID: userId, BusinessUnit: 7, Fields: []string{"/lastName"},
+			RequestID: "r1"}
+		ss.Transact(func(ctx context.Context) ([]model.UserEvent, error) { return []model.UserEvent{event}, nil }, ctx)
+		ss.AddDelivery(model.Delivery{ID: "d-" + userId, WebhookID: "w1", Event: event}, ctx)
+	}
+	ss.AddRedirect(model.Redirect{ID: "merged", SurvivorID: "u1"}, ctx)
+	ss.AddRedirect(model.Redirect{ID: "u1", SurvivorID: "other"}, ctx)
+
+	tests := []struct {
+		name  string
+		count int64
+	}{
+		{"first erasure", 1},
+		{"erasing again", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := ss.Erase("u1", ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]int64{"users": tt.count, "snapshots": tt.count, "consents": tt.count,
+				"accesses": tt.count, "redirects": 2 * tt.count, "deliveries": tt.count, "outbox": tt.count,
+				"audit": tt.count}
+			for _, step := range steps {
+				if step.Count != want[step.Target] {
+					t.Errorf("%s %s %d, want %d", step.Action, step.Target, step.Count, want[step.Target])
+				}
+				delete(want, step.Target)
+			}
+			if len(want) > 0 {
+				t.Errorf("erasure left out %v", want)
+			}
+		})
+	}
+
+	events, _ := ss.Since(0, 10, ctx)
+	if len(events) != 2 || events[0].BusinessUnit != 0 || len(events[0].Fields) != 0 || events[0].RequestID != "" ||
+		events[0].Sequence != 1 {
+		t.Errorf("events of the erased user are %+v, want them anonymized in place", events)
+	}
+	if events[1].BusinessUnit != 7 {
+		t.Errorf("events of other users were anonymized: %+v", events[1])
+	}
+	if accesses, _ := ss.Accesses("u2", ctx); len(accesses) != 1 {
+		t.Errorf("accesses of other users were erased")
+	}
+	if deliveries, _ := ss.Deliveries("w1", "", 10, ctx); len(deliveries) != 1 || deliveries[0].ID != "d-u2" {
+		t.Errorf("deliveries are %+v, want those of the other user", deliveries)
+	}
+}
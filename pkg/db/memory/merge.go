@@ -0,0 +1,28 @@
+package memory
+
+import (
+	"context"
+	"user-details/pkg/model"
+)
+
+// AddRedirect stores redirect.
+func (ss *Memory) AddRedirect(redirect model.Redirect, ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.redirects = append(ss.redirects, redirect)
+	return nil
+}
+
+// Redirect returns the latest redirect of userId.
+func (ss *Memory) Redirect(userId string, ctx context.Context) (model.Redirect, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	for i := len(ss.redirects) - 1; i >= 0; i-- {
+		if ss.redirects[i].ID == userId {
+			redirect := ss.redirects[i]
+			redirect.Actor.Roles = append([]string(nil), redirect.Actor.Roles...)
+			return redirect, nil
+		}
+	}
+	return model.Redirect{}, model.ErrUserNotFound
+}
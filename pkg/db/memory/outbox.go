@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"context"
+	"time"
+	"user-details/pkg/model"
+)
+
+// Transact calls write and appends the events it returns once it succeeded. Memory keeps no transactions, but it
+// does not outlive the process either.
+func (ss *Memory) Transact(write func(ctx context.Context) ([]model.UserEvent, error), ctx context.Context) error {
+	events, err := write(ctx)
+	if err != nil {
+		return err
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for _, event := range events {
+		event.Fields = append([]string(nil), event.Fields...)
+		event.Sequence = int64(len(ss.outbox)) + 1
+		ss.outbox = append(ss.outbox, event)
+	}
+	return nil
+}
+
+// Pending returns up to limit events not published yet, oldest first.
+func (ss *Memory) Pending(limit int, ctx context.Context) ([]model.UserEvent, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	events := make([]model.UserEvent, 0)
+	for _, e := range ss.outbox {
+		if len(events) == limit {
+			break
+		}
+		if e.Published == nil {
+			e.Fields = append([]string(nil), e.Fields...)
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// MarkPublished records that the event stored under eventId was published at at.
+func (ss *Memory) MarkPublished(eventId string, at time.Time, ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for i := range ss.outbox {
+		if ss.outbox[i].ID == eventId {
+			ss.outbox[i].Published = &at
+		}
+	}
+	return nil
+}
+
+// Since returns up to limit events numbered after sequence, in sequence order.
+func (ss *Memory) Since(sequence int64, limit int, ctx context.Context) ([]model.UserEvent, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	events := make([]model.UserEvent, 0)
+	// events are numbered by their position in the outbox
+	for i := sequence; i >= 0 && i < int64(len(ss.outbox)) && len(events) < limit; i++ {
+		e := ss.outbox[i]
+		e.Fields = append([]string(nil), e.Fields...)
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// LastSequence returns the sequence of the latest event, 0 when there is none.
+func (ss *Memory) LastSequence(ctx context.Context) (int64, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return int64(len(ss.outbox)), nil
+}
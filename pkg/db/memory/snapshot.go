@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"context"
+	"time"
+	"user-details/pkg/model"
+)
+
+// Keep stores snapshot.
+func (ss *Memory) Keep(snapshot model.Snapshot, ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	snapshot.User = clone(snapshot.User)
+	ss.snapshots = append(ss.snapshots, snapshot)
+	return nil
+}
+
+// AsOf returns the latest snapshot of userId taken at or before at.
+func (ss *Memory) AsOf(userId string, at time.Time, ctx context.Context) (model.Snapshot, error) {
+	return ss.latestSnapshot(func(s model.Snapshot) bool {
+		return s.UserID == userId && !s.Timestamp.After(at)
+	})
+}
+
+// Snapshot returns the latest snapshot of userId at version.
+func (ss *Memory) Snapshot(userId string, version int64, ctx context.Context) (model.Snapshot, error) {
+	return ss.latestSnapshot(func(s model.Snapshot) bool {
+		return s.UserID == userId && s.Version == version && !s.Deleted
+	})
+}
+
+func (ss *Memory) latestSnapshot(keep func(model.Snapshot) bool) (model.Snapshot, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	var latest model.Snapshot
+	found := false
+	for _, s := range ss.snapshots {
+		if keep(s) && (!found || !s.Timestamp.Before(latest.Timestamp)) {
+			latest, found = s, true
+		}
+	}
+	if !found {
+		return latest, model.ErrSnapshotNotFound
+	}
+	latest.User = clone(latest.User)
+	return latest, nil
+}
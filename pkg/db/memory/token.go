@@ -0,0 +1,32 @@
+package memory
+
+import (
+	"context"
+	"user-details/pkg/model"
+)
+
+// Tokenize stores token unless a token of the same field and value is stored already, and returns the stored token.
+func (ss *Memory) Tokenize(token model.Token, ctx context.Context) (model.Token, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for _, t := range ss.tokens {
+		if t.Field == token.Field && t.Value == token.Value {
+			return t, nil
+		}
+	}
+	ss.tokens[token.Token] = token
+	return token, nil
+}
+
+// Detokenize returns the stored tokens among tokens.
+func (ss *Memory) Detokenize(tokens []string, ctx context.Context) ([]model.Token, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	found := make([]model.Token, 0, len(tokens))
+	for _, token := range tokens {
+		if t, ok := ss.tokens[token]; ok {
+			found = append(found, t)
+		}
+	}
+	return found, nil
+}
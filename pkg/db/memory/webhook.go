@@ -0,0 +1,142 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+	"user-details/pkg/model"
+)
+
+// SaveWebhook stores webhook in place of the webhook stored under the same id, if any.
+func (ss *Memory) SaveWebhook(webhook model.Webhook, ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	webhook.Events = append([]string(nil), webhook.Events...)
+	ss.webhooks[webhook.ID] = webhook
+	return nil
+}
+
+// Webhook returns the webhook stored under webhookId.
+func (ss *Memory) Webhook(webhookId string, ctx context.Context) (model.Webhook, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	webhook, ok := ss.webhooks[webhookId]
+	if !ok {
+		return webhook, model.ErrWebhookNotFound
+	}
+	webhook.Events = append([]string(nil), webhook.Events...)
+	return webhook, nil
+}
+
+// Webhooks returns every webhook, by id.
+func (ss *Memory) Webhooks(ctx context.Context) ([]model.Webhook, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	webhooks := make([]model.Webhook, 0, len(ss.webhooks))
+	for _, w := range ss.webhooks {
+		w.Events = append([]string(nil), w.Events...)
+		webhooks = append(webhooks, w)
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes the webhook stored under webhookId along with its deliveries.
+func (ss *Memory) DeleteWebhook(webhookId string, ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if _, ok := ss.webhooks[webhookId]; !ok {
+		return model.ErrWebhookNotFound
+	}
+	delete(ss.webhooks, webhookId)
+	kept := ss.deliveries[:0]
+	for _, d := range ss.deliveries {
+		if d.WebhookID != webhookId {
+			kept = append(kept, d)
+		}
+	}
+	ss.deliveries = kept
+	return nil
+}
+
+// AddDelivery stores delivery unless a delivery is stored under its id already.
+func (ss *Memory) AddDelivery(delivery model.Delivery, ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for _, d := range ss.deliveries {
+		if d.ID == delivery.ID {
+			return nil
+		}
+	}
+	ss.deliveries = append(ss.deliveries, cloneDelivery(delivery))
+	return nil
+}
+
+// SaveDelivery stores delivery in place of the delivery stored under the same id.
+func (ss *Memory) SaveDelivery(delivery model.Delivery, ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for i := range ss.deliveries {
+		if ss.deliveries[i].ID == delivery.ID {
+			ss.deliveries[i] = cloneDelivery(delivery)
+			return nil
+		}
+	}
+	return model.ErrDeliveryNotFound
+}
+
+// Delivery returns the delivery of webhookId stored under deliveryId.
+func (ss *Memory) Delivery(webhookId, deliveryId string, ctx context.Context) (model.Delivery, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	for _, d := range ss.deliveries {
+		if d.ID == deliveryId && d.WebhookID == webhookId {
+			return cloneDelivery(d), nil
+		}
+	}
+	return model.Delivery{}, model.ErrDeliveryNotFound
+}
+
+// Deliveries returns up to limit deliveries of webhookId in status, or in any status when it is empty, newest first.
+func (ss *Memory) Deliveries(webhookId, status string, limit int, ctx context.Context) ([]model.Delivery, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	deliveries := make([]model.Delivery, 0)
+	// deliveries are appended in creation order
+	for i := len(ss.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		d := ss.deliveries[i]
+		if d.WebhookID == webhookId && (status == "" || d.Status == status) {
+			deliveries = append(deliveries, cloneDelivery(d))
+		}
+	}
+	return deliveries, nil
+}
+
+// DueDeliveries returns up to limit pending deliveries whose next attempt is due at now, earliest first.
+func (ss *Memory) DueDeliveries(now time.Time, limit int, ctx context.Context) ([]model.Delivery, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	deliveries := make([]model.Delivery, 0)
+	for _, d := range ss.deliveries {
+		if d.Status == model.DeliveryPending && d.NextAttempt != nil && !d.NextAttempt.After(now) {
+			deliveries = append(deliveries, cloneDelivery(d))
+		}
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttempt.Before(*deliveries[j].NextAttempt)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func cloneDelivery(delivery model.Delivery) model.Delivery {
+	delivery.Event.Fields = append([]string(nil), delivery.Event.Fields...)
+	delivery.Attempts = append([]model.DeliveryAttempt(nil), delivery.Attempts...)
+	if delivery.NextAttempt != nil {
+		next := *delivery.NextAttempt
+		delivery.NextAttempt = &next
+	}
+	return delivery
+}
@@ -0,0 +1,46 @@
+package mongo
+
+import (
+	"context"
+	"user-details/pkg/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LogAccesses stores accesses in the access collection.
+func (ss *Mongo) LogAccesses(accesses []model.Access, ctx context.Context) error {
+	if len(accesses) == 0 {
+		return nil
+	}
+	documents := make([]interface{}, len(accesses))
+	for i, access := range accesses {
+		documents[i] = access
+	}
+	_, err := ss.Database.Collection(ss.AccessCollection).InsertMany(ctx, documents)
+	return err
+}
+
+// Accesses returns the accesses of userId, oldest first.
+func (ss *Mongo) Accesses(userId string, ctx context.Context) ([]model.Access, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "id", Value: 1}})
+	cursor, err := ss.Database.Collection(ss.AccessCollection).Find(ctx, bson.M{"userId": userId}, opts)
+	if err != nil {
+		return nil, err
+	}
+	accesses := make([]model.Access, 0)
+	if err := cursor.All(ctx, &accesses); err != nil {
+		return nil, err
+	}
+	return accesses, nil
+}
+
+// EnsureAccessIndexes creates the indexes the accesses of users are read with.
+func (ss *Mongo) EnsureAccessIndexes(ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.AccessCollection).Indexes().CreateMany(ctx, []driver.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "id", Value: 1}}},
+	})
+	return err
+}
@@ -0,0 +1,43 @@
+package mongo
+
+import (
+	"context"
+	"user-details/pkg/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Append stores record in the audit collection.
+func (ss *Mongo) Append(record model.AuditRecord, ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.AuditCollection).InsertOne(ctx, record)
+	return err
+}
+
+// History returns up to query.Limit records of query.UserID older than query.Before, newest first.
+func (ss *Mongo) History(query model.HistoryQuery, ctx context.Context) ([]model.AuditRecord, error) {
+	filter := bson.M{"userId": query.UserID}
+	if query.Before != "" {
+		filter["id"] = bson.M{"$lt": query.Before}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "id", Value: -1}}).SetLimit(int64(query.Limit))
+	cursor, err := ss.Database.Collection(ss.AuditCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]model.AuditRecord, 0)
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// EnsureAuditIndexes creates the indexes the history of users is read with.
+func (ss *Mongo) EnsureAuditIndexes(ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.AuditCollection).Indexes().CreateMany(ctx, []driver.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "id", Value: -1}}},
+	})
+	return err
+}
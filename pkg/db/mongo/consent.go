@@ -0,0 +1,46 @@
+package mongo
+
+import (
+	"context"
+	"user-details/pkg/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Record stores consent in the consent collection.
+func (ss *Mongo) Record(consent model.Consent, ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.ConsentCollection).InsertOne(ctx, consent)
+	return err
+}
+
+// MoveConsents hands the consents of fromUserId over to toUserId.
+func (ss *Mongo) MoveConsents(fromUserId, toUserId string, ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.ConsentCollection).UpdateMany(ctx, bson.M{"userId": fromUserId},
+		bson.M{"$set": bson.M{"userId": toUserId}})
+	return err
+}
+
+// Consents returns the consents of userId, oldest first.
+func (ss *Mongo) Consents(userId string, ctx context.Context) ([]model.Consent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "id", Value: 1}})
+	cursor, err := ss.Database.Collection(ss.ConsentCollection).Find(ctx, bson.M{"userId": userId}, opts)
+	if err != nil {
+		return nil, err
+	}
+	consents := make([]model.Consent, 0)
+	if err := cursor.All(ctx, &consents); err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
+
+// EnsureConsentIndexes creates the indexes the consents of users are read with.
+func (ss *Mongo) EnsureConsentIndexes(ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.ConsentCollection).Indexes().CreateMany(ctx, []driver.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "id", Value: 1}}},
+	})
+	return err
+}
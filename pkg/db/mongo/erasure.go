@@ -0,0 +1,94 @@
+package mongo
+
+import (
+	"context"
+	"user-details/pkg/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Erase deletes the user stored under userId, its snapshots, its consents, its accesses, the redirects from and to it,
+// the deliveries of its events and the key the watcher kept of it, and removes the values from the changes of its
+// audit records and the business unit, fields and request id from its events. Called within Transact, it erases in
+// the transaction of the write.
+func (ss *Mongo) Erase(userId string, ctx context.Context) ([]model.ErasureStep, error) {
+	users, err := ss.Database.Collection(ss.Collection).DeleteOne(ctx, bson.M{"id": userId})
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := ss.Database.Collection(ss.SnapshotCollection).DeleteMany(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return nil, err
+	}
+	consents, err := ss.Database.Collection(ss.ConsentCollection).DeleteMany(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return nil, err
+	}
+	// without its key, the watcher cannot tell the delete of the user apart, which the erasure announces itself
+	keys, err := ss.Database.Collection(ss.WatchKeyCollection).DeleteMany(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return nil, err
+	}
+	accesses, err := ss.Database.Collection(ss.AccessCollection).DeleteMany(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return nil, err
+	}
+	redirects, err := ss.Database.Collection(ss.MergeCollection).DeleteMany(ctx,
+		bson.M{"$or": bson.A{bson.M{"id": userId}, bson.M{"survivorId": userId}}})
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := ss.Database.Collection(ss.DeliveryCollection).DeleteMany(ctx, bson.M{"event.userId": userId})
+	if err != nil {
+		return nil, err
+	}
+	// events keep their sequence, which streams resume from
+	events, err := ss.Database.Collection(ss.OutboxCollection).UpdateMany(ctx, bson.M{"userId": userId},
+		bson.M{"$set": bson.M{"fields": bson.A{}, "requestId": ""}, "$unset": bson.M{"businessUnit": ""}})
+	if err != nil {
+		return nil, err
+	}
+	records, err := ss.Database.Collection(ss.AuditCollection).UpdateMany(ctx,
+		bson.M{"userId": userId, "changes.0": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"changes.$[].before": "", "changes.$[].after": ""}})
+	if err != nil {
+		return nil, err
+	}
+	return []model.ErasureStep{
+		{Store: "mongo", Target: ss.Collection, Action: model.ErasureDeleted, Count: users.DeletedCount},
+		{Store: "mongo", Target: ss.SnapshotCollection, Action: model.ErasureDeleted, Count: snapshots.DeletedCount},
+		{Store: "mongo", Target: ss.ConsentCollection, Action: model.ErasureDeleted, Count: consents.DeletedCount},
+		{Store: "mongo", Target: ss.WatchKeyCollection, Action: model.ErasureDeleted, Count: keys.DeletedCount},
+		{Store: "mongo", Target: ss.AccessCollection, Action: model.ErasureDeleted, Count: accesses.DeletedCount},
+		{Store: "mongo", Target: ss.MergeCollection, Action: model.ErasureDeleted, Count: redirects.DeletedCount},
+		{Store: "mongo", Target: ss.DeliveryCollection, Action: model.ErasureDeleted, Count: deliveries.DeletedCount},
+		{Store: "mongo", Target: ss.OutboxCollection, Action: model.ErasureAnonymized, Count: events.ModifiedCount},
+		{Store: "mongo", Target: ss.AuditCollection, Action: model.ErasureAnonymized, Count: records.ModifiedCount},
+	}, nil
+}
+
+// Revoke deletes the tokens standing for value of field.
+func (ss *Mongo) Revoke(field, value string, ctx context.Context) (int64, error) {
+	result, err := ss.Database.Collection(ss.TokenCollection).DeleteMany(ctx, bson.M{"field": field, "value": value})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// KeepCertificate stores certificate in the erasure collection.
+func (ss *Mongo) KeepCertificate(certificate model.ErasureCertificate, ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.ErasureCollection).InsertOne(ctx, certificate)
+	return err
+}
+
+// EnsureErasureIndexes creates the indexes erasure certificates are looked up by.
+func (ss *Mongo) EnsureErasureIndexes(ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.ErasureCollection).Indexes().CreateMany(ctx, []driver.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+	})
+	return err
+}
@@ -0,0 +1,36 @@
+package mongo
+
+import (
+	"context"
+	"user-details/pkg/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AddRedirect stores redirect in the merge collection.
+func (ss *Mongo) AddRedirect(redirect model.Redirect, ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.MergeCollection).InsertOne(ctx, redirect)
+	return err
+}
+
+// Redirect returns the latest redirect of userId.
+func (ss *Mongo) Redirect(userId string, ctx context.Context) (model.Redirect, error) {
+	var redirect model.Redirect
+	opts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}})
+	err := ss.Database.Collection(ss.MergeCollection).FindOne(ctx, bson.M{"id": userId}, opts).Decode(&redirect)
+	if err == driver.ErrNoDocuments {
+		return redirect, model.ErrUserNotFound
+	}
+	return redirect, err
+}
+
+// EnsureMergeIndexes creates the indexes the redirects of merged users are read and erased with.
+func (ss *Mongo) EnsureMergeIndexes(ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.MergeCollection).Indexes().CreateMany(ctx, []driver.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "survivorId", Value: 1}}},
+	})
+	return err
+}
@@ -1,19 +1,267 @@
 package mongo
 
 import (
+	"context"
+	"regexp"
+	"strings"
+	"user-details/pkg/model"
+
 	"vendor.lib/tng/tng-lib/db/mgo"
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// Mongo represents the mongo connection and the collections users, their audit trail, their earlier versions, their
+// consents, the reads of users, the redirects of merged users, the outbox of their change events, the webhooks the events are delivered
+// to, the resume tokens of the user collection watcher, the tokens standing for their values and the certificates of
+// their erasure are stored in.
 type Mongo struct {
 	mgo.Mongo
-	Collection string
+	Collection         string
+	AuditCollection    string
+	SnapshotCollection string
+	TokenCollection    string
+	ErasureCollection  string
+	ConsentCollection  string
+	AccessCollection   string
+	MergeCollection    string
+	OutboxCollection   string
+	SequenceCollection string
+	WebhookCollection  string
+	DeliveryCollection string
+	WatchCollection    string
+	WatchKeyCollection string
+	// FieldDigest returns the keyed digest of value of field, which the watcher tells the fields replaces changed by
+	// without keeping their values. The watcher keeps no digests while it is nil.
+	FieldDigest func(field, value string) string
 }
 
-func (ss *Mongo) FindUser(userId string, ctx context.Context) (model.User, error){
+// Get returns the user stored under userId.
+func (ss *Mongo) Get(userId string, ctx context.Context) (model.User, error) {
 	var user model.User
-	collection := ss.Database(ctx, bson.M{"userId":userId}).Decode(&user)
-	if err != nil{
-		return user, nil
+	err := ss.Database.Collection(ss.Collection).FindOne(ctx, bson.M{"id": userId}).Decode(&user)
+	if err == driver.ErrNoDocuments {
+		return user, model.ErrUserNotFound
+	}
+	if err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+// Upsert stores user as version+1 when the user stored under user.ID is at version, 0 meaning it may not exist yet.
+func (ss *Mongo) Upsert(user model.User, version int64, ctx context.Context) (model.User, error) {
+	user.Version = version + 1
+	// only a new user may be inserted, so a stored user at another version makes the upsert collide with the
+	// unique id index
+	opts := options.Replace().SetUpsert(version == 0)
+	result, err := ss.Database.Collection(ss.Collection).ReplaceOne(ctx, versionFilter(user.ID, version), user, opts)
+	if index, ok := duplicateKey(err); ok {
+		if field := uniqueField(index); field != "" {
+			return user, model.DuplicateError{Field: field}
+		}
+		return user, model.ErrVersionConflict
+	}
+	if err != nil {
+		return user, err
+	}
+	if result.MatchedCount == 0 && result.UpsertedCount == 0 {
+		return user, model.ErrVersionConflict
 	}
 	return user, nil
-}
\ No newline at end of file
+}
+
+// Delete removes the user stored under userId when it is at version.
+func (ss *Mongo) Delete(userId string, version int64, ctx context.Context) error {
+	result, err := ss.Database.Collection(ss.Collection).DeleteOne(ctx, versionFilter(userId, version))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		if _, err := ss.Get(userId, ctx); err != nil {
+			return err
+		}
+		return model.ErrVersionConflict
+	}
+	return nil
+}
+
+// List returns up to query.Limit users matching query, ordered by query.Sort then id.
+func (ss *Mongo) List(query model.UserQuery, ctx context.Context) ([]model.User, error) {
+	filter := bson.M{}
+	for field, value := range map[string]string{
+		"lastName":      query.LastName,
+		"userName":      query.UserName,
+		"phones.number": query.Phone,
+	} {
+		if value != "" {
+			filter[field] = value
+		}
+	}
+	for field, values := range map[string][]string{
+		"lastName":      query.LastNames,
+		"phones.number": query.Phones,
+	} {
+		if len(values) > 0 {
+			filter[field] = bson.M{"$in": values}
+		}
+	}
+	if query.EmailPrefix != "" {
+		// an anchored, case sensitive prefix regex is answered from the emailId index
+		filter["emailId"] = bson.M{"$regex": "^" + regexp.QuoteMeta(query.EmailPrefix)}
+	}
+	if query.EmailPrefixIndex != "" {
+		filter["emailPrefixes"] = query.EmailPrefixIndex
+	}
+
+	order, after := 1, "$gt"
+	if query.Descending {
+		order, after = -1, "$lt"
+	}
+	if query.After != nil {
+		if query.Sort == "id" {
+			filter["id"] = bson.M{after: query.After.ID}
+		} else {
+			filter["$or"] = bson.A{
+				bson.M{query.Sort: bson.M{after: query.After.Value}},
+				bson.M{query.Sort: query.After.Value, "id": bson.M{after: query.After.ID}},
+			}
+		}
+	}
+
+	sort := bson.D{{Key: "id", Value: order}}
+	if query.Sort != "id" {
+		sort = append(bson.D{{Key: query.Sort, Value: order}}, sort...)
+	}
+	opts := options.Find().SetSort(sort).SetLimit(int64(query.Limit))
+	return ss.find(filter, opts, ctx)
+}
+
+// EnsureIndexes creates the indexes listing and looking up users rely on, as well as the case insensitive unique
+// indexes of model.UniqueFields and the unique indexes of model.BlindIndexes. Existing indexes are left untouched.
+func (ss *Mongo) EnsureIndexes(ctx context.Context) error {
+	models := []driver.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	}
+	for _, field := range model.UniqueFields {
+		models = append(models, driver.IndexModel{
+			Keys: bson.D{{Key: field, Value: 1}},
+			Options: options.Index().
+				SetName(uniqueIndex(field)).
+				SetUnique(true).
+				// strength 2 compares letters without their case
+				SetCollation(&options.Collation{Locale: "en", Strength: 2}).
+				// users stored before the field was required may have it empty
+				SetPartialFilterExpression(bson.M{field: bson.M{"$gt": ""}}),
+		})
+	}
+	for field := range model.BlindIndexes {
+		models = append(models, driver.IndexModel{
+			Keys: bson.D{{Key: field, Value: 1}},
+			Options: options.Index().
+				SetName(uniqueIndex(field)).
+				SetUnique(true).
+				// users stored before encryption was enabled have none
+				SetPartialFilterExpression(bson.M{field: bson.M{"$gt": ""}}),
+		})
+	}
+	for _, field := range []string{"lastName", "userName", "emailId", "phones.number", "emailPrefixes"} {
+		models = append(models, driver.IndexModel{Keys: bson.D{{Key: field, Value: 1}, {Key: "id", Value: 1}}})
+	}
+	for _, field := range []string{"canonicalEmail", "canonicalUserName"} {
+		models = append(models, driver.IndexModel{Keys: bson.D{{Key: field, Value: 1}}})
+	}
+	_, err := ss.Database.Collection(ss.Collection).Indexes().CreateMany(ctx, models)
+	return err
+}
+
+// Search returns every user matching all non-empty fields of filter.
+func (ss *Mongo) Search(filter model.UserFilter, ctx context.Context) ([]model.User, error) {
+	query := bson.M{}
+	for field, value := range map[string]string{
+		"firstName":     filter.FirstName,
+		"lastName":      filter.LastName,
+		"userName":      filter.UserName,
+		"emailId":       filter.EmailID,
+		"phones.number": filter.Phone,
+
+		"canonicalEmail":    filter.CanonicalEmail,
+		"canonicalUserName": filter.CanonicalUserName,
+	} {
+		if value != "" {
+			query[field] = value
+		}
+	}
+	return ss.find(query, options.Find().SetSort(bson.M{"id": 1}), ctx)
+}
+
+// versionFilter matches the user stored under userId at version. Version 0 also matches users stored before
+// versioning was introduced.
+func versionFilter(userId string, version int64) bson.M {
+	if version == 0 {
+		return bson.M{"id": userId, "version": bson.M{"$in": bson.A{nil, 0}}}
+	}
+	return bson.M{"id": userId, "version": version}
+}
+
+// duplicateKey reports whether err is a duplicate key error, along with the name of the violated index. Writes
+// report them as write exceptions, find and modify commands as command errors.
+func duplicateKey(err error) (string, bool) {
+	switch e := err.(type) {
+	case driver.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == 11000 {
+				return violatedIndex(we.Message), true
+			}
+		}
+	case driver.CommandError:
+		if e.Code == 11000 {
+			return violatedIndex(e.Message), true
+		}
+	}
+	return "", false
+}
+
+// violatedIndex returns the index named by a duplicate key error message, which reads
+// E11000 duplicate key error collection: <db>.<collection> index: <name> dup key: { ... }
+func violatedIndex(message string) string {
+	if i := strings.Index(message, "index: "); i >= 0 {
+		if fields := strings.Fields(message[i+len("index: "):]); len(fields) > 0 {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// uniqueIndex names the case insensitive unique index of field.
+func uniqueIndex(field string) string {
+	return field + "_unique"
+}
+
+// uniqueField returns the field enforced unique by index, empty if index is not a unique field index.
+func uniqueField(index string) string {
+	for _, field := range model.UniqueFields {
+		if uniqueIndex(field) == index {
+			return field
+		}
+	}
+	for blindIndex, field := range model.BlindIndexes {
+		if uniqueIndex(blindIndex) == index {
+			return field
+		}
+	}
+	return ""
+}
+
+func (ss *Mongo) find(query bson.M, opts *options.FindOptions, ctx context.Context) ([]model.User, error) {
+	cursor, err := ss.Database.Collection(ss.Collection).Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]model.User, 0)
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -0,0 +1,45 @@
+package mongo
+
+import (
+	"errors"
+	"testing"
+
+	driver "go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestDuplicateKeysNameTheirField(t *testing.T) {
+	message := func(index string) string {
+		return "E11000 duplicate key error collection: users.users index: " + index + ` dup key: { : "ada" }`
+	}
+	tests := []struct {
+		name      string
+		err       error
+		duplicate bool
+		field     string
+	}{
+		{"user name", driver.WriteException{WriteErrors: driver.WriteErrors{{Code: 11000,
+			Message: message("userName_unique")}}}, true, "userName"},
+		{"email", driver.WriteException{WriteErrors: driver.WriteErrors{{Code: 11000,
+			Message: message("emailId_unique")}}}, true, "emailId"},
+		{"blind index of the email", driver.CommandError{Code: 11000, Message: message("emailIndex_unique")}, true,
+			"emailId"},
+		// an upsert of a stale version inserts a second document of the id
+		{"id", driver.WriteException{WriteErrors: driver.WriteErrors{{Code: 11000, Message: message("id_1")}}}, true,
+			""},
+		{"other write error", driver.WriteException{WriteErrors: driver.WriteErrors{{Code: 121,
+			Message: "Document failed validation"}}}, false, ""},
+		{"other error", errors.New("connection reset"), false, ""},
+		{"no error", nil, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, duplicate := duplicateKey(tt.err)
+			if duplicate != tt.duplicate {
+				t.Fatalf("duplicateKey reported %v, want %v", duplicate, tt.duplicate)
+			}
+			if field := uniqueField(index); field != tt.field {
+				t.Errorf("index %q enforces %q, want %q", index, field, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package mongo
+
+import (
+	"context"
+	"time"
+	"user-details/pkg/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// eventSequence is the id of the counter event sequences are taken from.
+const eventSequence = "events"
+
+// Transact calls write within a transaction of a new session and inserts the events it returns in the outbox
+// collection before committing. Their sequences are taken from a counter of the sequence collection, so concurrent
+// transactions conflict on it and commit one after the other, retried by the driver, which calls write again.
+// Transactions need a replica set.
+func (ss *Mongo) Transact(write func(ctx context.Context) ([]model.UserEvent, error), ctx context.Context) error {
+	session, err := ss.Database.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc driver.SessionContext) (interface{}, error) {
+		events, err := write(sc)
+		if err != nil || len(events) == 0 {
+			return nil, err
+		}
+		var counter struct {
+			Value int64 `bson:"value"`
+		}
+		opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+		err = ss.Database.Collection(ss.SequenceCollection).FindOneAndUpdate(sc, bson.M{"_id": eventSequence},
+			bson.M{"$inc": bson.M{"value": len(events)}}, opts).Decode(&counter)
+		if err != nil {
+			return nil, err
+		}
+		docs := make([]interface{}, len(events))
+		for i, event := range events {
+			event.Sequence = counter.Value - int64(len(events)-1-i)
+			docs[i] = event
+		}
+		_, err = ss.Database.Collection(ss.OutboxCollection).InsertMany(sc, docs)
+		return nil, err
+	})
+	return err
+}
+
+// Pending returns up to limit events not published yet, oldest first.
+func (ss *Mongo) Pending(limit int, ctx context.Context) ([]model.UserEvent, error) {
+	return ss.findEvents(bson.M{"published": nil}, limit, ctx)
+}
+
+// Since returns up to limit events numbered after sequence, in sequence order.
+func (ss *Mongo) Since(sequence int64, limit int, ctx context.Context) ([]model.UserEvent, error) {
+	return ss.findEvents(bson.M{"sequence": bson.M{"$gt": sequence}}, limit, ctx)
+}
+
+// LastSequence returns the sequence of the latest event, 0 when there is none.
+func (ss *Mongo) LastSequence(ctx context.Context) (int64, error) {
+	var counter struct {
+		Value int64 `bson:"value"`
+	}
+	err := ss.Database.Collection(ss.SequenceCollection).FindOne(ctx, bson.M{"_id": eventSequence}).Decode(&counter)
+	if err == driver.ErrNoDocuments {
+		return 0, nil
+	}
+	return counter.Value, err
+}
+
+func (ss *Mongo) findEvents(filter bson.M, limit int, ctx context.Context) ([]model.UserEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := ss.Database.Collection(ss.OutboxCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]model.UserEvent, 0, limit)
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// MarkPublished records that the event stored under eventId was published at at.
+func (ss *Mongo) MarkPublished(eventId string, at time.Time, ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.OutboxCollection).UpdateOne(ctx, bson.M{"id": eventId},
+		bson.M{"$set": bson.M{"published": at}})
+	return err
+}
+
+// EnsureOutboxIndexes creates the indexes the outbox is relayed, streamed and erased with, along with the counter of
+// event sequences, which older servers cannot create within transactions.
+func (ss *Mongo) EnsureOutboxIndexes(ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.OutboxCollection).Indexes().CreateMany(ctx, []driver.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "sequence", Value: 1}}},
+		{Keys: bson.D{{Key: "published", Value: 1}, {Key: "sequence", Value: 1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = ss.Database.Collection(ss.SequenceCollection).UpdateOne(ctx, bson.M{"_id": eventSequence},
+		bson.M{"$setOnInsert": bson.M{"value": 0}}, options.Update().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,50 @@
+package mongo
+
+import (
+	"context"
+	"time"
+	"user-details/pkg/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Keep stores snapshot in the snapshot collection.
+func (ss *Mongo) Keep(snapshot model.Snapshot, ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.SnapshotCollection).InsertOne(ctx, snapshot)
+	return err
+}
+
+// AsOf returns the latest snapshot of userId taken at or before at.
+func (ss *Mongo) AsOf(userId string, at time.Time, ctx context.Context) (model.Snapshot, error) {
+	return ss.latestSnapshot(bson.M{"userId": userId, "timestamp": bson.M{"$lte": at}}, ctx)
+}
+
+// Snapshot returns the latest snapshot of userId at version.
+func (ss *Mongo) Snapshot(userId string, version int64, ctx context.Context) (model.Snapshot, error) {
+	return ss.latestSnapshot(bson.M{"userId": userId, "version": version, "deleted": false}, ctx)
+}
+
+func (ss *Mongo) latestSnapshot(filter bson.M, ctx context.Context) (model.Snapshot, error) {
+	var snapshot model.Snapshot
+	opts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "id", Value: -1}})
+	err := ss.Database.Collection(ss.SnapshotCollection).FindOne(ctx, filter, opts).Decode(&snapshot)
+	if err == driver.ErrNoDocuments {
+		return snapshot, model.ErrSnapshotNotFound
+	}
+	if err != nil {
+		return snapshot, err
+	}
+	return snapshot, nil
+}
+
+// EnsureSnapshotIndexes creates the indexes earlier versions of users are read with.
+func (ss *Mongo) EnsureSnapshotIndexes(ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.SnapshotCollection).Indexes().CreateMany(ctx, []driver.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "timestamp", Value: -1}, {Key: "id", Value: -1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "version", Value: 1}}},
+	})
+	return err
+}
@@ -0,0 +1,47 @@
+package mongo
+
+import (
+	"context"
+	"user-details/pkg/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Tokenize stores token in the token collection unless a token of the same field and value is stored already, and
+// returns the stored token.
+func (ss *Mongo) Tokenize(token model.Token, ctx context.Context) (model.Token, error) {
+	filter := bson.M{"field": token.Field, "value": token.Value}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var stored model.Token
+	err := ss.Database.Collection(ss.TokenCollection).
+		FindOneAndUpdate(ctx, filter, bson.M{"$setOnInsert": token}, opts).Decode(&stored)
+	if _, ok := duplicateKey(err); ok {
+		// a concurrent request stored a token for the value first
+		err = ss.Database.Collection(ss.TokenCollection).FindOne(ctx, filter).Decode(&stored)
+	}
+	return stored, err
+}
+
+// Detokenize returns the stored tokens among tokens.
+func (ss *Mongo) Detokenize(tokens []string, ctx context.Context) ([]model.Token, error) {
+	cursor, err := ss.Database.Collection(ss.TokenCollection).Find(ctx, bson.M{"token": bson.M{"$in": tokens}})
+	if err != nil {
+		return nil, err
+	}
+	found := make([]model.Token, 0, len(tokens))
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// EnsureTokenIndexes creates the indexes tokens are looked up by, making tokens and the values of each field unique.
+func (ss *Mongo) EnsureTokenIndexes(ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.TokenCollection).Indexes().CreateMany(ctx, []driver.IndexModel{
+		{Keys: bson.D{{Key: "token", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "field", Value: 1}, {Key: "value", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	return err
+}
@@ -0,0 +1,461 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"user-details/pkg/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// keyRetention is how long the key of a deleted user document is kept after its delete was handled, so that the
+// delete still names its user when it is handled again after a failure.
+const keyRetention = 7 * 24 * time.Hour
+
+// Operations of the user collection its watcher reports.
+const (
+	ChangeInsert  = "insert"
+	ChangeUpdate  = "update"
+	ChangeReplace = "replace"
+	ChangeDelete  = "delete"
+)
+
+var changeStreamLag = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mongo_change_stream_lag_seconds",
+		Help: "Seconds between the latest change read from a change stream and its commit, 0 once caught up.",
+	},
+	[]string{"collection"},
+)
+
+func init() {
+	prometheus.MustRegister(changeStreamLag)
+}
+
+// UserChange is a write of the user collection that was not made by this service.
+type UserChange struct {
+	// Operation is one of ChangeInsert, ChangeUpdate, ChangeReplace and ChangeDelete.
+	Operation string
+	// UserID is empty when the change does not tell. Deletes only carry the _id of the user document, which the
+	// watcher keeps the user id of, see WatchUsers. DocumentKey holds the keys deletes carry, as extended JSON.
+	UserID      string
+	DocumentKey string
+	// BusinessUnit and Version are those of the user after the change, read when the change is, so possibly those of
+	// a later write. Deletes carry those the user was last seen with.
+	BusinessUnit int
+	Version      int64
+	// Fields lists the json pointers of the user fields inserts, updates and replaces wrote. Replaces of documents the
+	// watcher has not seen yet and deletes name none.
+	Fields []string
+	// Committed is when the change was committed.
+	Committed time.Time
+}
+
+// changeEvent is the part of a change stream event the watcher looks at.
+type changeEvent struct {
+	Token         bson.Raw            `bson:"_id"`
+	OperationType string              `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	Namespace     struct {
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey       bson.Raw      `bson:"documentKey"`
+	FullDocument      bson.RawValue `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields bson.Raw `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+	// SessionID and TxnNumber identify the transaction the change was made in, if any.
+	SessionID bson.Raw `bson:"lsid"`
+	TxnNumber *int64   `bson:"txnNumber"`
+}
+
+// sameTransaction reports whether e and other were made in the same transaction.
+func (e changeEvent) sameTransaction(other changeEvent) bool {
+	return e.TxnNumber != nil && other.TxnNumber != nil && *e.TxnNumber == *other.TxnNumber &&
+		bytes.Equal(e.SessionID, other.SessionID)
+}
+
+// WatchUsers reads the changes of the user collection from a change stream until ctx is done or the stream fails,
+// and calls handle with those that were not made by this service, which writes users in transactions along with an
+// event in the outbox collection. Transactions of other applications are only told apart once the stream moved past
+// them, so their changes are handled up to the configured max await later. Updates and replaces changing none of the
+// user fields, such as those of the password or lockout, are not handled.
+//
+// The watcher keeps the user id, business unit, version and digests of the user fields of every user document
+// under its _id in the watch key collection, so that deletes, which only carry the _id, name their user and replaces
+// name the fields they changed. The key collection is filled from the user collection when it is empty.
+//
+// The stream resumes after the last change handled by the watcher called name, whose resume token is kept in the watch
+// collection. Changes are thus handled at least once, and those handled before a failure may be handled again.
+// Change streams need a replica set.
+func (ss *Mongo) WatchUsers(name string, maxAwait time.Duration, handle func(change UserChange) error, ctx context.Context) error {
+	saved, err := ss.resumeToken(name, ctx)
+	if err != nil {
+		return err
+	}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup).SetMaxAwaitTime(maxAwait)
+	if saved != nil {
+		opts.SetResumeAfter(saved)
+	}
+	pipeline := driver.Pipeline{{{Key: "$match", Value: bson.M{
+		"ns.coll":       bson.M{"$in": bson.A{ss.Collection, ss.OutboxCollection}},
+		"operationType": bson.M{"$in": bson.A{ChangeInsert, ChangeUpdate, ChangeReplace, ChangeDelete}},
+	}}}}
+	stream, err := ss.Database.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+	// the stream is open before the keys are filled, so that no document written in between goes unseen
+	if err := ss.fillKeys(ctx); err != nil {
+		return err
+	}
+	lag := changeStreamLag.WithLabelValues(ss.Collection)
+
+	// held are the changes of the transaction in progress, which are ours when it inserts an event in the outbox. The
+	// keys of the documents they wrote are tracked once they were handled or found to be ours, never before, so that
+	// changes handled again after a failure are told the same way.
+	held := make([]heldChange, 0)
+	track := func() error {
+		for _, h := range held {
+			if err := h.track(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	release := func() error {
+		for _, h := range held {
+			if h.handled {
+				if err := handle(h.user); err != nil {
+					return err
+				}
+			}
+			if err := h.track(ctx); err != nil {
+				return err
+			}
+		}
+		if len(held) > 0 {
+			if err := ss.saveResumeToken(name, held[len(held)-1].event.Token, ctx); err != nil {
+				return err
+			}
+			saved = held[len(held)-1].event.Token
+		}
+		held = held[:0]
+		return nil
+	}
+
+	for {
+		found := stream.TryNext(ctx)
+		if !found && stream.Err() == nil && len(held) == 0 {
+			// caught up, the stream resumes from the latest token it got from the server
+			lag.Set(0)
+			if token := stream.ResumeToken(); token != nil && !bytes.Equal(token, saved) {
+				if err := ss.saveResumeToken(name, token, ctx); err != nil {
+					return err
+				}
+				saved = token
+			}
+			found = stream.Next(ctx)
+		}
+		if err := stream.Err(); err != nil {
+			return err
+		}
+		if !found {
+			if len(held) == 0 {
+				return ctx.Err()
+			}
+			if err := release(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var change changeEvent
+		if err := stream.Decode(&change); err != nil {
+			return err
+		}
+		lag.Set(time.Since(time.Unix(int64(change.ClusterTime.T), 0)).Seconds())
+		if len(held) > 0 && !change.sameTransaction(held[0].event) {
+			if err := release(); err != nil {
+				return err
+			}
+		}
+		if change.Namespace.Coll == ss.OutboxCollection {
+			// the changes held are the user write the event announces
+			if err := track(); err != nil {
+				return err
+			}
+			held = held[:0]
+			continue
+		}
+		h, err := ss.userChange(change, ctx)
+		if err != nil {
+			return err
+		}
+		held = append(held, h)
+		if change.TxnNumber == nil {
+			if err := release(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// heldChange is a change of the user collection waiting to be told apart from the writes of this service.
+type heldChange struct {
+	event changeEvent
+	user  UserChange
+	// handled tells whether user is handled, unless the change turns out to be ours
+	handled bool
+	// track updates the key of the document the change wrote
+	track func(ctx context.Context) error
+}
+
+// userChange returns the user change of change, named and diffed with the key the watcher kept of its document.
+func (ss *Mongo) userChange(change changeEvent, ctx context.Context) (heldChange, error) {
+	h := heldChange{event: change, handled: true, track: func(ctx context.Context) error { return nil }}
+	h.user = UserChange{Operation: change.OperationType, DocumentKey: change.DocumentKey.String(),
+		Committed: time.Unix(int64(change.ClusterTime.T), 0).UTC()}
+	id, err := change.DocumentKey.LookupErr("_id")
+	if err != nil {
+		return h, err
+	}
+	previous, known, err := ss.userKey(id, ctx)
+	if err != nil {
+		return h, err
+	}
+
+	doc, found := change.FullDocument.DocumentOK()
+	switch {
+	case change.OperationType == ChangeDelete:
+		if known {
+			h.user.UserID, h.user.BusinessUnit, h.user.Version = previous.UserID, previous.BusinessUnit, previous.Version
+		}
+		h.track = func(ctx context.Context) error { return ss.forgetKey(id, ctx) }
+	case found:
+		key := ss.newUserKey(doc)
+		h.user.UserID, h.user.BusinessUnit, h.user.Version = key.UserID, key.BusinessUnit, key.Version
+		h.track = func(ctx context.Context) error { return ss.keepKey(id, key, ctx) }
+		// without digests a replace cannot tell what it changed, so it is reported naming no fields
+		if change.OperationType == ChangeReplace && known && previous.Deleted == nil && ss.FieldDigest != nil {
+			h.user.Fields = changedFields(previous.Fields, key.Fields)
+			h.handled = len(h.user.Fields) > 0
+		}
+	case known:
+		// the user was deleted since, the key tells who it was
+		h.user.UserID, h.user.BusinessUnit = previous.UserID, previous.BusinessUnit
+	}
+	if h.user.UserID == "" {
+		// collections sharded on id carry the shard key along with the _id
+		if id, err := change.DocumentKey.LookupErr("id"); err == nil {
+			h.user.UserID, _ = id.StringValueOK()
+		}
+	}
+
+	switch change.OperationType {
+	case ChangeInsert:
+		if found {
+			h.user.Fields = userFields(topLevel(doc))
+		}
+	case ChangeUpdate:
+		names := topLevel(change.UpdateDescription.UpdatedFields)
+		h.user.Fields = userFields(append(names, change.UpdateDescription.RemovedFields...))
+		h.handled = len(h.user.Fields) > 0
+	}
+	return h, nil
+}
+
+// userKey is what the watcher keeps of a user document under its _id in the watch key collection.
+type userKey struct {
+	UserID       string `bson:"userId"`
+	BusinessUnit int    `bson:"businessUnit"`
+	Version      int64  `bson:"version"`
+	// Fields maps the bson names of the user fields of the document to the keyed digests of their values, see
+	// Mongo.FieldDigest.
+	Fields map[string]string `bson:"fields,omitempty"`
+	// Deleted is when the delete of the document was handled. Keys of deleted documents expire keyRetention later.
+	Deleted *time.Time `bson:"deleted,omitempty"`
+}
+
+// newUserKey returns the key of the user document doc.
+func (ss *Mongo) newUserKey(doc bson.Raw) userKey {
+	var user struct {
+		ID           string `bson:"id"`
+		BusinessUnit int    `bson:"businessUnit"`
+		Version      int64  `bson:"version"`
+	}
+	// documents other applications wrote may not decode, their key then only holds digests
+	bson.Unmarshal(doc, &user)
+	key := userKey{UserID: user.ID, BusinessUnit: user.BusinessUnit, Version: user.Version,
+		Fields: make(map[string]string)}
+	if ss.FieldDigest == nil {
+		return key
+	}
+	elements, _ := doc.Elements()
+	for _, e := range elements {
+		// every write bumps the version, which tells nothing of what changed
+		if _, ok := fieldPointers[e.Key()]; !ok || e.Key() == "version" {
+			continue
+		}
+		value := e.Value()
+		key.Fields[e.Key()] = ss.FieldDigest(e.Key(), string(append([]byte{byte(value.Type)}, value.Value...)))
+	}
+	return key
+}
+
+// changedFields returns the sorted json pointers of the user fields whose digests differ between before and after.
+func changedFields(before, after map[string]string) []string {
+	names := make([]string, 0)
+	for name, digest := range after {
+		if before[name] != digest {
+			names = append(names, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	return userFields(names)
+}
+
+// userKey returns the key kept under id, known telling whether there is one.
+func (ss *Mongo) userKey(id bson.RawValue, ctx context.Context) (key userKey, known bool, err error) {
+	err = ss.Database.Collection(ss.WatchKeyCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&key)
+	if err == driver.ErrNoDocuments {
+		return key, false, nil
+	}
+	return key, err == nil, err
+}
+
+// keepKey keeps key under id.
+func (ss *Mongo) keepKey(id bson.RawValue, key userKey, ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.WatchKeyCollection).ReplaceOne(ctx, bson.M{"_id": id}, key,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+// forgetKey marks the key kept under id deleted, dropping the digests of its fields.
+func (ss *Mongo) forgetKey(id bson.RawValue, ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.WatchKeyCollection).UpdateOne(ctx, bson.M{"_id": id},
+		bson.M{"$set": bson.M{"deleted": time.Now().UTC()}, "$unset": bson.M{"fields": ""}})
+	return err
+}
+
+// fillKeys keeps the key of every user document when the watch key collection is empty, as it is the first time
+// the watcher runs.
+func (ss *Mongo) fillKeys(ctx context.Context) error {
+	keys := ss.Database.Collection(ss.WatchKeyCollection)
+	count, err := keys.CountDocuments(ctx, bson.M{}, options.Count().SetLimit(1))
+	if err != nil || count > 0 {
+		return err
+	}
+	cursor, err := ss.Database.Collection(ss.Collection).Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	const batchSize = 1000
+	batch := make([]driver.WriteModel, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := keys.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		batch = batch[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		id := cursor.Current.Lookup("_id")
+		batch = append(batch, driver.NewReplaceOneModel().SetFilter(bson.M{"_id": id}).
+			SetReplacement(ss.newUserKey(cursor.Current)).SetUpsert(true))
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// EnsureWatchIndexes creates the indexes the keys of the watcher are erased and expired with.
+func (ss *Mongo) EnsureWatchIndexes(ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.WatchKeyCollection).Indexes().CreateMany(ctx, []driver.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "deleted", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(keyRetention / time.Second))},
+	})
+	return err
+}
+
+// topLevel returns the names of the fields of doc.
+func topLevel(doc bson.Raw) []string {
+	elements, _ := doc.Elements()
+	names := make([]string, len(elements))
+	for i, e := range elements {
+		names[i] = e.Key()
+	}
+	return names
+}
+
+// fieldPointers maps the bson names of the fields of model.User to their json pointers. Fields that are not part of
+// the user document, such as the password hash, have none.
+var fieldPointers = func() map[string]string {
+	pointers := make(map[string]string)
+	t := reflect.TypeOf(model.User{})
+	for i := 0; i < t.NumField(); i++ {
+		bsonName := strings.Split(t.Field(i).Tag.Get("bson"), ",")[0]
+		jsonName := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if bsonName != "" && bsonName != "-" && jsonName != "" && jsonName != "-" {
+			pointers[bsonName] = "/" + jsonName
+		}
+	}
+	return pointers
+}()
+
+// userFields returns the sorted json pointers of the user fields the bson paths names lead into.
+func userFields(names []string) []string {
+	seen := make(map[string]bool)
+	fields := make([]string, 0, len(names))
+	for _, name := range names {
+		pointer, ok := fieldPointers[strings.SplitN(name, ".", 2)[0]]
+		if ok && !seen[pointer] {
+			seen[pointer] = true
+			fields = append(fields, pointer)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// resumeToken returns the resume token saved by the watcher called name, nil when there is none.
+func (ss *Mongo) resumeToken(name string, ctx context.Context) (bson.Raw, error) {
+	var saved struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := ss.Database.Collection(ss.WatchCollection).FindOne(ctx, bson.M{"_id": name}).Decode(&saved)
+	if err == driver.ErrNoDocuments {
+		return nil, nil
+	}
+	return saved.Token, err
+}
+
+// saveResumeToken saves token as the resume token of the watcher called name.
+func (ss *Mongo) saveResumeToken(name string, token bson.Raw, ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.WatchCollection).UpdateOne(ctx, bson.M{"_id": name},
+		bson.M{"$set": bson.M{"token": token, "updated": time.Now().UTC()}}, options.Update().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,77 @@
+package mongo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	"user-details/pkg/encryption"
+	"user-details/pkg/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestReplacedFields(t *testing.T) {
+	stored := model.User{ID: "u1", FirstName: "Ada", LastName: "Lovelace", BusinessUnit: 7, PasswordHash: "$h1",
+		Version: 3}
+
+	tests := []struct {
+		name   string
+		change func(u *model.User)
+		want   []string
+	}{
+		{"nothing but the version", func(u *model.User) {}, []string{}},
+		{"password and lockout", func(u *model.User) { u.PasswordHash, u.FailedLogins = "$h2", 2 }, []string{}},
+		{"first name", func(u *model.User) { u.FirstName = "Augusta" }, []string{"/firstName"}},
+		{"removed last name", func(u *model.User) { u.LastName = "" }, []string{"/lastName"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replaced := stored
+			replaced.Version++
+			tt.change(&replaced)
+			before, after := key(t, stored), key(t, replaced)
+			if after.UserID != "u1" || after.BusinessUnit != 7 || after.Version != 4 {
+				t.Errorf("key names user %q of unit %d at version %d", after.UserID, after.BusinessUnit, after.Version)
+			}
+			if got := changedFields(before.Fields, after.Fields); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replace changed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// key returns the key of the document user is stored as.
+func key(t *testing.T, user model.User) userKey {
+	t.Helper()
+	doc, err := bson.Marshal(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := encryption.New(encryption.Config{ActiveKey: "k1",
+		Keys:     []encryption.Key{{ID: "k1", Secret: strings.Repeat("k", 32)}},
+		IndexKey: encryption.Key{ID: "index", Secret: strings.Repeat("i", 32)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return (&Mongo{FieldDigest: cipher.BlindIndex}).newUserKey(doc)
+}
+
+func TestUserKeysHoldNoPlainDigests(t *testing.T) {
+	user := model.User{ID: "u1", FirstName: "Ada", EmailID: "ada@example.com", Version: 1}
+	doc, err := bson.Marshal(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := bson.Raw(doc).Lookup("emailId")
+	plain := sha256.Sum256(append([]byte{byte(value.Type)}, value.Value...))
+
+	keyed := key(t, user)
+	if digest := keyed.Fields["emailId"]; digest == "" || digest == hex.EncodeToString(plain[:]) {
+		t.Errorf("email digest is %q, want one keyed with the index key", digest)
+	}
+	if unkeyed := (&Mongo{}).newUserKey(bson.Raw(doc)); len(unkeyed.Fields) != 0 || unkeyed.UserID != "u1" {
+		t.Errorf("key without digest function is %+v, want the user id and no fields", unkeyed)
+	}
+}
@@ -0,0 +1,131 @@
+package mongo
+
+import (
+	"context"
+	"time"
+	"user-details/pkg/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SaveWebhook stores webhook in place of the webhook stored under the same id, if any.
+func (ss *Mongo) SaveWebhook(webhook model.Webhook, ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.WebhookCollection).ReplaceOne(ctx, bson.M{"id": webhook.ID}, webhook,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+// Webhook returns the webhook stored under webhookId.
+func (ss *Mongo) Webhook(webhookId string, ctx context.Context) (model.Webhook, error) {
+	var webhook model.Webhook
+	err := ss.Database.Collection(ss.WebhookCollection).FindOne(ctx, bson.M{"id": webhookId}).Decode(&webhook)
+	if err == driver.ErrNoDocuments {
+		return webhook, model.ErrWebhookNotFound
+	}
+	return webhook, err
+}
+
+// Webhooks returns every webhook, by id.
+func (ss *Mongo) Webhooks(ctx context.Context) ([]model.Webhook, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "id", Value: 1}})
+	cursor, err := ss.Database.Collection(ss.WebhookCollection).Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	webhooks := make([]model.Webhook, 0)
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes the webhook stored under webhookId along with its deliveries.
+func (ss *Mongo) DeleteWebhook(webhookId string, ctx context.Context) error {
+	result, err := ss.Database.Collection(ss.WebhookCollection).DeleteOne(ctx, bson.M{"id": webhookId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return model.ErrWebhookNotFound
+	}
+	_, err = ss.Database.Collection(ss.DeliveryCollection).DeleteMany(ctx, bson.M{"webhookId": webhookId})
+	return err
+}
+
+// AddDelivery stores delivery unless a delivery is stored under its id already.
+func (ss *Mongo) AddDelivery(delivery model.Delivery, ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.DeliveryCollection).UpdateOne(ctx, bson.M{"id": delivery.ID},
+		bson.M{"$setOnInsert": delivery}, options.Update().SetUpsert(true))
+	return err
+}
+
+// SaveDelivery stores delivery in place of the delivery stored under the same id.
+func (ss *Mongo) SaveDelivery(delivery model.Delivery, ctx context.Context) error {
+	result, err := ss.Database.Collection(ss.DeliveryCollection).ReplaceOne(ctx, bson.M{"id": delivery.ID}, delivery)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return model.ErrDeliveryNotFound
+	}
+	return nil
+}
+
+// Delivery returns the delivery of webhookId stored under deliveryId.
+func (ss *Mongo) Delivery(webhookId, deliveryId string, ctx context.Context) (model.Delivery, error) {
+	var delivery model.Delivery
+	filter := bson.M{"id": deliveryId, "webhookId": webhookId}
+	err := ss.Database.Collection(ss.DeliveryCollection).FindOne(ctx, filter).Decode(&delivery)
+	if err == driver.ErrNoDocuments {
+		return delivery, model.ErrDeliveryNotFound
+	}
+	return delivery, err
+}
+
+// Deliveries returns up to limit deliveries of webhookId in status, or in any status when it is empty, newest first.
+func (ss *Mongo) Deliveries(webhookId, status string, limit int, ctx context.Context) ([]model.Delivery, error) {
+	filter := bson.M{"webhookId": webhookId}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created", Value: -1}, {Key: "id", Value: -1}}).SetLimit(int64(limit))
+	return ss.findDeliveries(filter, opts, ctx)
+}
+
+// DueDeliveries returns up to limit pending deliveries whose next attempt is due at now, earliest first.
+func (ss *Mongo) DueDeliveries(now time.Time, limit int, ctx context.Context) ([]model.Delivery, error) {
+	filter := bson.M{"status": model.DeliveryPending, "nextAttempt": bson.M{"$lte": now}}
+	opts := options.Find().SetSort(bson.D{{Key: "nextAttempt", Value: 1}}).SetLimit(int64(limit))
+	return ss.findDeliveries(filter, opts, ctx)
+}
+
+func (ss *Mongo) findDeliveries(filter bson.M, opts *options.FindOptions, ctx context.Context) ([]model.Delivery, error) {
+	cursor, err := ss.Database.Collection(ss.DeliveryCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]model.Delivery, 0)
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// EnsureWebhookIndexes creates the indexes webhooks and their deliveries are read and erased with.
+func (ss *Mongo) EnsureWebhookIndexes(ctx context.Context) error {
+	_, err := ss.Database.Collection(ss.WebhookCollection).Indexes().CreateOne(ctx, driver.IndexModel{
+		Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = ss.Database.Collection(ss.DeliveryCollection).Indexes().CreateMany(ctx, []driver.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "webhookId", Value: 1}, {Key: "created", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttempt", Value: 1}}},
+		{Keys: bson.D{{Key: "event.userId", Value: 1}}},
+	})
+	return err
+}
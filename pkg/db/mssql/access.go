@@ -0,0 +1,69 @@
+package mssql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"user-details/pkg/model"
+)
+
+const accessColumns = "id, userId, operation, timestamp, actorName, actorRoles, requestId"
+
+// LogAccesses stores accesses in the access table in one statement. Roles are stored as JSON text.
+func (ss *Mssql) LogAccesses(accesses []model.Access, ctx context.Context) error {
+	if len(accesses) == 0 {
+		return nil
+	}
+	rows := make([]string, len(accesses))
+	args := make([]interface{}, 0, 7*len(accesses))
+	for i, access := range accesses {
+		roles, err := json.Marshal(access.Actor.Roles)
+		if err != nil {
+			return err
+		}
+		rows[i] = fmt.Sprintf("(@id%[1]d, @userId%[1]d, @operation%[1]d, @timestamp%[1]d, @actorName%[1]d, "+
+			"@actorRoles%[1]d, @requestId%[1]d)", i)
+		args = append(args,
+			dbsql.Named(fmt.Sprint("id", i), access.ID),
+			dbsql.Named(fmt.Sprint("userId", i), access.UserID),
+			dbsql.Named(fmt.Sprint("operation", i), access.Operation),
+			dbsql.Named(fmt.Sprint("timestamp", i), access.Timestamp),
+			dbsql.Named(fmt.Sprint("actorName", i), access.Actor.AccountName),
+			dbsql.Named(fmt.Sprint("actorRoles", i), string(roles)),
+			dbsql.Named(fmt.Sprint("requestId", i), access.RequestID),
+		)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", quote(ss.AccessTable), accessColumns,
+		strings.Join(rows, ", "))
+	_, err := ss.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Accesses returns the accesses of userId, oldest first.
+func (ss *Mssql) Accesses(userId string, ctx context.Context) ([]model.Access, error) {
+	statement := fmt.Sprintf("SELECT %s FROM %s WHERE userId = @userId ORDER BY id", accessColumns,
+		quote(ss.AccessTable))
+	rows, err := ss.QueryContext(ctx, statement, dbsql.Named("userId", userId))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accesses := make([]model.Access, 0)
+	for rows.Next() {
+		var access model.Access
+		var roles string
+		err := rows.Scan(&access.ID, &access.UserID, &access.Operation, &access.Timestamp, &access.Actor.AccountName,
+			&roles, &access.RequestID)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(roles), &access.Actor.Roles); err != nil {
+			return nil, err
+		}
+		accesses = append(accesses, access)
+	}
+	return accesses, rows.Err()
+}
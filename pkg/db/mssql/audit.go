@@ -0,0 +1,88 @@
+package mssql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"fmt"
+	"user-details/pkg/model"
+)
+
+const auditColumns = "id, userId, operation, actorName, actorRoles, requestId, timestamp, version, changes, tokens"
+
+// Append stores record in the audit table. Roles, changes and tokens are stored as JSON text.
+func (ss *Mssql) Append(record model.AuditRecord, ctx context.Context) error {
+	roles, err := json.Marshal(record.Actor.Roles)
+	if err != nil {
+		return err
+	}
+	changes, err := json.Marshal(record.Changes)
+	if err != nil {
+		return err
+	}
+	tokens := dbsql.NullString{}
+	if len(record.Tokens) > 0 {
+		body, err := json.Marshal(record.Tokens)
+		if err != nil {
+			return err
+		}
+		tokens = dbsql.NullString{String: string(body), Valid: true}
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (@id, @userId, @operation, @actorName, @actorRoles, @requestId,
+	@timestamp, @version, @changes, @tokens)`, quote(ss.AuditTable), auditColumns)
+	_, err = ss.conn(ctx).ExecContext(ctx, query,
+		dbsql.Named("id", record.ID),
+		dbsql.Named("userId", record.UserID),
+		dbsql.Named("operation", record.Operation),
+		dbsql.Named("actorName", record.Actor.AccountName),
+		dbsql.Named("actorRoles", string(roles)),
+		dbsql.Named("requestId", record.RequestID),
+		dbsql.Named("timestamp", record.Timestamp),
+		dbsql.Named("version", record.Version),
+		dbsql.Named("changes", string(changes)),
+		dbsql.Named("tokens", tokens),
+	)
+	return err
+}
+
+// History returns up to query.Limit records of query.UserID older than query.Before, newest first.
+func (ss *Mssql) History(query model.HistoryQuery, ctx context.Context) ([]model.AuditRecord, error) {
+	condition := "userId = @userId"
+	args := []interface{}{dbsql.Named("limit", query.Limit), dbsql.Named("userId", query.UserID)}
+	if query.Before != "" {
+		condition += " AND id < @before"
+		args = append(args, dbsql.Named("before", query.Before))
+	}
+	statement := fmt.Sprintf("SELECT TOP (@limit) %s FROM %s WHERE %s ORDER BY id DESC",
+		auditColumns, quote(ss.AuditTable), condition)
+	rows, err := ss.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]model.AuditRecord, 0)
+	for rows.Next() {
+		var record model.AuditRecord
+		var roles, changes string
+		var tokens dbsql.NullString
+		err := rows.Scan(&record.ID, &record.UserID, &record.Operation, &record.Actor.AccountName, &roles,
+			&record.RequestID, &record.Timestamp, &record.Version, &changes, &tokens)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(roles), &record.Actor.Roles); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &record.Changes); err != nil {
+			return nil, err
+		}
+		if tokens.Valid {
+			if err := json.Unmarshal([]byte(tokens.String), &record.Tokens); err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,69 @@
+package mssql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"fmt"
+	"user-details/pkg/model"
+)
+
+const consentColumns = "id, userId, purpose, action, source, policyVersion, timestamp, actorName, actorRoles, requestId"
+
+// Record stores consent in the consent table. Roles are stored as JSON text.
+func (ss *Mssql) Record(consent model.Consent, ctx context.Context) error {
+	roles, err := json.Marshal(consent.Actor.Roles)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (@id, @userId, @purpose, @action, @source, @policyVersion,
+	@timestamp, @actorName, @actorRoles, @requestId)`, quote(ss.ConsentTable), consentColumns)
+	_, err = ss.conn(ctx).ExecContext(ctx, query,
+		dbsql.Named("id", consent.ID),
+		dbsql.Named("userId", consent.UserID),
+		dbsql.Named("purpose", consent.Purpose),
+		dbsql.Named("action", consent.Action),
+		dbsql.Named("source", consent.Source),
+		dbsql.Named("policyVersion", consent.PolicyVersion),
+		dbsql.Named("timestamp", consent.Timestamp),
+		dbsql.Named("actorName", consent.Actor.AccountName),
+		dbsql.Named("actorRoles", string(roles)),
+		dbsql.Named("requestId", consent.RequestID),
+	)
+	return err
+}
+
+// MoveConsents hands the consents of fromUserId over to toUserId.
+func (ss *Mssql) MoveConsents(fromUserId, toUserId string, ctx context.Context) error {
+	query := fmt.Sprintf("UPDATE %s SET userId = @toUserId WHERE userId = @fromUserId", quote(ss.ConsentTable))
+	_, err := ss.conn(ctx).ExecContext(ctx, query, dbsql.Named("toUserId", toUserId),
+		dbsql.Named("fromUserId", fromUserId))
+	return err
+}
+
+// Consents returns the consents of userId, oldest first.
+func (ss *Mssql) Consents(userId string, ctx context.Context) ([]model.Consent, error) {
+	statement := fmt.Sprintf("SELECT %s FROM %s WHERE userId = @userId ORDER BY id", consentColumns,
+		quote(ss.ConsentTable))
+	rows, err := ss.QueryContext(ctx, statement, dbsql.Named("userId", userId))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	consents := make([]model.Consent, 0)
+	for rows.Next() {
+		var consent model.Consent
+		var roles string
+		err := rows.Scan(&consent.ID, &consent.UserID, &consent.Purpose, &consent.Action, &consent.Source,
+			&consent.PolicyVersion, &consent.Timestamp, &consent.Actor.AccountName, &roles, &consent.RequestID)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(roles), &consent.Actor.Roles); err != nil {
+			return nil, err
+		}
+		consents = append(consents, consent)
+	}
+	return consents, rows.Err()
+}
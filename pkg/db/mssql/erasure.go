@@ -0,0 +1,115 @@
+package mssql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"fmt"
+	"user-details/pkg/model"
+)
+
+// Erase deletes the user stored under userId, its snapshots, its consents, its accesses, the redirects from and to it
+// and the deliveries of its events, and removes the values from the changes of its audit records and the business
+// unit, fields and request id from its events, all in one transaction: the transaction of Transact when called within
+// it, its own otherwise.
+func (ss *Mssql) Erase(userId string, ctx context.Context) ([]model.ErasureStep, error) {
+	tx, joined := ctx.Value(txKey{}).(*dbsql.Tx)
+	if !joined {
+		var err error
+		if tx, err = ss.BeginTx(ctx, nil); err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+	}
+
+	id := dbsql.Named("userId", userId)
+	const deleteOwned = "DELETE FROM %s WHERE userId = @userId"
+	steps := make([]model.ErasureStep, 0, 8)
+	for _, s := range []struct {
+		target, action, statement string
+	}{
+		{ss.Table, model.ErasureDeleted, fmt.Sprintf("DELETE FROM %s WHERE id = @userId", ss.table())},
+		{ss.SnapshotTable, model.ErasureDeleted, fmt.Sprintf(deleteOwned, quote(ss.SnapshotTable))},
+		{ss.ConsentTable, model.ErasureDeleted, fmt.Sprintf(deleteOwned, quote(ss.ConsentTable))},
+		{ss.AccessTable, model.ErasureDeleted, fmt.Sprintf(deleteOwned, quote(ss.AccessTable))},
+		{ss.MergeTable, model.ErasureDeleted,
+			fmt.Sprintf("DELETE FROM %s WHERE id = @userId OR survivorId = @userId", quote(ss.MergeTable))},
+		// events are stored as JSON text
+		{ss.DeliveryTable, model.ErasureDeleted,
+			fmt.Sprintf("DELETE FROM %s WHERE JSON_VALUE(event, '$.userId') = @userId", quote(ss.DeliveryTable))},
+		// events keep their sequence, which streams resume from
+		{ss.OutboxTable, model.ErasureAnonymized, fmt.Sprintf(`UPDATE %s SET businessUnit = 0, fields = '[]', requestId = ''
+WHERE userId = @userId AND (businessUnit <> 0 OR fields <> '[]' OR requestId <> '')`, quote(ss.OutboxTable))},
+	} {
+		result, err := tx.ExecContext(ctx, s.statement, id)
+		if err != nil {
+			return nil, err
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, model.ErasureStep{Store: "mssql", Target: s.target, Action: s.action, Count: count})
+	}
+	records, err := anonymizeRecords(ctx, tx, quote(ss.AuditTable), id)
+	if err != nil {
+		return nil, err
+	}
+	steps = append(steps, model.ErasureStep{Store: "mssql", Target: ss.AuditTable, Action: model.ErasureAnonymized,
+		Count: records})
+	if !joined {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	return steps, nil
+}
+
+// anonymizeRecords removes the values from the changes of the audit records of the @userId parameter. Changes are
+// JSON text, so they are rewritten one record at a time.
+func anonymizeRecords(ctx context.Context, tx *dbsql.Tx, table string, id dbsql.NamedArg) (int64, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id, changes FROM %s WHERE userId = @userId", table), id)
+	if err != nil {
+		return 0, err
+	}
+	anonymized := make(map[string]string)
+	for rows.Next() {
+		var recordId, body string
+		if err := rows.Scan(&recordId, &body); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		var changes []model.Change
+		if err := json.Unmarshal([]byte(body), &changes); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		valued := false
+		for i := range changes {
+			valued = valued || changes[i].Before != nil || changes[i].After != nil
+			changes[i].Before, changes[i].After = nil, nil
+		}
+		if !valued {
+			continue
+		}
+		stripped, err := json.Marshal(changes)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		anonymized[recordId] = string(stripped)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for recordId, changes := range anonymized {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET changes = @changes WHERE id = @id", table),
+			dbsql.Named("changes", changes), dbsql.Named("id", recordId))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(anonymized)), nil
+}
@@ -0,0 +1,50 @@
+package mssql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"fmt"
+	"user-details/pkg/model"
+)
+
+const mergeColumns = "id, survivorId, timestamp, actorName, actorRoles, requestId"
+
+// AddRedirect stores redirect in the merge table. Roles are stored as JSON text.
+func (ss *Mssql) AddRedirect(redirect model.Redirect, ctx context.Context) error {
+	roles, err := json.Marshal(redirect.Actor.Roles)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (@id, @survivorId, @timestamp, @actorName, @actorRoles, @requestId)",
+		quote(ss.MergeTable), mergeColumns)
+	_, err = ss.conn(ctx).ExecContext(ctx, query,
+		dbsql.Named("id", redirect.ID),
+		dbsql.Named("survivorId", redirect.SurvivorID),
+		dbsql.Named("timestamp", redirect.Timestamp),
+		dbsql.Named("actorName", redirect.Actor.AccountName),
+		dbsql.Named("actorRoles", string(roles)),
+		dbsql.Named("requestId", redirect.RequestID),
+	)
+	return err
+}
+
+// Redirect returns the latest redirect of userId.
+func (ss *Mssql) Redirect(userId string, ctx context.Context) (model.Redirect, error) {
+	var redirect model.Redirect
+	var roles string
+	query := fmt.Sprintf("SELECT TOP (1) %s FROM %s WHERE id = @id ORDER BY timestamp DESC", mergeColumns,
+		quote(ss.MergeTable))
+	err := ss.QueryRowContext(ctx, query, dbsql.Named("id", userId)).Scan(&redirect.ID, &redirect.SurvivorID,
+		&redirect.Timestamp, &redirect.Actor.AccountName, &roles, &redirect.RequestID)
+	if err == dbsql.ErrNoRows {
+		return redirect, model.ErrUserNotFound
+	}
+	if err != nil {
+		return redirect, err
+	}
+	if err := json.Unmarshal([]byte(roles), &redirect.Actor.Roles); err != nil {
+		return redirect, err
+	}
+	return redirect, nil
+}
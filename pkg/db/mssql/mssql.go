@@ -1,10 +1,358 @@
 package mssql
 
 import (
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"user-details/pkg/model"
+
 	"vendor.lib/tng/tng-lib/db/sql"
 )
 
-// Mssql ...
+const userColumns = "id, firstName, lastName, userName, emailId, canonicalEmail, canonicalUserName, emailIndex, emailPrefixes, " +
+	"passwordHash, contact, phones, emails, addresses, businessUnit, failedLogins, lockedUntil, version"
+
+// phoneCondition matches users having the @phone parameter among their phone numbers, which are longer than phone
+// numbers once encrypted.
+const phoneCondition = "EXISTS (SELECT 1 FROM OPENJSON(phones) WITH (number nvarchar(max) '$.number') WHERE number = @phone)"
+
+// phonesCondition matches users having one of the numbers of the parameters named in %s among their phone numbers.
+const phonesCondition = "EXISTS (SELECT 1 FROM OPENJSON(phones) WITH (number nvarchar(max) '$.number') WHERE number IN (%s))"
+
+// emailPrefixCondition matches users having the @emailPrefixIndex parameter among the blind indexes of their email
+// prefixes.
+const emailPrefixCondition = "EXISTS (SELECT 1 FROM OPENJSON(emailPrefixes) WHERE value = @emailPrefixIndex)"
+
+// likeEscaper escapes the LIKE wildcards of a value using backslash as the escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "[", `\[`)
+
+// Mssql represents the sql connection and the tables users, their audit trail, their earlier versions, their consents,
+// the reads of users, the redirects of merged users, the outbox of their change events and the webhooks the events are delivered to are
+// stored in.
 type Mssql struct {
 	sql.Sql
-}
\ No newline at end of file
+	Table         string
+	AuditTable    string
+	SnapshotTable string
+	ConsentTable  string
+	AccessTable   string
+	MergeTable    string
+	OutboxTable   string
+	WebhookTable  string
+	DeliveryTable string
+}
+
+// Get returns the user stored under userId.
+func (ss *Mssql) Get(userId string, ctx context.Context) (model.User, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id = @id", userColumns, ss.table())
+	user, err := scanUser(ss.conn(ctx).QueryRowContext(ctx, query, dbsql.Named("id", userId)))
+	if err == dbsql.ErrNoRows {
+		return user, model.ErrUserNotFound
+	}
+	if err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+// Upsert stores user as version+1 when the user stored under user.ID is at version, 0 meaning it may not exist yet.
+func (ss *Mssql) Upsert(user model.User, version int64, ctx context.Context) (model.User, error) {
+	// contacts are stored as JSON text, phones are queried with OPENJSON
+	phones, err := json.Marshal(user.Phones)
+	if err != nil {
+		return user, err
+	}
+	emails, err := json.Marshal(user.Emails)
+	if err != nil {
+		return user, err
+	}
+	addresses, err := json.Marshal(user.Addresses)
+	if err != nil {
+		return user, err
+	}
+	var emailPrefixes []byte
+	if len(user.EmailPrefixes) > 0 {
+		if emailPrefixes, err = json.Marshal(user.EmailPrefixes); err != nil {
+			return user, err
+		}
+	}
+
+	user.Version = version + 1
+	query := fmt.Sprintf(`MERGE %s WITH (HOLDLOCK) AS t
+USING (SELECT @id AS id) AS s ON t.id = s.id
+WHEN MATCHED AND t.version = @expected THEN
+	UPDATE SET firstName = @firstName, lastName = @lastName, userName = @userName, emailId = @emailId,
+		canonicalEmail = @canonicalEmail, canonicalUserName = @canonicalUserName, emailIndex = @emailIndex,
+		emailPrefixes = @emailPrefixes, passwordHash = @passwordHash, contact = @contact, phones = @phones, emails = @emails, addresses = @addresses,
+		businessUnit = @businessUnit, failedLogins = @failedLogins, lockedUntil = @lockedUntil, version = @version
+WHEN NOT MATCHED AND @expected = 0 THEN
+	INSERT (%s) VALUES (@id, @firstName, @lastName, @userName, @emailId, @canonicalEmail, @canonicalUserName,
+		@emailIndex, @emailPrefixes, @passwordHash, @contact, @phones, @emails, @addresses, @businessUnit, @failedLogins, @lockedUntil, @version);`,
+		ss.table(), userColumns)
+	result, err := ss.conn(ctx).ExecContext(ctx, query,
+		dbsql.Named("id", user.ID),
+		dbsql.Named("firstName", user.FirstName),
+		dbsql.Named("lastName", user.LastName),
+		dbsql.Named("userName", user.UserName),
+		dbsql.Named("emailId", user.EmailID),
+		dbsql.Named("canonicalEmail", user.CanonicalEmail),
+		dbsql.Named("canonicalUserName", user.CanonicalUserName),
+		dbsql.Named("emailIndex", user.EmailIndex),
+		dbsql.Named("emailPrefixes", string(emailPrefixes)),
+		dbsql.Named("passwordHash", user.PasswordHash),
+		dbsql.Named("contact", user.LegacyContact),
+		dbsql.Named("phones", string(phones)),
+		dbsql.Named("emails", string(emails)),
+		dbsql.Named("addresses", string(addresses)),
+		dbsql.Named("failedLogins", user.FailedLogins),
+		dbsql.Named("businessUnit", user.BusinessUnit),
+		dbsql.Named("lockedUntil", user.LockedUntil),
+		dbsql.Named("version", user.Version),
+		dbsql.Named("expected", version),
+	)
+	if field, ok := ss.duplicateKey(err); ok {
+		return user, model.DuplicateError{Field: field}
+	}
+	if err != nil {
+		return user, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return user, err
+	}
+	if affected == 0 {
+		return user, model.ErrVersionConflict
+	}
+	return user, nil
+}
+
+// Delete removes the user stored under userId when it is at version.
+func (ss *Mssql) Delete(userId string, version int64, ctx context.Context) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = @id AND version = @version", ss.table())
+	result, err := ss.conn(ctx).ExecContext(ctx, query, dbsql.Named("id", userId), dbsql.Named("version", version))
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		if _, err := ss.Get(userId, ctx); err != nil {
+			return err
+		}
+		return model.ErrVersionConflict
+	}
+	return nil
+}
+
+// List returns up to query.Limit users matching query, ordered by query.Sort then id.
+func (ss *Mssql) List(query model.UserQuery, ctx context.Context) ([]model.User, error) {
+	conditions := []string{"1 = 1"}
+	args := []interface{}{dbsql.Named("limit", query.Limit)}
+	for _, f := range []struct{ column, value string }{
+		{"lastName", query.LastName},
+		{"userName", query.UserName},
+	} {
+		if f.value != "" {
+			conditions = append(conditions, fmt.Sprintf("%s = @%s", f.column, f.column))
+			args = append(args, dbsql.Named(f.column, f.value))
+		}
+	}
+	if query.Phone != "" {
+		conditions = append(conditions, phoneCondition)
+		args = append(args, dbsql.Named("phone", query.Phone))
+	}
+	if len(query.LastNames) > 0 {
+		names, values := parameters("lastName", query.LastNames)
+		conditions = append(conditions, fmt.Sprintf("lastName IN (%s)", names))
+		args = append(args, values...)
+	}
+	if len(query.Phones) > 0 {
+		names, values := parameters("phone", query.Phones)
+		conditions = append(conditions, fmt.Sprintf(phonesCondition, names))
+		args = append(args, values...)
+	}
+	if query.EmailPrefix != "" {
+		conditions = append(conditions, `emailId LIKE @emailPrefix ESCAPE '\'`)
+		args = append(args, dbsql.Named("emailPrefix", likeEscaper.Replace(query.EmailPrefix)+"%"))
+	}
+	if query.EmailPrefixIndex != "" {
+		conditions = append(conditions, emailPrefixCondition)
+		args = append(args, dbsql.Named("emailPrefixIndex", query.EmailPrefixIndex))
+	}
+
+	// sort is one of model.SortFields, which are valid column names
+	sort, order, after := query.Sort, "ASC", ">"
+	if query.Descending {
+		order, after = "DESC", "<"
+	}
+	if query.After != nil {
+		args = append(args, dbsql.Named("afterId", query.After.ID))
+		if sort == "id" {
+			conditions = append(conditions, fmt.Sprintf("id %s @afterId", after))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s @afterValue OR (%[1]s = @afterValue AND id %[2]s @afterId))", sort, after))
+			args = append(args, dbsql.Named("afterValue", query.After.Value))
+		}
+	}
+
+	orderBy := "id " + order
+	if sort != "id" {
+		orderBy = fmt.Sprintf("%s %s, %s", sort, order, orderBy)
+	}
+	statement := fmt.Sprintf("SELECT TOP (@limit) %s FROM %s WHERE %s ORDER BY %s",
+		userColumns, ss.table(), strings.Join(conditions, " AND "), orderBy)
+	return ss.query(ctx, statement, args...)
+}
+
+// parameters returns the list of the parameters named after prefix that hold values, along with their arguments.
+func parameters(prefix string, values []string) (string, []interface{}) {
+	names := make([]string, len(values))
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		names[i] = fmt.Sprintf("@%s%d", prefix, i)
+		args[i] = dbsql.Named(fmt.Sprintf("%s%d", prefix, i), value)
+	}
+	return strings.Join(names, ", "), args
+}
+
+// Search returns every user matching all non-empty fields of filter.
+func (ss *Mssql) Search(filter model.UserFilter, ctx context.Context) ([]model.User, error) {
+	conditions := []string{"1 = 1"}
+	args := make([]interface{}, 0)
+	for _, f := range []struct{ column, value string }{
+		{"firstName", filter.FirstName},
+		{"lastName", filter.LastName},
+		{"userName", filter.UserName},
+		{"emailId", filter.EmailID},
+		{"canonicalEmail", filter.CanonicalEmail},
+		{"canonicalUserName", filter.CanonicalUserName},
+	} {
+		if f.value != "" {
+			conditions = append(conditions, fmt.Sprintf("%s = @%s", f.column, f.column))
+			args = append(args, dbsql.Named(f.column, f.value))
+		}
+	}
+	if filter.Phone != "" {
+		conditions = append(conditions, phoneCondition)
+		args = append(args, dbsql.Named("phone", filter.Phone))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY id",
+		userColumns, ss.table(), strings.Join(conditions, " AND "))
+	return ss.query(ctx, query, args...)
+}
+
+func (ss *Mssql) query(ctx context.Context, query string, args ...interface{}) ([]model.User, error) {
+	rows, err := ss.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]model.User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// EnsureIndexes creates the unique indexes of model.UniqueFields and model.BlindIndexes when they are missing.
+// Uniqueness is case insensitive as long as the columns use a case insensitive collation, which is the SQL Server
+// default.
+func (ss *Mssql) EnsureIndexes(ctx context.Context) error {
+	fields := append([]string{}, model.UniqueFields...)
+	for blindIndex := range model.BlindIndexes {
+		fields = append(fields, blindIndex)
+	}
+	for _, field := range fields {
+		// users stored before the field was required, or before encryption was enabled, may have it empty
+		query := fmt.Sprintf(`IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = @name AND object_id = OBJECT_ID(@table))
+	CREATE UNIQUE INDEX %s ON %s (%s) WHERE %s <> ''`,
+			quote(ss.uniqueIndex(field)), ss.table(), field, field)
+		_, err := ss.ExecContext(ctx, query, dbsql.Named("name", ss.uniqueIndex(field)), dbsql.Named("table", ss.table()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueIndex names the unique index of field.
+func (ss *Mssql) uniqueIndex(field string) string {
+	return fmt.Sprintf("UX_%s_%s", ss.Table, field)
+}
+
+// duplicateKey reports whether err violates the unique index of one of model.UniqueFields, returning that field.
+func (ss *Mssql) duplicateKey(err error) (string, bool) {
+	e, ok := err.(interface {
+		SQLErrorNumber() int32
+		SQLErrorMessage() string
+	})
+	// 2601 and 2627 report duplicate keys in unique indexes and unique constraints
+	if !ok || (e.SQLErrorNumber() != 2601 && e.SQLErrorNumber() != 2627) {
+		return "", false
+	}
+	for _, field := range model.UniqueFields {
+		if strings.Contains(e.SQLErrorMessage(), "'"+ss.uniqueIndex(field)+"'") {
+			return field, true
+		}
+	}
+	for blindIndex, field := range model.BlindIndexes {
+		if strings.Contains(e.SQLErrorMessage(), "'"+ss.uniqueIndex(blindIndex)+"'") {
+			return field, true
+		}
+	}
+	return "", false
+}
+
+// table quotes the configured table name so it can be used as an identifier.
+func (ss *Mssql) table() string {
+	return quote(ss.Table)
+}
+
+// quote delimits name so it can be used as an identifier.
+func quote(name string) string {
+	return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner) (model.User, error) {
+	var user model.User
+	// rows stored before contacts were structured have no phones, emails and addresses
+	var phones, emails, addresses dbsql.NullString
+	var businessUnit dbsql.NullInt64
+	// rows stored before encryption was enabled have no blind indexes
+	var emailIndex, emailPrefixes dbsql.NullString
+	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.UserName, &user.EmailID, &user.CanonicalEmail, &user.CanonicalUserName, &emailIndex, &emailPrefixes, &user.PasswordHash, &user.LegacyContact,
+		&phones, &emails, &addresses, &businessUnit, &user.FailedLogins, &user.LockedUntil, &user.Version)
+	if err != nil {
+		return user, err
+	}
+	user.BusinessUnit, user.EmailIndex = int(businessUnit.Int64), emailIndex.String
+	for _, c := range []struct {
+		column dbsql.NullString
+		dest   interface{}
+	}{
+		{phones, &user.Phones},
+		{emails, &user.Emails},
+		{addresses, &user.Addresses},
+		{emailPrefixes, &user.EmailPrefixes},
+	} {
+		if c.column.Valid && c.column.String != "" {
+			if err := json.Unmarshal([]byte(c.column.String), c.dest); err != nil {
+				return user, err
+			}
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,49 @@
+package mssql
+
+import (
+	"errors"
+	"testing"
+)
+
+// sqlError is an error of SQL Server as the driver reports it.
+type sqlError struct {
+	number  int32
+	message string
+}
+
+func (e sqlError) Error() string           { return e.message }
+func (e sqlError) SQLErrorNumber() int32   { return e.number }
+func (e sqlError) SQLErrorMessage() string { return e.message }
+
+func TestDuplicateKeysNameTheirField(t *testing.T) {
+	ss := &Mssql{Table: "users"}
+	message := func(index string) string {
+		return "Cannot insert duplicate key row in object 'dbo.users' with unique index '" + index +
+			"'. The duplicate key value is (ada)."
+	}
+	tests := []struct {
+		name      string
+		err       error
+		field     string
+		duplicate bool
+	}{
+		{"user name", sqlError{2601, message("UX_users_userName")}, "userName", true},
+		{"email", sqlError{2601, message("UX_users_emailId")}, "emailId", true},
+		{"blind index of the email", sqlError{2601, message("UX_users_emailIndex")}, "emailId", true},
+		{"unique constraint", sqlError{2627, "Violation of UNIQUE KEY constraint 'UX_users_userName'."}, "userName",
+			true},
+		{"primary key", sqlError{2627, "Violation of PRIMARY KEY constraint 'PK_users'."}, "", false},
+		{"index of another table", sqlError{2601, message("UX_accounts_userName")}, "", false},
+		{"other error", sqlError{547, "The INSERT statement conflicted with the FOREIGN KEY constraint."}, "", false},
+		{"error of the connection", errors.New("connection reset"), "", false},
+		{"no error", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field, duplicate := ss.duplicateKey(tt.err)
+			if field != tt.field || duplicate != tt.duplicate {
+				t.Errorf("duplicateKey found %q, %v, want %q, %v", field, duplicate, tt.field, tt.duplicate)
+			}
+		})
+	}
+}
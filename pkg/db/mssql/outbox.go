@@ -0,0 +1,133 @@
+package mssql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+	"user-details/pkg/model"
+)
+
+const outboxColumns = "id, sequence, type, userId, businessUnit, version, operation, fields, timestamp, requestId, " +
+	"published"
+
+type txKey struct{}
+
+// executor runs the statements users are read and written with, see conn.
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (dbsql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *dbsql.Row
+}
+
+// conn returns the transaction of Transact when ctx carries one, the connection pool otherwise.
+func (ss *Mssql) conn(ctx context.Context) executor {
+	if tx, ok := ctx.Value(txKey{}).(*dbsql.Tx); ok {
+		return tx
+	}
+	return ss
+}
+
+// Transact calls write within a transaction and inserts the events it returns in the outbox table before committing.
+// Their sequences follow the highest sequence of the table, which stays locked until the commit, so events become
+// visible in sequence order. Fields are stored as JSON text.
+func (ss *Mssql) Transact(write func(ctx context.Context) ([]model.UserEvent, error), ctx context.Context) error {
+	tx, err := ss.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	events, err := write(context.WithValue(ctx, txKey{}, tx))
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return tx.Commit()
+	}
+	var sequence int64
+	query := fmt.Sprintf("SELECT ISNULL(MAX(sequence), 0) FROM %s WITH (UPDLOCK, HOLDLOCK)", quote(ss.OutboxTable))
+	if err := tx.QueryRowContext(ctx, query).Scan(&sequence); err != nil {
+		return err
+	}
+	query = fmt.Sprintf(`INSERT INTO %s (%s) VALUES (@id, @sequence, @type, @userId, @businessUnit, @version, @operation,
+	@fields, @timestamp, @requestId, NULL)`, quote(ss.OutboxTable), outboxColumns)
+	for _, event := range events {
+		fields, err := json.Marshal(event.Fields)
+		if err != nil {
+			return err
+		}
+		sequence++
+		_, err = tx.ExecContext(ctx, query,
+			dbsql.Named("id", event.ID),
+			dbsql.Named("sequence", sequence),
+			dbsql.Named("type", event.Type),
+			dbsql.Named("userId", event.UserID),
+			dbsql.Named("businessUnit", event.BusinessUnit),
+			dbsql.Named("version", event.Version),
+			dbsql.Named("operation", event.Operation),
+			dbsql.Named("fields", string(fields)),
+			dbsql.Named("timestamp", event.Timestamp),
+			dbsql.Named("requestId", event.RequestID),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Pending returns up to limit events not published yet, oldest first.
+func (ss *Mssql) Pending(limit int, ctx context.Context) ([]model.UserEvent, error) {
+	statement := fmt.Sprintf("SELECT TOP (@limit) %s FROM %s WHERE published IS NULL ORDER BY sequence", outboxColumns,
+		quote(ss.OutboxTable))
+	return ss.queryEvents(statement, limit, ctx, dbsql.Named("limit", limit))
+}
+
+// Since returns up to limit events numbered after sequence, in sequence order.
+func (ss *Mssql) Since(sequence int64, limit int, ctx context.Context) ([]model.UserEvent, error) {
+	statement := fmt.Sprintf("SELECT TOP (@limit) %s FROM %s WHERE sequence > @sequence ORDER BY sequence",
+		outboxColumns, quote(ss.OutboxTable))
+	return ss.queryEvents(statement, limit, ctx, dbsql.Named("limit", limit), dbsql.Named("sequence", sequence))
+}
+
+// LastSequence returns the sequence of the latest event, 0 when there is none.
+func (ss *Mssql) LastSequence(ctx context.Context) (int64, error) {
+	var sequence int64
+	query := fmt.Sprintf("SELECT ISNULL(MAX(sequence), 0) FROM %s", quote(ss.OutboxTable))
+	err := ss.QueryRowContext(ctx, query).Scan(&sequence)
+	return sequence, err
+}
+
+func (ss *Mssql) queryEvents(statement string, limit int, ctx context.Context, args ...interface{}) ([]model.UserEvent, error) {
+	rows, err := ss.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]model.UserEvent, 0, limit)
+	for rows.Next() {
+		var event model.UserEvent
+		var fields string
+		var businessUnit dbsql.NullInt64
+		err := rows.Scan(&event.ID, &event.Sequence, &event.Type, &event.UserID, &businessUnit, &event.Version,
+			&event.Operation, &fields, &event.Timestamp, &event.RequestID, &event.Published)
+		if err != nil {
+			return nil, err
+		}
+		event.BusinessUnit = int(businessUnit.Int64)
+		if err := json.Unmarshal([]byte(fields), &event.Fields); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// MarkPublished records that the event stored under eventId was published at at.
+func (ss *Mssql) MarkPublished(eventId string, at time.Time, ctx context.Context) error {
+	query := fmt.Sprintf("UPDATE %s SET published = @published WHERE id = @id", quote(ss.OutboxTable))
+	_, err := ss.ExecContext(ctx, query, dbsql.Named("published", at), dbsql.Named("id", eventId))
+	return err
+}
@@ -0,0 +1,63 @@
+package mssql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+	"user-details/pkg/model"
+)
+
+const snapshotColumns = "id, userId, version, timestamp, deleted, document"
+
+// Keep stores snapshot in the snapshot table. The user is stored as its JSON document, which holds everything a
+// snapshot keeps.
+func (ss *Mssql) Keep(snapshot model.Snapshot, ctx context.Context) error {
+	document, err := json.Marshal(snapshot.User)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (@id, @userId, @version, @timestamp, @deleted, @document)",
+		quote(ss.SnapshotTable), snapshotColumns)
+	_, err = ss.conn(ctx).ExecContext(ctx, query,
+		dbsql.Named("id", snapshot.ID),
+		dbsql.Named("userId", snapshot.UserID),
+		dbsql.Named("version", snapshot.Version),
+		dbsql.Named("timestamp", snapshot.Timestamp),
+		dbsql.Named("deleted", snapshot.Deleted),
+		dbsql.Named("document", string(document)),
+	)
+	return err
+}
+
+// AsOf returns the latest snapshot of userId taken at or before at.
+func (ss *Mssql) AsOf(userId string, at time.Time, ctx context.Context) (model.Snapshot, error) {
+	return ss.latestSnapshot(ctx, "userId = @userId AND timestamp <= @at",
+		dbsql.Named("userId", userId), dbsql.Named("at", at))
+}
+
+// Snapshot returns the latest snapshot of userId at version.
+func (ss *Mssql) Snapshot(userId string, version int64, ctx context.Context) (model.Snapshot, error) {
+	return ss.latestSnapshot(ctx, "userId = @userId AND version = @version AND deleted = 0",
+		dbsql.Named("userId", userId), dbsql.Named("version", version))
+}
+
+func (ss *Mssql) latestSnapshot(ctx context.Context, condition string, args ...interface{}) (model.Snapshot, error) {
+	var snapshot model.Snapshot
+	var document string
+	query := fmt.Sprintf("SELECT TOP (1) %s FROM %s WHERE %s ORDER BY timestamp DESC, id DESC",
+		snapshotColumns, quote(ss.SnapshotTable), condition)
+	err := ss.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&snapshot.ID, &snapshot.UserID, &snapshot.Version,
+		&snapshot.Timestamp, &snapshot.Deleted, &document)
+	if err == dbsql.ErrNoRows {
+		return snapshot, model.ErrSnapshotNotFound
+	}
+	if err != nil {
+		return snapshot, err
+	}
+	if err := json.Unmarshal([]byte(document), &snapshot.User); err != nil {
+		return snapshot, err
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,222 @@
+package mssql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"user-details/pkg/model"
+)
+
+const (
+	webhookColumns  = "id, url, secret, events, created, updated"
+	deliveryColumns = "id, webhookId, event, status, failures, nextAttempt, attempts, created, updated"
+)
+
+// SaveWebhook stores webhook in place of the webhook stored under the same id, if any. Events are stored as JSON
+// text.
+func (ss *Mssql) SaveWebhook(webhook model.Webhook, ctx context.Context) error {
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`MERGE %s WITH (HOLDLOCK) AS t
+USING (SELECT @id AS id) AS s ON t.id = s.id
+WHEN MATCHED THEN
+	UPDATE SET url = @url, secret = @secret, events = @events, created = @created, updated = @updated
+WHEN NOT MATCHED THEN
+	INSERT (%s) VALUES (@id, @url, @secret, @events, @created, @updated);`, quote(ss.WebhookTable), webhookColumns)
+	_, err = ss.ExecContext(ctx, query,
+		dbsql.Named("id", webhook.ID),
+		dbsql.Named("url", webhook.URL),
+		dbsql.Named("secret", webhook.Secret),
+		dbsql.Named("events", string(events)),
+		dbsql.Named("created", webhook.Created),
+		dbsql.Named("updated", webhook.Updated),
+	)
+	return err
+}
+
+// Webhook returns the webhook stored under webhookId.
+func (ss *Mssql) Webhook(webhookId string, ctx context.Context) (model.Webhook, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id = @id", webhookColumns, quote(ss.WebhookTable))
+	webhook, err := scanWebhook(ss.QueryRowContext(ctx, query, dbsql.Named("id", webhookId)))
+	if err == dbsql.ErrNoRows {
+		return webhook, model.ErrWebhookNotFound
+	}
+	return webhook, err
+}
+
+// Webhooks returns every webhook, by id.
+func (ss *Mssql) Webhooks(ctx context.Context) ([]model.Webhook, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s ORDER BY id", webhookColumns, quote(ss.WebhookTable))
+	rows, err := ss.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]model.Webhook, 0)
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook deletes the webhook stored under webhookId along with its deliveries.
+func (ss *Mssql) DeleteWebhook(webhookId string, ctx context.Context) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = @id", quote(ss.WebhookTable))
+	result, err := ss.ExecContext(ctx, query, dbsql.Named("id", webhookId))
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return model.ErrWebhookNotFound
+	}
+	query = fmt.Sprintf("DELETE FROM %s WHERE webhookId = @webhookId", quote(ss.DeliveryTable))
+	_, err = ss.ExecContext(ctx, query, dbsql.Named("webhookId", webhookId))
+	return err
+}
+
+// AddDelivery stores delivery unless a delivery is stored under its id already. The event and the attempts are
+// stored as JSON text.
+func (ss *Mssql) AddDelivery(delivery model.Delivery, ctx context.Context) error {
+	args, err := deliveryArgs(delivery)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`MERGE %s WITH (HOLDLOCK) AS t
+USING (SELECT @id AS id) AS s ON t.id = s.id
+WHEN NOT MATCHED THEN
+	INSERT (%s) VALUES (@id, @webhookId, @event, @status, @failures, @nextAttempt, @attempts, @created, @updated);`,
+		quote(ss.DeliveryTable), deliveryColumns)
+	_, err = ss.ExecContext(ctx, query, args...)
+	return err
+}
+
+// SaveDelivery stores delivery in place of the delivery stored under the same id.
+func (ss *Mssql) SaveDelivery(delivery model.Delivery, ctx context.Context) error {
+	args, err := deliveryArgs(delivery)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`UPDATE %s SET webhookId = @webhookId, event = @event, status = @status, failures = @failures,
+	nextAttempt = @nextAttempt, attempts = @attempts, created = @created, updated = @updated WHERE id = @id`,
+		quote(ss.DeliveryTable))
+	result, err := ss.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return model.ErrDeliveryNotFound
+	}
+	return nil
+}
+
+// Delivery returns the delivery of webhookId stored under deliveryId.
+func (ss *Mssql) Delivery(webhookId, deliveryId string, ctx context.Context) (model.Delivery, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id = @id AND webhookId = @webhookId", deliveryColumns,
+		quote(ss.DeliveryTable))
+	deliveries, err := ss.queryDeliveries(query, ctx, dbsql.Named("id", deliveryId), dbsql.Named("webhookId", webhookId))
+	if err != nil {
+		return model.Delivery{}, err
+	}
+	if len(deliveries) == 0 {
+		return model.Delivery{}, model.ErrDeliveryNotFound
+	}
+	return deliveries[0], nil
+}
+
+// Deliveries returns up to limit deliveries of webhookId in status, or in any status when it is empty, newest first.
+func (ss *Mssql) Deliveries(webhookId, status string, limit int, ctx context.Context) ([]model.Delivery, error) {
+	conditions := []string{"webhookId = @webhookId"}
+	args := []interface{}{dbsql.Named("webhookId", webhookId), dbsql.Named("limit", limit)}
+	if status != "" {
+		conditions = append(conditions, "status = @status")
+		args = append(args, dbsql.Named("status", status))
+	}
+	query := fmt.Sprintf("SELECT TOP (@limit) %s FROM %s WHERE %s ORDER BY created DESC, id DESC", deliveryColumns,
+		quote(ss.DeliveryTable), strings.Join(conditions, " AND "))
+	return ss.queryDeliveries(query, ctx, args...)
+}
+
+// DueDeliveries returns up to limit pending deliveries whose next attempt is due at now, earliest first.
+func (ss *Mssql) DueDeliveries(now time.Time, limit int, ctx context.Context) ([]model.Delivery, error) {
+	query := fmt.Sprintf(`SELECT TOP (@limit) %s FROM %s WHERE status = @status AND nextAttempt <= @now
+	ORDER BY nextAttempt`, deliveryColumns, quote(ss.DeliveryTable))
+	return ss.queryDeliveries(query, ctx, dbsql.Named("limit", limit), dbsql.Named("status", model.DeliveryPending),
+		dbsql.Named("now", now))
+}
+
+func (ss *Mssql) queryDeliveries(query string, ctx context.Context, args ...interface{}) ([]model.Delivery, error) {
+	rows, err := ss.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]model.Delivery, 0)
+	for rows.Next() {
+		var delivery model.Delivery
+		var event, attempts string
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &event, &delivery.Status, &delivery.Failures,
+			&delivery.NextAttempt, &attempts, &delivery.Created, &delivery.Updated)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(event), &delivery.Event); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(attempts), &delivery.Attempts); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func deliveryArgs(delivery model.Delivery) ([]interface{}, error) {
+	event, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := json.Marshal(delivery.Attempts)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{
+		dbsql.Named("id", delivery.ID),
+		dbsql.Named("webhookId", delivery.WebhookID),
+		dbsql.Named("event", string(event)),
+		dbsql.Named("status", delivery.Status),
+		dbsql.Named("failures", delivery.Failures),
+		dbsql.Named("nextAttempt", delivery.NextAttempt),
+		dbsql.Named("attempts", string(attempts)),
+		dbsql.Named("created", delivery.Created),
+		dbsql.Named("updated", delivery.Updated),
+	}, nil
+}
+
+func scanWebhook(row scanner) (model.Webhook, error) {
+	var webhook model.Webhook
+	var events string
+	err := row.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &events, &webhook.Created, &webhook.Updated)
+	if err != nil {
+		return webhook, err
+	}
+	return webhook, json.Unmarshal([]byte(events), &webhook.Events)
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"time"
+	"user-details/pkg/model"
+)
+
+const (
+	// MongoUsers serves users from the configured mongo collection.
+	MongoUsers = "mongo"
+	// MssqlUsers serves users from the configured sql table.
+	MssqlUsers = "mssql"
+	// MemoryUsers serves users from process memory. Users are lost on restart.
+	MemoryUsers = "memory"
+)
+
+// UserRepository is implemented by every datasource able to store users.
+type UserRepository interface {
+	// Get returns the user stored under userId or model.ErrUserNotFound.
+	Get(userId string, ctx context.Context) (model.User, error)
+	// Upsert stores user as version+1 when the user stored under user.ID is at version, 0 meaning it may not exist
+	// yet. Otherwise it returns model.ErrVersionConflict.
+	Upsert(user model.User, version int64, ctx context.Context) (model.User, error)
+	// Delete removes the user stored under userId when it is at version, returning model.ErrUserNotFound or
+	// model.ErrVersionConflict otherwise.
+	Delete(userId string, version int64, ctx context.Context) error
+	// List returns up to query.Limit users matching query, ordered by query.Sort then id.
+	List(query model.UserQuery, ctx context.Context) ([]model.User, error)
+	// Search returns every user matching all non-empty fields of filter.
+	Search(filter model.UserFilter, ctx context.Context) ([]model.User, error)
+}
+
+// AuditRepository is implemented by every datasource able to keep the audit trail of users. Records can only be
+// appended.
+type AuditRepository interface {
+	// Append stores record.
+	Append(record model.AuditRecord, ctx context.Context) error
+	// History returns up to query.Limit records of query.UserID older than query.Before, newest first.
+	History(query model.HistoryQuery, ctx context.Context) ([]model.AuditRecord, error)
+}
+
+// SnapshotRepository is implemented by every datasource able to keep the earlier versions of users.
+type SnapshotRepository interface {
+	// Keep stores snapshot.
+	Keep(snapshot model.Snapshot, ctx context.Context) error
+	// AsOf returns the latest snapshot of userId taken at or before at, or model.ErrSnapshotNotFound.
+	AsOf(userId string, at time.Time, ctx context.Context) (model.Snapshot, error)
+	// Snapshot returns the latest snapshot of userId at version, or model.ErrSnapshotNotFound. Versions restart
+	// when a deleted user is created again.
+	Snapshot(userId string, version int64, ctx context.Context) (model.Snapshot, error)
+}
+
+// TokenRepository is implemented by every datasource able to keep the tokens standing for user field values.
+type TokenRepository interface {
+	// Tokenize stores token unless a token of the same field and value is stored already, and returns the stored
+	// token.
+	Tokenize(token model.Token, ctx context.Context) (model.Token, error)
+	// Detokenize returns the stored tokens among tokens. Unknown tokens are left out.
+	Detokenize(tokens []string, ctx context.Context) ([]model.Token, error)
+	// Revoke deletes the tokens standing for value of field, returning how many it deleted.
+	Revoke(field, value string, ctx context.Context) (int64, error)
+}
+
+// ErasureRepository is implemented by every datasource able to hold the data of users.
+type ErasureRepository interface {
+	// Erase deletes the user stored under userId, its snapshots, its consents, its accesses, the redirects from and to
+	// it and the deliveries of its events, and removes the values from the changes of its audit records and the
+	// business unit, fields and request id from its events, describing what it touched. Events keep their sequence.
+	// Erasing a user that was erased already touches nothing.
+	Erase(userId string, ctx context.Context) ([]model.ErasureStep, error)
+}
+
+// CertificateRepository is implemented by every datasource able to keep erasure certificates.
+type CertificateRepository interface {
+	// KeepCertificate stores certificate.
+	KeepCertificate(certificate model.ErasureCertificate, ctx context.Context) error
+}
+
+// ConsentRepository is implemented by every datasource able to keep the consents of users. Consents can only be
+// appended, or moved to the user their user was merged into.
+type ConsentRepository interface {
+	// Record stores consent.
+	Record(consent model.Consent, ctx context.Context) error
+	// MoveConsents hands the consents of fromUserId over to toUserId. Their ids are kept, so the consents of both
+	// users stay in the order they were given in.
+	MoveConsents(fromUserId, toUserId string, ctx context.Context) error
+	// Consents returns the consents of userId, oldest first.
+	Consents(userId string, ctx context.Context) ([]model.Consent, error)
+}
+
+// AccessLogRepository is implemented by every datasource able to log the reads of users. Accesses can only be
+// appended.
+type AccessLogRepository interface {
+	// LogAccesses stores accesses.
+	LogAccesses(accesses []model.Access, ctx context.Context) error
+	// Accesses returns the accesses of userId, oldest first.
+	Accesses(userId string, ctx context.Context) ([]model.Access, error)
+}
+
+// MergeRepository is implemented by every datasource able to keep the redirects of merged users. Redirects can only
+// be appended.
+type MergeRepository interface {
+	// AddRedirect stores redirect.
+	AddRedirect(redirect model.Redirect, ctx context.Context) error
+	// Redirect returns the latest redirect of userId, or model.ErrUserNotFound when userId was never merged.
+	Redirect(userId string, ctx context.Context) (model.Redirect, error)
+}
+
+// OutboxRepository is implemented by every datasource able to keep the events of user changes along with the users.
+type OutboxRepository interface {
+	// Transact calls write with a context the user writes of the same datasource join, and appends the events write
+	// returns to the outbox in the same transaction, in order and numbered with the next sequences. Writes may
+	// return no event. Nothing is stored when write fails. Events become visible in sequence order.
+	Transact(write func(ctx context.Context) ([]model.UserEvent, error), ctx context.Context) error
+	// Pending returns up to limit events not published yet, oldest first.
+	Pending(limit int, ctx context.Context) ([]model.UserEvent, error)
+	// Since returns up to limit events numbered after sequence, in sequence order, published or not.
+	Since(sequence int64, limit int, ctx context.Context) ([]model.UserEvent, error)
+	// LastSequence returns the sequence of the latest event, 0 when there is none.
+	LastSequence(ctx context.Context) (int64, error)
+	// MarkPublished records that the event stored under eventId was published at at.
+	MarkPublished(eventId string, at time.Time, ctx context.Context) error
+}
+
+// WebhookRepository is implemented by every datasource able to keep webhooks and their deliveries.
+type WebhookRepository interface {
+	// SaveWebhook stores webhook in place of the webhook stored under the same id, if any.
+	SaveWebhook(webhook model.Webhook, ctx context.Context) error
+	// Webhook returns the webhook stored under webhookId, model.ErrWebhookNotFound when there is none.
+	Webhook(webhookId string, ctx context.Context) (model.Webhook, error)
+	// Webhooks returns every webhook, by id.
+	Webhooks(ctx context.Context) ([]model.Webhook, error)
+	// DeleteWebhook deletes the webhook stored under webhookId along with its deliveries.
+	DeleteWebhook(webhookId string, ctx context.Context) error
+	// AddDelivery stores delivery unless a delivery is stored under its id already.
+	AddDelivery(delivery model.Delivery, ctx context.Context) error
+	// SaveDelivery stores delivery in place of the delivery stored under the same id.
+	SaveDelivery(delivery model.Delivery, ctx context.Context) error
+	// Delivery returns the delivery of webhookId stored under deliveryId, model.ErrDeliveryNotFound when there is none.
+	Delivery(webhookId, deliveryId string, ctx context.Context) (model.Delivery, error)
+	// Deliveries returns up to limit deliveries of webhookId in status, or in any status when it is empty, newest
+	// first.
+	Deliveries(webhookId, status string, limit int, ctx context.Context) ([]model.Delivery, error)
+	// DueDeliveries returns up to limit pending deliveries whose next attempt is due at now, earliest first.
+	DueDeliveries(now time.Time, limit int, ctx context.Context) ([]model.Delivery, error)
+}
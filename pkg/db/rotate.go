@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"time"
+	"user-details/pkg/config"
+	"user-details/pkg/db/mongo"
+	"user-details/pkg/db/mssql"
+	"user-details/pkg/encryption"
+	"user-details/pkg/rotation"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"vendor.lib/tng/tng-lib/db/sql"
+)
+
+// Rotate reconnects to the databases whose settings differ in conf from the ones in use. A new connection replaces
+// the current one only once it answers, and the replaced connection is closed after rotation.Drain so that the
+// requests using it can finish. Rotate is not meant to be called concurrently.
+func (ds *Datasource) Rotate(conf config.Config) {
+	ds.mu.RLock()
+	current, mgo, mssql := ds.conf, ds.mongo, ds.mssql
+	ds.mu.RUnlock()
+
+	if !reflect.DeepEqual(conf.Datasource.Mongo["cm"], current.Datasource.Mongo["cm"]) {
+		next, err := rotateMongo(conf, ds.cipher)
+		rotation.Record("mongo", err)
+		if err == nil {
+			current.Datasource.Mongo = conf.Datasource.Mongo
+			go drainMongo(mgo)
+			mgo = next
+		}
+	}
+	if !reflect.DeepEqual(conf.SQL, current.SQL) {
+		next, err := rotateMssql(mssql, conf)
+		rotation.Record("mssql", err)
+		if err == nil {
+			current.SQL = conf.SQL
+			go drainMssql(mssql)
+			mssql = next
+		}
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.conf = current
+	ds.use(mgo, mssql)
+}
+
+// rotateMongo connects to the mongo database of conf.
+func rotateMongo(conf config.Config, cipher *encryption.Cipher) (*mongo.Mongo, error) {
+	next := newMongo(conf, cipher)
+	if err := next.Connect(conf.Datasource.Mongo["cm"]); err != nil {
+		return nil, errors.Wrap(err, "unable to connect to mongo")
+	}
+	if err := next.Ping(); err != nil {
+		go drainMongo(next)
+		return nil, errors.Wrap(err, "unable to connect to mongo")
+	}
+	return next, nil
+}
+
+// rotateMssql connects to the sql database of conf in place of current.
+func rotateMssql(current *mssql.Mssql, conf config.Config) (*mssql.Mssql, error) {
+	// sql connections register their pool metrics under their database, host and user, which the new connection
+	// shares with the current one as long as only the password changes
+	registered := unregister(&current.Sql)
+
+	next := newMssql(conf)
+	err := next.Connect(conf.SQL)
+	if err == nil {
+		if err = next.Ping(); err != nil {
+			unregister(&next.Sql)
+			go drainMssql(next)
+		}
+	}
+	if err != nil {
+		if registered {
+			register(&current.Sql)
+		}
+		return nil, errors.Wrap(err, "unable to connect to sql")
+	}
+	return next, nil
+}
+
+func drainMongo(mgo *mongo.Mongo) {
+	if mgo == nil || mgo.Database == nil {
+		return
+	}
+	time.Sleep(rotation.Drain)
+	ctx, cancel := context.WithTimeout(context.Background(), rotation.Drain)
+	defer cancel()
+	if err := mgo.Database.Client().Disconnect(ctx); err != nil {
+		log.Warn().Err(err).Msg("Unable to close replaced mongo connection")
+	}
+}
+
+func drainMssql(mssql *mssql.Mssql) {
+	if mssql == nil || mssql.Database == nil {
+		return
+	}
+	time.Sleep(rotation.Drain)
+	// Close waits for the queries in progress
+	if err := mssql.Close(); err != nil {
+		log.Warn().Err(err).Msg("Unable to close replaced sql connection")
+	}
+}
+
+// registerer returns the registerer the pool metrics of s are registered with.
+func registerer(s *sql.Sql) prometheus.Registerer {
+	return prometheus.WrapRegistererWith(prometheus.Labels{
+		"database": s.URL.Query().Get("database"),
+		"host":     s.URL.Hostname(),
+		"user":     s.URL.User.Username(),
+	}, prometheus.DefaultRegisterer)
+}
+
+func unregister(s *sql.Sql) bool {
+	return s.URL != nil && registerer(s).Unregister(s)
+}
+
+func register(s *sql.Sql) {
+	if err := registerer(s).Register(s); err != nil {
+		log.Warn().Err(err).Msg("Unable to register sql metrics")
+	}
+}
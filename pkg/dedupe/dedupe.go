@@ -0,0 +1,362 @@
+package dedupe
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidConfig is returned when the configured threshold or survivorship rules are unusable.
+var ErrInvalidConfig = errors.New("invalid duplicate detection settings")
+
+const (
+	// DefaultThreshold is the score from which users are reported as duplicates when no threshold is configured.
+	DefaultThreshold = 0.7
+
+	// weights of the signals a score is made of, adding up to 1
+	nameWeight     = 0.45
+	phoneticWeight = 0.15
+	emailWeight    = 0.25
+	phoneWeight    = 0.15
+
+	// nameMatch is the name similarity from which names count as a match of their own
+	nameMatch = 0.85
+
+	// maxBlock bounds the users compared pairwise because they share a phonetic name key. Common names make huge
+	// blocks whose pairs hardly ever score above the threshold on their name alone.
+	maxBlock = 1000
+)
+
+// Config represents the duplicate detection settings read from app.json.
+type Config struct {
+	// Threshold is the score, between 0 and 1, from which users are reported as duplicates.
+	Threshold float64 `json:"threshold"`
+	// Interval is how often, in milliseconds, every user is scanned for duplicates. Zero disables scans.
+	Interval time.Duration `json:"interval-ms"`
+	// Survivorship maps user fields, or * for every other field, to the rule deciding their value on merges.
+	Survivorship Rules `json:"survivorship"`
+}
+
+// Profile holds what scoring looks at of a user, in normalized form.
+type Profile struct {
+	ID        string
+	FirstName string
+	LastName  string
+	Emails    []string
+	Phones    []string
+}
+
+// NewProfile returns the profile of user.
+func NewProfile(user model.User) Profile {
+	profile := Profile{ID: user.ID, FirstName: normalizeName(user.FirstName), LastName: normalizeName(user.LastName)}
+	seen := make(map[string]bool)
+	addEmail := func(email string) {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email != "" && !seen[email] {
+			seen[email] = true
+			profile.Emails = append(profile.Emails, email)
+		}
+	}
+	addEmail(user.CanonicalEmail)
+	addEmail(user.EmailID)
+	for _, e := range user.Emails {
+		addEmail(e.Address)
+	}
+	for _, p := range user.Phones {
+		profile.Phones = append(profile.Phones, p.Number)
+	}
+	return profile
+}
+
+// Detector scores how likely two users are the same person and merges them.
+type Detector struct {
+	threshold float64
+	interval  time.Duration
+	rules     Rules
+}
+
+// New creates the Detector described by cfg.
+func New(cfg Config) (*Detector, error) {
+	threshold := cfg.Threshold
+	if threshold == 0 {
+		threshold = DefaultThreshold
+	}
+	if threshold < 0 || threshold > 1 {
+		return nil, errors.Wrapf(ErrInvalidConfig, "threshold %v is not between 0 and 1", cfg.Threshold)
+	}
+	rules, err := checkRules(cfg.Survivorship)
+	if err != nil {
+		return nil, err
+	}
+	return &Detector{threshold: threshold, interval: cfg.Interval * time.Millisecond, rules: rules}, nil
+}
+
+// Interval returns how often every user is scanned for duplicates, zero when scans are disabled.
+func (d *Detector) Interval() time.Duration {
+	return d.interval
+}
+
+// Score compares a and b, returning the candidate b is for a and whether it reaches the threshold.
+func (d *Detector) Score(a, b Profile) (model.DuplicateCandidate, bool) {
+	candidate := model.DuplicateCandidate{UserID: b.ID, Matches: make([]string, 0)}
+
+	similarity := nameSimilarity(a, b)
+	score := nameWeight * similarity
+	if similarity >= nameMatch {
+		candidate.Matches = append(candidate.Matches, model.MatchName)
+	}
+	if a.LastName != "" && soundex(a.FirstName) == soundex(b.FirstName) && soundex(a.LastName) == soundex(b.LastName) {
+		score += phoneticWeight
+		candidate.Matches = append(candidate.Matches, model.MatchPhonetic)
+	}
+	if shares(a.Emails, b.Emails) {
+		score += emailWeight
+		candidate.Matches = append(candidate.Matches, model.MatchEmail)
+	}
+	if shares(a.Phones, b.Phones) {
+		score += phoneWeight
+		candidate.Matches = append(candidate.Matches, model.MatchPhone)
+	}
+	// rounded so that equal pairs score equally whichever side they are scored from
+	candidate.Score = float64(int(score*1000+0.5)) / 1000
+	return candidate, candidate.Score >= d.threshold
+}
+
+// Pairs returns the candidates among profiles, by the id of the user they were found for. Only users sharing an
+// email address, a phone number or a phonetic name key are compared.
+func (d *Detector) Pairs(profiles []Profile) map[string][]model.DuplicateCandidate {
+	blocks := make(map[string][]int)
+	for i, p := range profiles {
+		for _, key := range blockKeys(p) {
+			blocks[key] = append(blocks[key], i)
+		}
+	}
+
+	type pair struct{ a, b int }
+	compared := make(map[pair]bool)
+	candidates := make(map[string][]model.DuplicateCandidate)
+	for key, block := range blocks {
+		if len(block) > maxBlock && strings.HasPrefix(key, "n:") {
+			continue
+		}
+		for i := 0; i < len(block); i++ {
+			for j := i + 1; j < len(block); j++ {
+				p := pair{block[i], block[j]}
+				if compared[p] {
+					continue
+				}
+				compared[p] = true
+				a, b := profiles[p.a], profiles[p.b]
+				if candidate, ok := d.Score(a, b); ok {
+					candidates[a.ID] = append(candidates[a.ID], candidate)
+					candidate.UserID = a.ID
+					candidates[b.ID] = append(candidates[b.ID], candidate)
+				}
+			}
+		}
+	}
+	for _, c := range candidates {
+		Sort(c)
+	}
+	return candidates
+}
+
+// Sort orders candidates by descending score, then by user id.
+func Sort(candidates []model.DuplicateCandidate) {
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].UserID < candidates[j].UserID
+	})
+}
+
+// Index holds the candidates found by the latest scan.
+type Index struct {
+	mu         sync.RWMutex
+	candidates map[string][]model.DuplicateCandidate
+}
+
+// Replace makes candidates, by the id of the user they were found for, the content of the index.
+func (x *Index) Replace(candidates map[string][]model.DuplicateCandidate) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.candidates = candidates
+}
+
+// Candidates returns the ids of the users the latest scan found for userId.
+func (x *Index) Candidates(userId string) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	ids := make([]string, len(x.candidates[userId]))
+	for i, c := range x.candidates[userId] {
+		ids[i] = c.UserID
+	}
+	return ids
+}
+
+// blockKeys returns the keys of the blocks p is compared within.
+func blockKeys(p Profile) []string {
+	keys := make([]string, 0, 1+len(p.Emails)+len(p.Phones))
+	if p.LastName != "" {
+		keys = append(keys, "n:"+soundex(p.LastName))
+	}
+	for _, e := range p.Emails {
+		keys = append(keys, "e:"+e)
+	}
+	for _, n := range p.Phones {
+		keys = append(keys, "p:"+n)
+	}
+	return keys
+}
+
+// nameSimilarity compares the full names of a and b, allowing first and last name to be swapped.
+func nameSimilarity(a, b Profile) float64 {
+	if a.FirstName+a.LastName == "" || b.FirstName+b.LastName == "" {
+		return 0
+	}
+	full := a.FirstName + " " + a.LastName
+	straight := similarity(full, b.FirstName+" "+b.LastName)
+	swapped := similarity(full, b.LastName+" "+b.FirstName)
+	if swapped > straight {
+		return swapped
+	}
+	return straight
+}
+
+// similarity returns 1 minus the edit distance of a and b relative to the longer of them.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein returns the number of single rune insertions, deletions and substitutions turning a into b.
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// soundexCodes maps the consonants of the latin alphabet to their soundex digit. Vowels, h, w and y have none.
+var soundexCodes = map[rune]byte{
+	'b': '1', 'f': '1', 'p': '1', 'v': '1',
+	'c': '2', 'g': '2', 'j': '2', 'k': '2', 'q': '2', 's': '2', 'x': '2', 'z': '2',
+	'd': '3', 't': '3',
+	'l': '4',
+	'm': '5', 'n': '5',
+	'r': '6',
+}
+
+// soundex returns the American Soundex key of the normalized name, such as r163 for robert and rupert. Names
+// without latin letters are their own key.
+func soundex(name string) string {
+	var first rune
+	key := make([]byte, 0, 4)
+	var last byte
+	for _, r := range name {
+		if r < 'a' || r > 'z' {
+			continue
+		}
+		code := soundexCodes[r]
+		if first == 0 {
+			first, last = r, code
+			continue
+		}
+		if code != 0 && code != last {
+			key = append(key, code)
+			if len(key) == 3 {
+				break
+			}
+		}
+		// h and w do not separate equal codes, vowels do
+		if r != 'h' && r != 'w' {
+			last = code
+		}
+	}
+	if first == 0 {
+		return name
+	}
+	for len(key) < 3 {
+		key = append(key, '0')
+	}
+	return string(first) + string(key)
+}
+
+// normalizeName lowercases name and keeps its letters only, folding common latin diacritics, so that
+// "O'Brien-Núñez" becomes "obriennunez". Spaces between words are kept.
+func normalizeName(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case unicode.IsLetter(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			if folded, ok := diacritics[r]; ok {
+				b.WriteString(folded)
+			} else {
+				b.WriteRune(r)
+			}
+		case unicode.IsSpace(r):
+			space = true
+		}
+	}
+	return b.String()
+}
+
+var diacritics = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae", 'ç': "c",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ñ': "n", 'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ß': "ss",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'ÿ': "y",
+}
+
+// shares reports whether a and b have a value in common.
+func shares(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
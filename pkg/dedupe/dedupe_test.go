@@ -0,0 +1,175 @@
+package dedupe
+
+import (
+	"reflect"
+	"testing"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		conf Config
+		err  error
+	}{
+		{"defaults", Config{}, nil},
+		{"threshold above 1", Config{Threshold: 1.5}, ErrInvalidConfig},
+		{"negative threshold", Config{Threshold: -0.1}, ErrInvalidConfig},
+		{"unknown field", Config{Survivorship: Rules{"password": NonEmpty}}, ErrInvalidConfig},
+		{"unknown rule", Config{Survivorship: Rules{"firstName": "newest"}}, ErrInvalidConfig},
+		{"union of a scalar", Config{Survivorship: Rules{"firstName": Union}}, ErrInvalidConfig},
+		{"non-empty collection", Config{Survivorship: Rules{"phones": NonEmpty}}, ErrInvalidConfig},
+		{"valid rules", Config{Survivorship: Rules{"*": NonEmpty, "phones": Survivor}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.conf); errors.Cause(err) != tt.err {
+				t.Errorf("New failed with %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSoundex(t *testing.T) {
+	for name, want := range map[string]string{
+		"robert": "r163", "rupert": "r163", "rubin": "r150", "ashcraft": "a261", "tymczak": "t522",
+		"pfister": "p236", "honeyman": "h555", "lee": "l000", "李": "李",
+	} {
+		if got := soundex(name); got != want {
+			t.Errorf("soundex(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	for name, want := range map[string]string{
+		"O'Brien-Núñez": "obriennunez",
+		"  Mary   Ann ": "mary ann",
+		"STRAßE":        "strasse",
+	} {
+		if got := normalizeName(name); got != want {
+			t.Errorf("normalizeName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	d, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ada := model.User{ID: "a", FirstName: "Ada", LastName: "Lovelace", EmailID: "ada@example.com",
+		Phones: []model.Phone{{Number: "+15555550123"}}}
+	tests := []struct {
+		name      string
+		other     model.User
+		score     float64
+		duplicate bool
+		matches   []string
+	}{
+		{"same person", model.User{ID: "b", FirstName: "Ada", LastName: "Lovelace", EmailID: "ADA@example.com",
+			Phones: []model.Phone{{Number: "+15555550123"}}}, 1, true,
+			[]string{model.MatchName, model.MatchPhonetic, model.MatchEmail, model.MatchPhone}},
+		{"swapped names and an email", model.User{ID: "b", FirstName: "Lovelace", LastName: "Ada",
+			Emails: []model.Email{{Address: "ada@example.com"}}}, 0.7, true,
+			[]string{model.MatchName, model.MatchEmail}},
+		{"misspelled name only", model.User{ID: "b", FirstName: "Adah", LastName: "Lovelace"}, 0.565, false,
+			[]string{model.MatchName, model.MatchPhonetic}},
+		{"shared phone only", model.User{ID: "b",
+			Phones: []model.Phone{{Number: "+15555550123"}}}, 0.15, false, []string{model.MatchPhone}},
+		{"nameless", model.User{ID: "b"}, 0, false, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := NewProfile(ada), NewProfile(tt.other)
+			candidate, duplicate := d.Score(a, b)
+			if candidate.Score != tt.score || duplicate != tt.duplicate || !reflect.DeepEqual(candidate.Matches, tt.matches) {
+				t.Errorf("scored %v %v (%v), want %v %v (%v)", candidate.Score, candidate.Matches, duplicate, tt.score,
+					tt.matches, tt.duplicate)
+			}
+		})
+	}
+}
+
+func TestPairs(t *testing.T) {
+	d, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles := []Profile{
+		NewProfile(model.User{ID: "a", FirstName: "Ada", LastName: "Lovelace", EmailID: "ada@example.com",
+			Phones: []model.Phone{{Number: "+15555550123"}}}),
+		NewProfile(model.User{ID: "b", FirstName: "Ada", LastName: "Lovelace", EmailID: "ada@example.com"}),
+		NewProfile(model.User{ID: "c", FirstName: "Ada", LastName: "Lovelace", EmailID: "a.lovelace@example.com",
+			Phones: []model.Phone{{Number: "+15555550123"}}}),
+		NewProfile(model.User{ID: "d", FirstName: "Grace", LastName: "Hopper", EmailID: "grace@example.com"}),
+	}
+	pairs := d.Pairs(profiles)
+	ids := func(candidates []model.DuplicateCandidate) []string {
+		ids := make([]string, 0, len(candidates))
+		for _, c := range candidates {
+			ids = append(ids, c.UserID)
+		}
+		return ids
+	}
+	for id, want := range map[string][]string{"a": {"b", "c"}, "b": {"a"}, "c": {"a"}, "d": {}} {
+		if got := ids(pairs[id]); !reflect.DeepEqual(got, want) {
+			t.Errorf("candidates of %s are %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	survivor := model.User{ID: "s", FirstName: "Ada", EmailID: "ada@example.com", PasswordHash: "$s",
+		Phones: []model.Phone{{ID: "p1", Number: "+15555550123", Primary: true}}}
+	merged := []model.User{
+		{ID: "m1", LastName: "Lovelace", UserName: "ada", EmailID: "lovelace@example.com", PasswordHash: "$m1",
+			Phones: []model.Phone{{ID: "p2", Number: "+15555550123"}, {ID: "p3", Number: "+15555550199", Primary: true}}},
+		{ID: "m2", LastName: "King", UserName: "countess", EmailID: "ADA@example.com"},
+	}
+	tests := []struct {
+		name  string
+		rules Rules
+		check func(t *testing.T, got model.User)
+	}{
+		{"defaults keep the survivor and unite contacts", nil, func(t *testing.T, got model.User) {
+			if got.LastName != "" || got.UserName != "" {
+				t.Errorf("survivor took over %q and %q", got.LastName, got.UserName)
+			}
+			want := []model.Phone{{ID: "p1", Number: "+15555550123", Primary: true}, {Number: "+15555550199"}}
+			if !reflect.DeepEqual(got.Phones, want) {
+				t.Errorf("phones are %+v, want %+v", got.Phones, want)
+			}
+			if len(got.Emails) != 1 || got.Emails[0].Address != "lovelace@example.com" {
+				t.Errorf("emails are %+v, want the login of m1 only", got.Emails)
+			}
+		}},
+		{"non-empty takes the first merged value", Rules{"*": NonEmpty}, func(t *testing.T, got model.User) {
+			if got.FirstName != "Ada" || got.LastName != "Lovelace" || got.UserName != "ada" {
+				t.Errorf("names are %q %q %q, want Ada Lovelace ada", got.FirstName, got.LastName, got.UserName)
+			}
+			if got.EmailID != "ada@example.com" || got.PasswordHash != "$s" {
+				t.Errorf("survivor lost its email %q or password %q", got.EmailID, got.PasswordHash)
+			}
+		}},
+		{"named collections are kept", Rules{"phones": Survivor, "emails": Survivor}, func(t *testing.T, got model.User) {
+			if len(got.Phones) != 1 || len(got.Emails) != 0 {
+				t.Errorf("contacts were united: %+v %+v", got.Phones, got.Emails)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := New(Config{Survivorship: tt.rules})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, d.Merge(survivor, merged))
+			if len(survivor.Phones) != 1 || survivor.Emails != nil {
+				t.Errorf("merge changed the contacts of the survivor passed in")
+			}
+		})
+	}
+}
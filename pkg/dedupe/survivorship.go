@@ -0,0 +1,165 @@
+package dedupe
+
+import (
+	"strings"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+// Rule decides the value a field of the surviving user takes on a merge.
+type Rule string
+
+const (
+	// Survivor keeps the value of the surviving user.
+	Survivor Rule = "survivor"
+	// NonEmpty keeps the value of the surviving user unless it is empty, taking the first non-empty value of the
+	// merged users otherwise, in the order they were named.
+	NonEmpty Rule = "non-empty"
+	// Union keeps the entries of the surviving user and adds the entries of the merged users it does not have yet.
+	// It only applies to phones, emails and addresses, which take no other rule than Survivor.
+	Union Rule = "union"
+)
+
+// Rules map json field names, or * for every other field, to their rule.
+type Rules map[string]Rule
+
+// all names the rule applying to every field the rules do not name themselves.
+const all = "*"
+
+// defaultRules apply to the fields the configured rules do not name, * included. Collections are united unless
+// they are named, whatever * says.
+var defaultRules = Rules{all: Survivor, "phones": Union, "emails": Union, "addresses": Union}
+
+// scalars give access to the text fields merges decide, by json name.
+var scalars = map[string]func(u *model.User) *string{
+	"firstName":     func(u *model.User) *string { return &u.FirstName },
+	"lastName":      func(u *model.User) *string { return &u.LastName },
+	"userName":      func(u *model.User) *string { return &u.UserName },
+	"emailId":       func(u *model.User) *string { return &u.EmailID },
+	"legacyContact": func(u *model.User) *string { return &u.LegacyContact },
+}
+
+// collections add the entries of merged to survivor that survivor does not have yet, by json name. Added entries
+// get no id and are not primary.
+var collections = map[string]func(survivor *model.User, merged model.User){
+	"phones": func(survivor *model.User, merged model.User) {
+		for _, p := range merged.Phones {
+			if !hasPhone(survivor.Phones, p.Number) {
+				p.ID, p.Primary = "", false
+				survivor.Phones = append(survivor.Phones, p)
+			}
+		}
+	},
+	"emails": func(survivor *model.User, merged model.User) {
+		add := func(e model.Email) {
+			if !strings.EqualFold(e.Address, survivor.EmailID) && !hasEmail(survivor.Emails, e.Address) {
+				e.ID, e.Primary = "", false
+				survivor.Emails = append(survivor.Emails, e)
+			}
+		}
+		// the address the merged user logged in with is kept as well
+		if merged.EmailID != "" {
+			add(model.Email{Type: "other", Address: merged.EmailID})
+		}
+		for _, e := range merged.Emails {
+			add(e)
+		}
+	},
+	"addresses": func(survivor *model.User, merged model.User) {
+		for _, a := range merged.Addresses {
+			if !hasAddress(survivor.Addresses, a) {
+				a.ID, a.Primary = "", false
+				survivor.Addresses = append(survivor.Addresses, a)
+			}
+		}
+	},
+}
+
+// checkRules returns the configured rules completed with defaultRules.
+func checkRules(configured Rules) (Rules, error) {
+	rules := make(Rules, len(defaultRules)+len(configured))
+	for field, rule := range defaultRules {
+		rules[field] = rule
+	}
+	for field, rule := range configured {
+		_, scalar := scalars[field]
+		_, collection := collections[field]
+		switch {
+		case !scalar && !collection && field != all:
+			return nil, errors.Wrapf(ErrInvalidConfig, "field %s cannot be merged", field)
+		case rule != Survivor && rule != NonEmpty && rule != Union:
+			return nil, errors.Wrapf(ErrInvalidConfig, "unknown survivorship rule %q of field %s", rule, field)
+		case rule == Union && !collection:
+			return nil, errors.Wrapf(ErrInvalidConfig, "field %s is no collection to unite", field)
+		case rule == NonEmpty && collection:
+			return nil, errors.Wrapf(ErrInvalidConfig, "collection %s is either kept or united", field)
+		}
+		rules[field] = rule
+	}
+	return rules, nil
+}
+
+// Merge returns survivor with its fields decided by the survivorship rules over the users merged into it, in the
+// order they were named. Fields the rules do not apply to, such as the password, are those of survivor.
+func (d *Detector) Merge(survivor model.User, merged []model.User) model.User {
+	result := survivor
+	result.Phones = append([]model.Phone(nil), survivor.Phones...)
+	result.Emails = append([]model.Email(nil), survivor.Emails...)
+	result.Addresses = append([]model.Address(nil), survivor.Addresses...)
+
+	for field, value := range scalars {
+		if d.rule(field) != NonEmpty || *value(&result) != "" {
+			continue
+		}
+		for i := range merged {
+			if v := *value(&merged[i]); v != "" {
+				*value(&result) = v
+				break
+			}
+		}
+	}
+	for field, unite := range collections {
+		if d.rule(field) != Union {
+			continue
+		}
+		for _, m := range merged {
+			unite(&result, m)
+		}
+	}
+	return result
+}
+
+func (d *Detector) rule(field string) Rule {
+	if rule, ok := d.rules[field]; ok {
+		return rule
+	}
+	return d.rules[all]
+}
+
+func hasPhone(phones []model.Phone, number string) bool {
+	for _, p := range phones {
+		if p.Number == number {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEmail(emails []model.Email, address string) bool {
+	for _, e := range emails {
+		if strings.EqualFold(e.Address, address) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAddress(addresses []model.Address, address model.Address) bool {
+	for _, a := range addresses {
+		if a.Zip == address.Zip && strings.EqualFold(strings.Join(a.Lines, "\n"), strings.Join(address.Lines, "\n")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,304 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// prefix starts every encrypted value, which reads enc:<key id>:<base64 of nonce and ciphertext>. Values without it
+// were stored before encryption was enabled and are read as they are.
+const prefix = "enc:"
+
+var (
+	// ErrUnknownKey is returned when a value was encrypted with a key that is not configured.
+	ErrUnknownKey = errors.New("unknown encryption key")
+	// ErrInvalidKey is returned when a configured key is not 32 bytes long.
+	ErrInvalidKey = errors.New("encryption keys must be 32 bytes")
+	// ErrMissingIndexKey is returned when encryption is enabled without a key for blind indexes.
+	ErrMissingIndexKey = errors.New("encryption needs an index key")
+	// ErrMalformedValue is returned when an encrypted value cannot be decoded or authenticated.
+	ErrMalformedValue = errors.New("malformed encrypted value")
+)
+
+// Config lists the keys field values are encrypted with. Encryption is disabled while ActiveKey is empty.
+type Config struct {
+	// ActiveKey is the id of the key new values are encrypted with. The other keys only decrypt.
+	ActiveKey string `json:"active-key"`
+	Keys      []Key  `json:"keys"`
+	// IndexKey computes the blind indexes values are compared by regardless of the key they are encrypted with. It
+	// is not rotated, every blind index would have to be computed again.
+	IndexKey Key `json:"index-key"`
+}
+
+// Key is an AES-256 key, given either base64 encoded in the configuration or as a file.
+type Key struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret" base64:""`
+	// File holds the key, raw or base64 encoded, when Secret is empty.
+	File string `json:"file"`
+}
+
+// Cipher encrypts the string fields tagged encrypted with AES-256-GCM. The tag value names the field in the
+// ciphertext, the json name of the field when empty, so that values cannot be moved to another field.
+//
+// The nonce of a value is derived from the key, the field and the value, so equal values encrypt equally under the
+// same key. This keeps exact matches, lookups and unique indexes working on encrypted fields, at the cost of
+// revealing which values are equal.
+//
+// Values that must be compared across keys, such as unique ones, are compared by their blind index, see BlindIndex.
+type Cipher struct {
+	active string
+	keys   map[string]key
+	index  []byte
+}
+
+type key struct {
+	aead  cipher.AEAD
+	nonce []byte
+}
+
+// New creates the Cipher described by cfg, or returns nil when encryption is disabled.
+func New(cfg Config) (*Cipher, error) {
+	if cfg.ActiveKey == "" {
+		return nil, nil
+	}
+	c := &Cipher{active: cfg.ActiveKey, keys: make(map[string]key, len(cfg.Keys))}
+	for _, k := range cfg.Keys {
+		secret, err := k.secret()
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(secret)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte("nonce"))
+		c.keys[k.ID] = key{aead: aead, nonce: mac.Sum(nil)}
+	}
+	if _, ok := c.keys[c.active]; !ok {
+		return nil, errors.Wrapf(ErrUnknownKey, "active key %s", c.active)
+	}
+	if cfg.IndexKey.Secret == "" && cfg.IndexKey.File == "" {
+		return nil, ErrMissingIndexKey
+	}
+	index, err := cfg.IndexKey.secret()
+	if err != nil {
+		return nil, err
+	}
+	c.index = index
+	return c, nil
+}
+
+// secret returns the 32 bytes of k.
+func (k Key) secret() ([]byte, error) {
+	secret := []byte(k.Secret)
+	if k.Secret == "" && k.File != "" {
+		content, err := ioutil.ReadFile(k.File)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read encryption key %s", k.ID)
+		}
+		secret = content
+		if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(content))); err == nil {
+			secret = decoded
+		}
+	}
+	if len(secret) != 32 {
+		return nil, errors.Wrapf(ErrInvalidKey, "key %s", k.ID)
+	}
+	return secret, nil
+}
+
+// ActiveKey returns the id of the key new values are encrypted with.
+func (c *Cipher) ActiveKey() string {
+	return c.active
+}
+
+// KeyIDs returns the ids of every configured key, the active one first.
+func (c *Cipher) KeyIDs() []string {
+	ids := []string{c.active}
+	for id := range c.keys {
+		if id != c.active {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids[1:])
+	return ids
+}
+
+// Encrypt encrypts the tagged fields of the struct v points to with the active key. Slices are copied before their
+// elements are encrypted, so a copy of a struct can be encrypted without touching the original.
+func (c *Cipher) Encrypt(v interface{}) error {
+	return c.EncryptWith(c.active, v)
+}
+
+// EncryptWith encrypts the tagged fields of the struct v points to with the key keyId, see Encrypt.
+func (c *Cipher) EncryptWith(keyId string, v interface{}) error {
+	return transform(reflect.ValueOf(v).Elem(), func(field, value string) (string, error) {
+		return c.EncryptValue(keyId, field, value)
+	})
+}
+
+// Decrypt decrypts the tagged fields of the struct v points to, see Encrypt.
+func (c *Cipher) Decrypt(v interface{}) error {
+	return transform(reflect.ValueOf(v).Elem(), c.DecryptValue)
+}
+
+// EncryptValue encrypts value of field with the key keyId.
+func (c *Cipher) EncryptValue(keyId, field, value string) (string, error) {
+	k, ok := c.keys[keyId]
+	if !ok {
+		return "", errors.Wrapf(ErrUnknownKey, "key %s", keyId)
+	}
+	mac := hmac.New(sha256.New, k.nonce)
+	mac.Write([]byte(field + "\x00" + value))
+	nonce := mac.Sum(nil)[:k.aead.NonceSize()]
+	sealed := k.aead.Seal(nonce, nonce, []byte(value), []byte(field))
+	return prefix + keyId + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// BlindIndex returns the keyed hash of value of field, which is the same whatever key value is encrypted with and
+// reveals nothing of value without the index key.
+func (c *Cipher) BlindIndex(field, value string) string {
+	mac := hmac.New(sha256.New, c.index)
+	mac.Write([]byte(field + "\x00" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsEncrypted reports whether value was encrypted by a Cipher.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// DecryptValue decrypts value of field. Values that are not encrypted are returned as they are.
+func (c *Cipher) DecryptValue(field, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 2)
+	if len(parts) != 2 {
+		return "", ErrMalformedValue
+	}
+	k, ok := c.keys[parts[0]]
+	if !ok {
+		return "", errors.Wrapf(ErrUnknownKey, "key %s", parts[0])
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || len(sealed) < k.aead.NonceSize() {
+		return "", ErrMalformedValue
+	}
+	plain, err := k.aead.Open(nil, sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():], []byte(field))
+	if err != nil {
+		return "", errors.Wrapf(ErrMalformedValue, "field %s", field)
+	}
+	return string(plain), nil
+}
+
+// Encrypted reports whether the top level json field of the struct v holds encrypted values, directly or in
+// nested structs.
+func Encrypted(v interface{}, field string) bool {
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.PkgPath == "" && jsonName(f) == field {
+			return holdsEncrypted(f)
+		}
+	}
+	return false
+}
+
+func holdsEncrypted(f reflect.StructField) bool {
+	if _, ok := f.Tag.Lookup("encrypted"); ok {
+		return true
+	}
+	t := f.Type
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" && holdsEncrypted(t.Field(i)) {
+			return true
+		}
+	}
+	return false
+}
+
+// transform replaces the non-empty values of the tagged string fields of the struct v by fn, descending into
+// structs and slices.
+func transform(v reflect.Value, fn func(field, value string) (string, error)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, tagged := f.Tag.Lookup("encrypted")
+		if name == "" {
+			name = jsonName(f)
+		}
+		value := v.Field(i)
+
+		switch value.Kind() {
+		case reflect.String:
+			if tagged && value.String() != "" {
+				s, err := fn(name, value.String())
+				if err != nil {
+					return err
+				}
+				value.SetString(s)
+			}
+		case reflect.Struct:
+			if err := transform(value, fn); err != nil {
+				return err
+			}
+		case reflect.Slice:
+			elem := value.Type().Elem().Kind()
+			if value.Len() == 0 || !(elem == reflect.Struct || elem == reflect.String && tagged) {
+				continue
+			}
+			copied := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+			reflect.Copy(copied, value)
+			for j := 0; j < copied.Len(); j++ {
+				e := copied.Index(j)
+				if elem == reflect.Struct {
+					if err := transform(e, fn); err != nil {
+						return err
+					}
+				} else if e.String() != "" {
+					s, err := fn(name, e.String())
+					if err != nil {
+						return err
+					}
+					e.SetString(s)
+				}
+			}
+			value.Set(copied)
+		}
+	}
+	return nil
+}
+
+// jsonName returns the name f has in JSON documents.
+func jsonName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
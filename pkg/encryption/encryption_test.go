@@ -0,0 +1,172 @@
+package encryption
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// testKey returns a key of 32 bytes made of b.
+func testKey(id string, b byte) Key {
+	return Key{ID: id, Secret: strings.Repeat(string(rune(b)), 32)}
+}
+
+type document struct {
+	ID     string   `json:"id"`
+	Email  string   `json:"email" encrypted:""`
+	Number string   `json:"phone" encrypted:"number"`
+	Lines  []string `json:"lines" encrypted:""`
+	Nested []struct {
+		City string `json:"city" encrypted:""`
+	} `json:"nested"`
+}
+
+func newCipher(t *testing.T, active string) *Cipher {
+	t.Helper()
+	c, err := New(Config{ActiveKey: active, Keys: []Key{testKey("k1", 1), testKey("k2", 2)},
+		IndexKey: testKey("index", 'i')})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestNew(t *testing.T) {
+	keys := []Key{testKey("k1", 1)}
+	index := testKey("index", 'i')
+	tests := []struct {
+		name string
+		conf Config
+		err  error
+	}{
+		{"disabled", Config{}, nil},
+		{"valid", Config{ActiveKey: "k1", Keys: keys, IndexKey: index}, nil},
+		{"unknown active key", Config{ActiveKey: "k2", Keys: keys, IndexKey: index}, ErrUnknownKey},
+		{"short key", Config{ActiveKey: "k1", Keys: []Key{{ID: "k1", Secret: "short"}}, IndexKey: index},
+			ErrInvalidKey},
+		{"missing index key", Config{ActiveKey: "k1", Keys: keys}, ErrMissingIndexKey},
+		{"short index key", Config{ActiveKey: "k1", Keys: keys, IndexKey: Key{ID: "index", Secret: "short"}},
+			ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.conf); errors.Cause(err) != tt.err {
+				t.Errorf("New failed with %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := newCipher(t, "k1")
+	original := document{ID: "u1", Email: "ada@example.com", Number: "+15555550123",
+		Lines: []string{"12 St James's Square", ""}}
+	original.Nested = append(original.Nested, struct {
+		City string `json:"city" encrypted:""`
+	}{City: "London"})
+
+	encrypted := original
+	if err := c.Encrypt(&encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if encrypted.ID != "u1" {
+		t.Errorf("untagged id was encrypted to %q", encrypted.ID)
+	}
+	for _, value := range []string{encrypted.Email, encrypted.Number, encrypted.Lines[0], encrypted.Nested[0].City} {
+		if !IsEncrypted(value) || !strings.HasPrefix(value, "enc:k1:") {
+			t.Errorf("value %q is not encrypted with k1", value)
+		}
+	}
+	if encrypted.Lines[1] != "" {
+		t.Errorf("empty line was encrypted to %q", encrypted.Lines[1])
+	}
+	if original.Lines[0] != "12 St James's Square" || original.Nested[0].City != "London" {
+		t.Errorf("encrypting a copy changed the slices of the original: %+v", original)
+	}
+
+	decrypted := encrypted
+	if err := c.Decrypt(&decrypted); err != nil {
+		t.Fatal(err)
+	}
+	if decrypted.Email != original.Email || decrypted.Number != original.Number ||
+		decrypted.Lines[0] != original.Lines[0] || decrypted.Nested[0].City != original.Nested[0].City {
+		t.Errorf("round trip gave %+v, want %+v", decrypted, original)
+	}
+}
+
+func TestEncryptValue(t *testing.T) {
+	c := newCipher(t, "k1")
+	a, _ := c.EncryptValue("k1", "emailId", "ada@example.com")
+	b, _ := c.EncryptValue("k1", "emailId", "ada@example.com")
+	if a != b {
+		t.Errorf("equal values encrypted to %s and %s, want them equal", a, b)
+	}
+	if other, _ := c.EncryptValue("k2", "emailId", "ada@example.com"); other == a {
+		t.Errorf("value encrypted equally under two keys")
+	}
+	if _, err := c.DecryptValue("userName", a); errors.Cause(err) != ErrMalformedValue {
+		t.Errorf("value of emailId decrypted as userName: %v", err)
+	}
+	if _, err := c.EncryptValue("k3", "emailId", "ada@example.com"); errors.Cause(err) != ErrUnknownKey {
+		t.Errorf("encrypting with an unknown key failed with %v, want %v", err, ErrUnknownKey)
+	}
+	tampered := a[:len(a)-2] + "AA"
+	if _, err := c.DecryptValue("emailId", tampered); errors.Cause(err) != ErrMalformedValue {
+		t.Errorf("tampered value decrypted: %v", err)
+	}
+	if plain, err := c.DecryptValue("emailId", "ada@example.com"); err != nil || plain != "ada@example.com" {
+		t.Errorf("value stored before encryption read as %q, %v", plain, err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	before, after := newCipher(t, "k1"), newCipher(t, "k2")
+	old, err := before.EncryptValue(before.ActiveKey(), "emailId", "ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := after.DecryptValue("emailId", old); err != nil || plain != "ada@example.com" {
+		t.Errorf("value of the previous key read as %q, %v", plain, err)
+	}
+	if ids := after.KeyIDs(); len(ids) != 2 || ids[0] != "k2" || ids[1] != "k1" {
+		t.Errorf("key ids are %v, want the active key first", ids)
+	}
+
+	retired, err := New(Config{ActiveKey: "k2", Keys: []Key{testKey("k2", 2)}, IndexKey: testKey("index", 'i')})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retired.DecryptValue("emailId", old); errors.Cause(err) != ErrUnknownKey {
+		t.Errorf("value of a removed key failed with %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	k1, k2 := newCipher(t, "k1"), newCipher(t, "k2")
+	index := k1.BlindIndex("emailId", "ada@example.com")
+	if k2.BlindIndex("emailId", "ada@example.com") != index {
+		t.Errorf("blind index changed with the active key")
+	}
+	if k1.BlindIndex("userName", "ada@example.com") == index {
+		t.Errorf("blind index is the same for another field")
+	}
+	if k1.BlindIndex("emailId", "grace@example.com") == index {
+		t.Errorf("blind index is the same for another value")
+	}
+	other, err := New(Config{ActiveKey: "k1", Keys: []Key{testKey("k1", 1)}, IndexKey: testKey("index", 'j')})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.BlindIndex("emailId", "ada@example.com") == index {
+		t.Errorf("blind index is the same under another index key")
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	for field, want := range map[string]bool{"id": false, "email": true, "lines": true, "nested": true, "x": false} {
+		if got := Encrypted(document{}, field); got != want {
+			t.Errorf("Encrypted(%s) = %v, want %v", field, got, want)
+		}
+	}
+}
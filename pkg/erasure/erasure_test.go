@@ -0,0 +1,73 @@
+package erasure
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	"user-details/pkg/model"
+)
+
+func certificate() model.ErasureCertificate {
+	return model.ErasureCertificate{ID: "c1", UserID: "u1", RequestID: "r1",
+		Actor:     model.Actor{AccountName: "dpo", Roles: []string{"user-details-admin"}},
+		Timestamp: time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC),
+		Steps: []model.ErasureStep{{Store: "mongo", Target: "users", Action: "deleted", Count: 1},
+			{Store: "mssql", Target: "users", Action: "skipped", Reason: "not connected"}}}
+}
+
+func TestNew(t *testing.T) {
+	if New(Config{}) != nil {
+		t.Errorf("signer made without a signing key")
+	}
+}
+
+func TestSignature(t *testing.T) {
+	signer := New(Config{SigningKey: "secret"})
+	signed := certificate()
+	if err := signer.Sign(&signed); err != nil {
+		t.Fatal(err)
+	}
+
+	// the signature is the HMAC-SHA256 of the document without it, so holders of the key can check it on their own
+	document, err := json.Marshal(certificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(document)
+	if want := "hmac-sha256:" + base64.StdEncoding.EncodeToString(mac.Sum(nil)); signed.Signature != want {
+		t.Errorf("signature is %s, want %s", signed.Signature, want)
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *model.ErasureCertificate)
+		signer *Signer
+		valid  bool
+	}{
+		{"unchanged", func(c *model.ErasureCertificate) {}, signer, true},
+		{"other user", func(c *model.ErasureCertificate) { c.UserID = "u2" }, signer, false},
+		{"other count", func(c *model.ErasureCertificate) { c.Steps[0].Count = 0 }, signer, false},
+		{"dropped step", func(c *model.ErasureCertificate) { c.Steps = c.Steps[:1] }, signer, false},
+		{"other time", func(c *model.ErasureCertificate) { c.Timestamp = c.Timestamp.Add(time.Second) }, signer,
+			false},
+		{"forged signature", func(c *model.ErasureCertificate) { c.Signature = strings.ToUpper(c.Signature) },
+			signer, false},
+		{"no signature", func(c *model.ErasureCertificate) { c.Signature = "" }, signer, false},
+		{"other key", func(c *model.ErasureCertificate) {}, New(Config{SigningKey: "other"}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := signed
+			c.Steps = append([]model.ErasureStep(nil), signed.Steps...)
+			tt.change(&c)
+			if valid := tt.signer.Verify(c); valid != tt.valid {
+				t.Errorf("certificate verified: %v, want %v", valid, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	common "vendor.lib/tng/tng-lib/http"
+)
+
+// ErrInvalidConfig is returned when the configured publisher is unusable.
+var ErrInvalidConfig = errors.New("invalid event settings")
+
+// Publishers events can be relayed with.
+const (
+	LogPublisher     = "log"
+	WebhookPublisher = "webhook"
+)
+
+// Defaults of the settings app.json leaves out.
+const (
+	// DefaultBatchSize is how many events are read from the outbox at once.
+	DefaultBatchSize = 100
+	// DefaultStreamPoll and DefaultHeartbeat are how often event streams check the outbox and send a heartbeat.
+	DefaultStreamPoll = time.Second
+	DefaultHeartbeat  = 15 * time.Second
+)
+
+// Config represents the event relay settings read from app.json.
+type Config struct {
+	// Publisher is log, the default, or webhook.
+	Publisher string `json:"publisher"`
+	// Client names the entry of clients the webhook publisher posts with, and Path the path it posts to.
+	Client string `json:"client"`
+	Path   string `json:"path"`
+	// Interval is how often, in milliseconds, the outbox is checked for events to publish. Zero disables the relay.
+	Interval  time.Duration `json:"interval-ms"`
+	BatchSize int           `json:"batch-size"`
+	// StreamPoll is how often, in milliseconds, event streams check the outbox for new events, and Heartbeat how
+	// often they send a comment keeping idle connections open.
+	StreamPoll time.Duration `json:"stream-poll-ms"`
+	Heartbeat  time.Duration `json:"heartbeat-ms"`
+}
+
+// WithDefaults returns c with the defaults of the settings it leaves out and its durations in milliseconds applied.
+func (c Config) WithDefaults() Config {
+	c.Interval *= time.Millisecond
+	c.StreamPoll *= time.Millisecond
+	c.Heartbeat *= time.Millisecond
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.StreamPoll <= 0 {
+		c.StreamPoll = DefaultStreamPoll
+	}
+	if c.Heartbeat <= 0 {
+		c.Heartbeat = DefaultHeartbeat
+	}
+	return c
+}
+
+// Publisher hands user events to other services. Events may be published more than once and consumers are expected
+// to skip the ids they saw already.
+type Publisher interface {
+	Publish(event model.UserEvent, ctx context.Context) error
+}
+
+// New creates the Publisher described by cfg. client returns the client configured under a name, nil when there is
+// none, and is called on every publication so that rotated clients are used.
+func New(cfg Config, client func(name string) *common.Client) (Publisher, error) {
+	switch cfg.Publisher {
+	case "", LogPublisher:
+		return Log{}, nil
+	case WebhookPublisher:
+		if cfg.Client == "" {
+			return nil, errors.Wrap(ErrInvalidConfig, "the webhook publisher needs a client")
+		}
+		return &Webhook{client: func() *common.Client { return client(cfg.Client) }, name: cfg.Client,
+			path: &url.URL{Path: cfg.Path}}, nil
+	}
+	return nil, errors.Wrapf(ErrInvalidConfig, "unknown publisher %q", cfg.Publisher)
+}
+
+// Log publishes events to the application log.
+type Log struct{}
+
+// Publish logs event.
+func (Log) Publish(event model.UserEvent, ctx context.Context) error {
+	log.Info().Str("eventId", event.ID).Str("type", event.Type).Str("userId", event.UserID).
+		Int64("version", event.Version).Str("operation", event.Operation).Strs("fields", event.Fields).
+		Str("requestId", event.RequestID).Msg("user event")
+	return nil
+}
+
+// Webhook publishes events by posting them as JSON documents.
+type Webhook struct {
+	client func() *common.Client
+	name   string
+	path   *url.URL
+}
+
+// Publish posts event, failing unless it is answered with a 2xx status.
+func (w *Webhook) Publish(event model.UserEvent, ctx context.Context) error {
+	client := w.client()
+	if client == nil {
+		return errors.Errorf("client %s is not configured", w.name)
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	resp, err := client.PostWithContext(ctx, w.path, headers, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "unable to publish event %s", event.ID)
+	}
+	if !common.IsSuccessful(resp.StatusCode) {
+		return errors.Errorf("event %s was answered with status %d", event.ID, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package events
+
+import "time"
+
+// Defaults of the watcher settings app.json leaves out.
+const (
+	// DefaultWatcherName identifies the resume token of the watcher.
+	DefaultWatcherName = "users"
+	// DefaultMaxAwait is how long the change stream waits for changes before the watcher reports it is caught up.
+	DefaultMaxAwait = time.Second
+	// DefaultRetry is how long the watcher waits before watching again after its change stream failed.
+	DefaultRetry = 5 * time.Second
+)
+
+// WatcherConfig represents the settings, read from app.json, of the watcher turning the writes other applications
+// make to the mongo user collection into user events.
+type WatcherConfig struct {
+	// Enabled starts the watcher. It should be enabled on a single instance, every watcher announces every change.
+	Enabled bool `json:"enabled"`
+	// Name identifies the resume token of the watcher in the watch collection.
+	Name     string        `json:"name"`
+	MaxAwait time.Duration `json:"max-await-ms"`
+	Retry    time.Duration `json:"retry-ms"`
+}
+
+// WithDefaults returns c with the defaults of the settings it leaves out and its durations in milliseconds applied.
+func (c WatcherConfig) WithDefaults() WatcherConfig {
+	c.MaxAwait *= time.Millisecond
+	c.Retry *= time.Millisecond
+	if c.Name == "" {
+		c.Name = DefaultWatcherName
+	}
+	if c.MaxAwait <= 0 {
+		c.MaxAwait = DefaultMaxAwait
+	}
+	if c.Retry <= 0 {
+		c.Retry = DefaultRetry
+	}
+	return c
+}
@@ -0,0 +1,281 @@
+package masking
+
+import (
+	"encoding/json"
+	"strings"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+// Visibility is how much of a field a caller sees.
+type Visibility string
+
+const (
+	// Full shows the field as stored.
+	Full Visibility = "full"
+	// Masked shows enough of the field to recognize it, such as j***@x.com or ***-***-1234.
+	Masked Visibility = "masked"
+	// Hidden leaves the field out.
+	Hidden Visibility = "hidden"
+)
+
+// ErrInvalidPolicy is returned when the configured policy names an unknown field or visibility.
+var ErrInvalidPolicy = errors.New("invalid masking policy")
+
+// all names the rule applying to every field a role does not name itself.
+const all = "*"
+
+// rank orders visibilities from least to most revealing.
+var rank = map[Visibility]int{Hidden: 1, Masked: 2, Full: 3}
+
+// maskers mask the fields, by json name, the policy applies to. Other fields are always shown.
+var maskers = map[string]func(u *model.User){
+	"firstName":     func(u *model.User) { u.FirstName = maskText(u.FirstName) },
+	"lastName":      func(u *model.User) { u.LastName = maskText(u.LastName) },
+	"userName":      func(u *model.User) { u.UserName = maskText(u.UserName) },
+	"emailId":       func(u *model.User) { u.EmailID = maskEmail(u.EmailID) },
+	"legacyContact": func(u *model.User) { u.LegacyContact = maskText(u.LegacyContact) },
+	"phones": func(u *model.User) {
+		for i := range u.Phones {
+			u.Phones[i] = maskPhone(u.Phones[i])
+		}
+	},
+	"emails": func(u *model.User) {
+		for i := range u.Emails {
+			u.Emails[i].Address = maskEmail(u.Emails[i].Address)
+		}
+	},
+	"addresses": func(u *model.User) {
+		for i := range u.Addresses {
+			u.Addresses[i] = maskAddress(u.Addresses[i])
+		}
+	},
+}
+
+// Rules map json field names, or * for every other field, to their visibility.
+type Rules map[string]Visibility
+
+// Config maps the chpRoles of callers to the visibility of user fields. A caller with several roles sees each field
+// as its most revealing role does. Fields none of the roles of a caller name follow Default, and are shown in full
+// when Default does not name them either.
+type Config struct {
+	Default Rules            `json:"default"`
+	Roles   map[string]Rules `json:"roles"`
+}
+
+// Policy decides which user fields callers see.
+type Policy struct {
+	config Config
+}
+
+// New creates the Policy described by cfg.
+func New(cfg Config) (*Policy, error) {
+	check := func(rules Rules) error {
+		for field, visibility := range rules {
+			if _, ok := maskers[field]; !ok && field != all {
+				return errors.Wrapf(ErrInvalidPolicy, "field %s cannot be masked", field)
+			}
+			if rank[visibility] == 0 {
+				return errors.Wrapf(ErrInvalidPolicy, "unknown visibility %q of field %s", visibility, field)
+			}
+		}
+		return nil
+	}
+	if err := check(cfg.Default); err != nil {
+		return nil, err
+	}
+	for _, rules := range cfg.Roles {
+		if err := check(rules); err != nil {
+			return nil, err
+		}
+	}
+	return &Policy{config: cfg}, nil
+}
+
+// View is the visibility of each maskable field for one caller.
+type View map[string]Visibility
+
+// For returns the view of a caller with roles.
+func (p *Policy) For(roles []string) View {
+	view := make(View, len(maskers))
+	for field := range maskers {
+		for _, role := range roles {
+			if v := p.config.Roles[role].visibility(field); rank[v] > rank[view[field]] {
+				view[field] = v
+			}
+		}
+		if view[field] == "" {
+			view[field] = p.config.Default.visibility(field)
+		}
+		if view[field] == "" {
+			view[field] = Full
+		}
+	}
+	return view
+}
+
+func (r Rules) visibility(field string) Visibility {
+	if v, ok := r[field]; ok {
+		return v
+	}
+	return r[all]
+}
+
+// User returns the JSON document of user as the view shows it.
+func (v View) User(user model.User) (json.RawMessage, error) {
+	// masks change contacts in place, which must not reach the caller's user
+	user.Phones = append([]model.Phone(nil), user.Phones...)
+	user.Emails = append([]model.Email(nil), user.Emails...)
+	user.Addresses = append([]model.Address(nil), user.Addresses...)
+	for field, mask := range maskers {
+		if v[field] == Masked {
+			mask(&user)
+		}
+	}
+	body, err := json.Marshal(user)
+	if err != nil || v.full() {
+		return body, err
+	}
+	doc := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	for field := range doc {
+		if v[field] == Hidden {
+			delete(doc, field)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// Unmask returns a copy of the view showing the masked fields among fields in full. Hidden fields stay hidden.
+func (v View) Unmask(fields ...string) View {
+	view := make(View, len(v))
+	for field, visibility := range v {
+		view[field] = visibility
+	}
+	for _, field := range fields {
+		if view[field] == Masked {
+			view[field] = Full
+		}
+	}
+	return view
+}
+
+// Visibility returns how the view shows field, Full for fields the policy does not apply to.
+func (v View) Visibility(field string) Visibility {
+	if visibility, ok := v[field]; ok {
+		return visibility
+	}
+	return Full
+}
+
+// Phone returns phone as the view shows phones.
+func (v View) Phone(phone model.Phone) model.Phone {
+	if v["phones"] == Masked {
+		return maskPhone(phone)
+	}
+	return phone
+}
+
+// Address returns address as the view shows addresses.
+func (v View) Address(address model.Address) model.Address {
+	if v["addresses"] == Masked {
+		return maskAddress(address)
+	}
+	return address
+}
+
+// Change returns change as the view shows the field it records. The values of hidden fields are left out.
+func (v View) Change(change model.Change) (model.Change, error) {
+	field := strings.TrimPrefix(change.Field, "/")
+	switch v.Visibility(field) {
+	case Hidden:
+		change.Before, change.After = nil, nil
+	case Masked:
+		var err error
+		if change.Before, err = v.maskValue(field, change.Before); err != nil {
+			return change, err
+		}
+		if change.After, err = v.maskValue(field, change.After); err != nil {
+			return change, err
+		}
+	}
+	return change, nil
+}
+
+// maskValue masks the JSON value of field by masking a user holding only that value.
+func (v View) maskValue(field string, value json.RawMessage) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	doc, err := json.Marshal(map[string]json.RawMessage{field: value})
+	if err != nil {
+		return nil, err
+	}
+	var user model.User
+	if err := json.Unmarshal(doc, &user); err != nil {
+		return nil, err
+	}
+	maskers[field](&user)
+	body, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	return fields[field], nil
+}
+
+func (v View) full() bool {
+	for _, visibility := range v {
+		if visibility != Full {
+			return false
+		}
+	}
+	return true
+}
+
+// maskText keeps the first character of s.
+func maskText(s string) string {
+	if s == "" {
+		return ""
+	}
+	r := []rune(s)
+	return string(r[0]) + "***"
+}
+
+// maskEmail keeps the first character of the local part and the domain of address, as in j***@x.com.
+func maskEmail(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return maskText(address)
+	}
+	return maskText(address[:at]) + address[at:]
+}
+
+// maskPhone keeps the last four digits of the number of phone, as in ***-***-1234.
+func maskPhone(phone model.Phone) model.Phone {
+	if n := len(phone.Number); n > 4 {
+		phone.Number = "***-***-" + phone.Number[n-4:]
+	} else if n > 0 {
+		phone.Number = "***"
+	}
+	return phone
+}
+
+// maskAddress keeps the city and state of address along with the first three digits of its ZIP code.
+func maskAddress(address model.Address) model.Address {
+	lines := make([]string, len(address.Lines))
+	for i := range lines {
+		lines[i] = "***"
+	}
+	address.Lines = lines
+	if len(address.Zip) > 3 {
+		address.Zip = address.Zip[:3] + "**"
+	}
+	return address
+}
@@ -0,0 +1,160 @@
+package masking
+
+import (
+	"encoding/json"
+	"testing"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+func TestNewRejectsInvalidPolicies(t *testing.T) {
+	tests := []struct {
+		name string
+		conf Config
+		err  error
+	}{
+		{"valid", Config{Default: Rules{"*": Masked}, Roles: map[string]Rules{"admin": {"*": Full}}}, nil},
+		{"unknown field", Config{Default: Rules{"ssn": Hidden}}, ErrInvalidPolicy},
+		{"unknown visibility", Config{Roles: map[string]Rules{"admin": {"emailId": "partial"}}}, ErrInvalidPolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.conf); errors.Cause(err) != tt.err {
+				t.Errorf("New failed with %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestFor(t *testing.T) {
+	policy, err := New(Config{
+		Default: Rules{"*": Masked, "addresses": Hidden},
+		Roles: map[string]Rules{
+			"admin":   {"*": Full},
+			"support": {"*": Full, "phones": Masked, "addresses": Masked},
+			"mailing": {"addresses": Full},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		roles []string
+		want  map[string]Visibility
+	}{
+		{"no role", nil, map[string]Visibility{"emailId": Masked, "phones": Masked, "addresses": Hidden}},
+		{"unknown role", []string{"guest"}, map[string]Visibility{"emailId": Masked, "addresses": Hidden}},
+		{"admin", []string{"admin"}, map[string]Visibility{"emailId": Full, "phones": Full, "addresses": Full}},
+		{"support", []string{"support"}, map[string]Visibility{"emailId": Full, "phones": Masked,
+			"addresses": Masked}},
+		{"role naming some fields", []string{"mailing"}, map[string]Visibility{"emailId": Masked,
+			"addresses": Full}},
+		{"most revealing role wins", []string{"support", "mailing"}, map[string]Visibility{"phones": Masked,
+			"addresses": Full}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view := policy.For(tt.roles)
+			for field, want := range tt.want {
+				if got := view.Visibility(field); got != want {
+					t.Errorf("%s is %s, want %s", field, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUser(t *testing.T) {
+	user := model.User{ID: "u1", FirstName: "Ada", LastName: "Lovelace", EmailID: "ada@example.com",
+		Phones:    []model.Phone{{Number: "+15555550123"}},
+		Addresses: []model.Address{{Lines: []string{"12 St James's Square"}, City: "London", Zip: "12345"}}}
+	tests := []struct {
+		name  string
+		rules Rules
+		check func(t *testing.T, got model.User, doc map[string]json.RawMessage)
+	}{
+		{"full", Rules{"*": Full}, func(t *testing.T, got model.User, doc map[string]json.RawMessage) {
+			if got.EmailID != user.EmailID || got.Phones[0].Number != user.Phones[0].Number {
+				t.Errorf("full view changed the user: %+v", got)
+			}
+		}},
+		{"masked", Rules{"*": Masked}, func(t *testing.T, got model.User, doc map[string]json.RawMessage) {
+			if got.FirstName != "A***" || got.EmailID != "a***@example.com" {
+				t.Errorf("masked names and email are %q and %q", got.FirstName, got.EmailID)
+			}
+			if got.Phones[0].Number != "***-***-0123" {
+				t.Errorf("masked phone is %q", got.Phones[0].Number)
+			}
+			if a := got.Addresses[0]; a.Lines[0] != "***" || a.City != "London" || a.Zip != "123**" {
+				t.Errorf("masked address is %+v", a)
+			}
+			if got.ID != user.ID {
+				t.Errorf("id %q was masked", got.ID)
+			}
+		}},
+		{"hidden", Rules{"*": Full, "addresses": Hidden, "emailId": Hidden},
+			func(t *testing.T, got model.User, doc map[string]json.RawMessage) {
+				for _, field := range []string{"addresses", "emailId"} {
+					if _, ok := doc[field]; ok {
+						t.Errorf("hidden %s is shown", field)
+					}
+				}
+				if got.FirstName != user.FirstName {
+					t.Errorf("firstName is %q, want it in full", got.FirstName)
+				}
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := New(Config{Default: tt.rules})
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := policy.For(nil).User(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got model.User
+			doc := make(map[string]json.RawMessage)
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(body, &doc); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, got, doc)
+			if user.Phones[0].Number != "+15555550123" || user.Addresses[0].Lines[0] != "12 St James's Square" {
+				t.Errorf("masking changed the contacts of the caller's user")
+			}
+		})
+	}
+}
+
+func TestChange(t *testing.T) {
+	view := View{"emailId": Masked, "addresses": Hidden, "firstName": Full}
+	tests := []struct {
+		field                 string
+		before, after         string
+		wantBefore, wantAfter string
+	}{
+		{"/emailId", `"ada@example.com"`, `"grace@example.com"`, `"a***@example.com"`, `"g***@example.com"`},
+		{"/addresses", `[{"city":"London"}]`, `[]`, ``, ``},
+		{"/firstName", `"Ada"`, `"Grace"`, `"Ada"`, `"Grace"`},
+		{"/version", `1`, `2`, `1`, `2`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			change, err := view.Change(model.Change{Field: tt.field, Before: json.RawMessage(tt.before),
+				After: json.RawMessage(tt.after)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(change.Before) != tt.wantBefore || string(change.After) != tt.wantAfter {
+				t.Errorf("change shows %s -> %s, want %s -> %s", change.Before, change.After, tt.wantBefore,
+					tt.wantAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// Ways users are read.
+const (
+	AccessRead   = "read"
+	AccessList   = "list"
+	AccessExport = "export"
+)
+
+// Access is one read of a user by a caller. Accesses are only ever appended.
+type Access struct {
+	ID     string `bson:"id" json:"id"`
+	UserID string `bson:"userId" json:"userId"`
+	// Operation is how the user was read: read, list or export.
+	Operation string    `bson:"operation" json:"operation"`
+	Timestamp time.Time `bson:"timestamp" json:"timestamp"`
+	Actor     Actor     `bson:"actor" json:"actor"`
+	RequestID string    `bson:"requestId" json:"requestId"`
+}
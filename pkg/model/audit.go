@@ -0,0 +1,71 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Operations recorded by the audit trail.
+const (
+	OpCreate         = "create"
+	OpReplace        = "replace"
+	OpPatch          = "patch"
+	OpDelete         = "delete"
+	OpRevert         = "revert"
+	OpVerifyPassword = "verify-password"
+	OpAddPhone       = "add-phone"
+	OpReplacePhone   = "replace-phone"
+	OpRemovePhone    = "remove-phone"
+	OpAddAddress     = "add-address"
+	OpReplaceAddress = "replace-address"
+	OpRemoveAddress  = "remove-address"
+	OpDetokenize     = "detokenize"
+	OpErase          = "erase"
+	OpMerge          = "merge"
+	// OpExternal marks the change events of writes other applications made to the user collection. They are not
+	// audited.
+	OpExternal = "external"
+)
+
+// AuditRecord describes one write of a user. Records are only ever appended.
+type AuditRecord struct {
+	ID        string    `bson:"id" json:"id"`
+	UserID    string    `bson:"userId" json:"userId"`
+	Operation string    `bson:"operation" json:"operation"`
+	Actor     Actor     `bson:"actor" json:"actor"`
+	RequestID string    `bson:"requestId" json:"requestId"`
+	Timestamp time.Time `bson:"timestamp" json:"timestamp"`
+	// Version is the version the write stored, or the version deleted.
+	Version int64    `bson:"version" json:"version"`
+	Changes []Change `bson:"changes" json:"changes"`
+	// Tokens lists the tokens a detokenization revealed. Detokenizations belong to no user.
+	Tokens []string `bson:"tokens,omitempty" json:"tokens,omitempty"`
+}
+
+// Actor is the caller a write was made on behalf of.
+type Actor struct {
+	AccountName string   `bson:"accountName" json:"accountName"`
+	Roles       []string `bson:"roles" json:"roles"`
+}
+
+// Change is the value of a top level user field before and after a write, as JSON. A missing value means the field
+// was absent.
+type Change struct {
+	Field  string          `bson:"field" json:"field"`
+	Before json.RawMessage `bson:"before,omitempty" json:"before,omitempty"`
+	After  json.RawMessage `bson:"after,omitempty" json:"after,omitempty"`
+}
+
+// HistoryQuery selects a page of the audit records of a user, newest first.
+type HistoryQuery struct {
+	UserID string
+	Limit  int
+	// Before is the id of the last record of the previous page, empty for the first page.
+	Before string
+}
+
+// HistoryPage is a page of audit records. Next is the cursor of the following page, empty on the last page.
+type HistoryPage struct {
+	Records []AuditRecord `json:"records"`
+	Next    string        `json:"next,omitempty"`
+}
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// Purposes users consent to.
+const (
+	PurposeMarketingEmail = "marketing-email"
+	PurposeSMS            = "sms"
+	PurposeDataSharing    = "data-sharing"
+)
+
+// Consent actions.
+const (
+	ConsentGrant  = "grant"
+	ConsentRevoke = "revoke"
+)
+
+// ConsentPurposes lists every purpose users consent to.
+var ConsentPurposes = []string{PurposeMarketingEmail, PurposeSMS, PurposeDataSharing}
+
+// Consent is one grant or revocation of the consent of a user to a purpose. Consents are only ever appended, the
+// latest one of each purpose is in effect.
+type Consent struct {
+	ID      string `bson:"id" json:"id"`
+	UserID  string `bson:"userId" json:"userId"`
+	Purpose string `bson:"purpose" json:"purpose" validate:"required,oneof=marketing-email|sms|data-sharing"`
+	Action  string `bson:"action" json:"action" validate:"required,oneof=grant|revoke"`
+	// Source is the channel the consent was given or revoked through, such as web or call-center.
+	Source        string    `bson:"source" json:"source" validate:"required,max=64"`
+	PolicyVersion string    `bson:"policyVersion" json:"policyVersion" validate:"required,max=32"`
+	Timestamp     time.Time `bson:"timestamp" json:"timestamp"`
+	Actor         Actor     `bson:"actor" json:"actor"`
+	RequestID     string    `bson:"requestId" json:"requestId"`
+}
+
+// ConsentState is the consent of a user to a purpose in effect. Purposes the user never consented to are not
+// granted.
+type ConsentState struct {
+	Purpose       string     `json:"purpose"`
+	Granted       bool       `json:"granted"`
+	GrantedAt     *time.Time `json:"grantedAt,omitempty"`
+	RevokedAt     *time.Time `json:"revokedAt,omitempty"`
+	Source        string     `json:"source,omitempty"`
+	PolicyVersion string     `json:"policyVersion,omitempty"`
+}
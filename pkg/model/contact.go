@@ -0,0 +1,79 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+)
+
+// migratedContactID is the id of the phone or email a legacy contact migrates to. It is fixed so that the entry keeps
+// its id across reads until the user is written again.
+const migratedContactID = "contact"
+
+var (
+	e164Pattern  = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+)
+
+// Phone is a phone number of a user.
+type Phone struct {
+	ID      string `bson:"id" json:"id"`
+	Type    string `bson:"type" json:"type" validate:"required,oneof=mobile|home|work|fax|other"`
+	Number  string `bson:"number" json:"number" validate:"required,e164" encrypted:""`
+	Primary bool   `bson:"primary" json:"primary"`
+}
+
+// Email is an additional email address of a user. The address users log in with is User.EmailID.
+type Email struct {
+	ID      string `bson:"id" json:"id"`
+	Type    string `bson:"type" json:"type" validate:"required,oneof=personal|work|other"`
+	Address string `bson:"address" json:"address" validate:"required,max=254,email" encrypted:""`
+	Primary bool   `bson:"primary" json:"primary"`
+}
+
+// Address is a postal address of a user.
+type Address struct {
+	ID      string   `bson:"id" json:"id"`
+	Type    string   `bson:"type" json:"type" validate:"required,oneof=home|work|mailing|other"`
+	Lines   []string `bson:"lines" json:"lines" validate:"required,max=100" encrypted:""`
+	City    string   `bson:"city" json:"city" validate:"required,max=64" encrypted:""`
+	State   string   `bson:"state" json:"state" validate:"required,state"`
+	Zip     string   `bson:"zip" json:"zip" validate:"required,zip" encrypted:""`
+	Primary bool     `bson:"primary" json:"primary"`
+}
+
+// MigrateContact moves the free-form contact of users stored before contacts were structured into Phones or
+// Emails. Contacts that are neither a phone number nor an email address are left in LegacyContact.
+func (u *User) MigrateContact() {
+	contact := strings.TrimSpace(u.LegacyContact)
+	if contact == "" {
+		u.LegacyContact = ""
+		return
+	}
+
+	if emailPattern.MatchString(contact) {
+		u.Emails = append(u.Emails, Email{ID: migratedContactID, Type: "other", Address: contact, Primary: len(u.Emails) == 0})
+		u.LegacyContact = ""
+		return
+	}
+
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, contact)
+	number := ""
+	switch {
+	case strings.HasPrefix(contact, "+"):
+		number = "+" + digits
+	case len(digits) == 10:
+		// ten digit numbers are NANP numbers without their country code
+		number = "+1" + digits
+	case len(digits) == 11 && digits[0] == '1':
+		number = "+" + digits
+	}
+	if e164Pattern.MatchString(number) {
+		u.Phones = append(u.Phones, Phone{ID: migratedContactID, Type: "other", Number: number, Primary: len(u.Phones) == 0})
+		u.LegacyContact = ""
+	}
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMigrateContact(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    User
+		phones  []Phone
+		emails  []Email
+		contact string
+	}{
+		{"no contact", User{LegacyContact: "  "}, nil, nil, ""},
+		{"email", User{LegacyContact: " ada@example.com "}, nil,
+			[]Email{{ID: "contact", Type: "other", Address: "ada@example.com", Primary: true}}, ""},
+		{"international number", User{LegacyContact: "+44 20 7946 0958"},
+			[]Phone{{ID: "contact", Type: "other", Number: "+442079460958", Primary: true}}, nil, ""},
+		{"ten digit number", User{LegacyContact: "(555) 010-0199"},
+			[]Phone{{ID: "contact", Type: "other", Number: "+15550100199", Primary: true}}, nil, ""},
+		{"eleven digit number", User{LegacyContact: "1-555-010-0199"},
+			[]Phone{{ID: "contact", Type: "other", Number: "+15550100199", Primary: true}}, nil, ""},
+		{"number next to a primary phone",
+			User{LegacyContact: "555 010 0199", Phones: []Phone{{ID: "p1", Type: "mobile", Number: "+15550100100",
+				Primary: true}}},
+			[]Phone{{ID: "p1", Type: "mobile", Number: "+15550100100", Primary: true},
+				{ID: "contact", Type: "other", Number: "+15550100199"}}, nil, ""},
+		{"short number", User{LegacyContact: "555-0199"}, nil, nil, "555-0199"},
+		{"free text", User{LegacyContact: "ask for Ada at the front desk"}, nil, nil,
+			"ask for Ada at the front desk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			user.MigrateContact()
+			if !reflect.DeepEqual(user.Phones, tt.phones) || !reflect.DeepEqual(user.Emails, tt.emails) {
+				t.Errorf("migrated to phones %+v and emails %+v, want %+v and %+v", user.Phones, user.Emails,
+					tt.phones, tt.emails)
+			}
+			if user.LegacyContact != tt.contact {
+				t.Errorf("left the contact %q, want %q", user.LegacyContact, tt.contact)
+			}
+		})
+	}
+}
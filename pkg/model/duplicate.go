@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// Signals a duplicate candidate can match on.
+const (
+	MatchName     = "name"
+	MatchPhonetic = "phonetic"
+	MatchEmail    = "email"
+	MatchPhone    = "phone"
+)
+
+// DuplicateCandidate is a user likely to be the same person as the user it was found for. Score ranges from 0 to 1.
+type DuplicateCandidate struct {
+	UserID  string   `json:"userId"`
+	Score   float64  `json:"score"`
+	Matches []string `json:"matches"`
+}
+
+// MergeRequest names the user kept by a merge and the users merged into it.
+type MergeRequest struct {
+	SurvivorID string   `json:"survivorId" validate:"required,max=64"`
+	MergedIDs  []string `json:"mergedIds" validate:"required,max=64"`
+}
+
+// Redirect records that the user stored under ID was merged into the user stored under SurvivorID. Redirects are
+// only ever appended.
+type Redirect struct {
+	ID         string    `bson:"id" json:"id"`
+	SurvivorID string    `bson:"survivorId" json:"survivorId"`
+	Timestamp  time.Time `bson:"timestamp" json:"timestamp"`
+	Actor      Actor     `bson:"actor" json:"actor"`
+	RequestID  string    `bson:"requestId" json:"requestId"`
+}
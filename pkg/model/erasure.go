@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// Actions an erasure takes on the data it touches.
+const (
+	ErasureDeleted    = "deleted"
+	ErasureAnonymized = "anonymized"
+	ErasureSkipped    = "skipped"
+)
+
+// ErasureCertificate records the permanent erasure of a user. It is signed so that it cannot be altered afterwards.
+type ErasureCertificate struct {
+	ID        string        `bson:"id" json:"id"`
+	UserID    string        `bson:"userId" json:"userId"`
+	Actor     Actor         `bson:"actor" json:"actor"`
+	RequestID string        `bson:"requestId" json:"requestId"`
+	Timestamp time.Time     `bson:"timestamp" json:"timestamp"`
+	Steps     []ErasureStep `bson:"steps" json:"steps"`
+	Signature string        `bson:"signature" json:"signature"`
+}
+
+// ErasureStep describes what an erasure did to one collection or table of a store.
+type ErasureStep struct {
+	Store  string `bson:"store" json:"store"`
+	Target string `bson:"target" json:"target"`
+	Action string `bson:"action" json:"action"`
+	Count  int64  `bson:"count" json:"count"`
+	// Reason tells why a step was skipped.
+	Reason string `bson:"reason,omitempty" json:"reason,omitempty"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// Types of the events user changes are announced with.
+const (
+	EventCreated = "user.created"
+	EventUpdated = "user.updated"
+	EventDeleted = "user.deleted"
+)
+
+// UserEvent announces a change of a user to other services. Events are appended to the outbox along with the write
+// they announce and relayed from there.
+type UserEvent struct {
+	ID string `bson:"id" json:"id"`
+	// Sequence numbers events in the order their writes were committed, from 1.
+	Sequence int64  `bson:"sequence" json:"sequence"`
+	Type     string `bson:"type" json:"type"`
+	UserID   string `bson:"userId" json:"userId"`
+	// BusinessUnit is the business unit of the user, 0 when none.
+	BusinessUnit int `bson:"businessUnit,omitempty" json:"businessUnit,omitempty"`
+	// Version is the version the write stored, or the version deleted.
+	Version   int64  `bson:"version" json:"version"`
+	Operation string `bson:"operation" json:"operation"`
+	// Fields lists the top level fields that changed as JSON pointers, like the changes of audit records.
+	Fields    []string  `bson:"fields" json:"fields"`
+	Timestamp time.Time `bson:"timestamp" json:"timestamp"`
+	RequestID string    `bson:"requestId" json:"requestId"`
+	// Published is set once the event was handed to the publisher.
+	Published *time.Time `bson:"published,omitempty" json:"-"`
+}
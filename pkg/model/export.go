@@ -0,0 +1,9 @@
+package model
+
+// Export gathers what the service holds about a user for a data subject access request.
+type Export struct {
+	User     User
+	History  []AuditRecord
+	Consents []Consent
+	Accesses []Access
+}
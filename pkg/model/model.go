@@ -1,11 +1,191 @@
 package model
 
-type User struct{
-	id string `bson:"id" json:"id"`
-	firstName string `bson:"firstName" json:"firstName"`
-	lastName string `bson:"lastName" json:"lastName"`
-	userName string `bson:"userName" json:"userName"`
-	emailId string `bson:"emailId" json:"emailId"`
-	password string `bson:"password" json:"password"` 
-	contact string `bson:"contact" json:"contact"`
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUserNotFound is returned when no user matches the requested id.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned when creating a user whose id is already taken.
+	ErrUserExists = errors.New("user already exists")
+	// ErrInvalidQuery is returned when a user listing is requested with unusable parameters.
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrVersionConflict is returned when the stored user is not at the version a write expected.
+	ErrVersionConflict = errors.New("user version does not match")
+	// ErrSnapshotNotFound is returned when no kept version of a user matches the requested version or time.
+	ErrSnapshotNotFound = errors.New("user version not found")
+	// ErrContactNotFound is returned when a user has no phone or address with the requested id.
+	ErrContactNotFound = errors.New("contact not found")
+	// ErrAmbiguousLookup is returned when a lookup expected to identify a single user matches several.
+	ErrAmbiguousLookup = errors.New("lookup matches several users")
+	// ErrMalformedBody is returned when a request body is not a JSON user document.
+	ErrMalformedBody = errors.New("malformed request body")
+	// ErrForbidden is returned when the roles of the caller do not allow the requested operation.
+	ErrForbidden = errors.New("operation not allowed for the caller")
+	// ErrWebhookNotFound is returned when no webhook matches the requested id.
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrDeliveryNotFound is returned when a webhook has no delivery with the requested id.
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+// AnyVersion lets a write apply to whichever version of a user is currently stored.
+const AnyVersion int64 = -1
+
+// UniqueFields are the json names of user fields no two users may share, regardless of case.
+var UniqueFields = []string{"userName", "emailId"}
+
+// BlindIndexes maps the bson names of the fields holding the blind indexes of unique fields, which are compared by
+// them while they are encrypted, to the json names of those fields.
+var BlindIndexes = map[string]string{"emailIndex": "emailId"}
+
+// DuplicateError is returned when a write would give a user the value of Field another user already has.
+type DuplicateError struct {
+	Field string
+}
+
+func (e DuplicateError) Error() string {
+	return e.Field + " is already taken by another user"
+}
+
+// FieldError describes why the value at Pointer, a JSON pointer into the user document, was rejected.
+type FieldError struct {
+	Pointer string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Pointer + ": " + e.Message
+}
+
+// FieldErrors aggregates every field rejected in a single request.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i := range e {
+		msgs[i] = e[i].Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// User represents the user details stored by the application. Fields tagged encrypted are stored encrypted when
+// encryption is configured, see package encryption.
+type User struct {
+	ID        string `bson:"id" json:"id" validate:"required,max=64"`
+	FirstName string `bson:"firstName" json:"firstName" validate:"required,max=64" encrypted:""`
+	LastName  string `bson:"lastName" json:"lastName" validate:"required,max=64" encrypted:""`
+	UserName  string `bson:"userName" json:"userName" validate:"required,min=3,max=32,username"`
+	EmailID   string `bson:"emailId" json:"emailId" validate:"required,max=254,email" encrypted:""`
+
+	Phones    []Phone   `bson:"phones,omitempty" json:"phones"`
+	Emails    []Email   `bson:"emails,omitempty" json:"emails"`
+	Addresses []Address `bson:"addresses,omitempty" json:"addresses"`
+	// LegacyContact is the free-form contact of users stored before contacts were structured, kept only when it
+	// could not be migrated, see MigrateContact.
+	LegacyContact string `bson:"contact,omitempty" json:"legacyContact,omitempty" encrypted:""`
+	// BusinessUnit is the business unit the user belongs to, 0 when none. Change events are streamed to the callers
+	// of the same business unit.
+	BusinessUnit int `bson:"businessUnit,omitempty" json:"businessUnit,omitempty"`
+
+	// CanonicalEmail and CanonicalUserName are the forms EmailID and UserName are looked up by.
+	CanonicalEmail    string `bson:"canonicalEmail,omitempty" json:"-" encrypted:"canonicalEmail"`
+	CanonicalUserName string `bson:"canonicalUserName,omitempty" json:"-"`
+	// EmailIndex is the blind index of EmailID in lower case, which keeps emails unique while they are encrypted. It
+	// is empty while encryption is disabled.
+	EmailIndex string `bson:"emailIndex,omitempty" json:"-"`
+	// EmailPrefixes are the blind indexes of every prefix of EmailID in lower case, which listings match email
+	// prefixes by while they are encrypted. They are empty while encryption is disabled.
+	EmailPrefixes []string `bson:"emailPrefixes,omitempty" json:"-"`
+
+	// Password is the plaintext password supplied on ingest. It is hashed into PasswordHash before the user is
+	// stored and never returned.
+	Password string `bson:"-" json:"password,omitempty" validate:"min=8,max=128"`
+	// PasswordHash is the encoded hash of the password along with its algorithm and parameters.
+	PasswordHash string `bson:"passwordHash,omitempty" json:"-"`
+	// LegacyPassword holds the plaintext password of users stored before hashing was introduced. It is hashed and
+	// removed on the next write.
+	LegacyPassword string `bson:"password,omitempty" json:"-"`
+	// FailedLogins counts the password checks that failed since the last successful one.
+	FailedLogins int `bson:"failedLogins,omitempty" json:"-"`
+	// LockedUntil is set while password checks are refused after too many failures.
+	LockedUntil *time.Time `bson:"lockedUntil,omitempty" json:"-"`
+
+	// Version is incremented on every write. Users stored before versioning was introduced are at version 0.
+	Version int64 `bson:"version" json:"version"`
+}
+
+// PasswordCheck is the outcome of verifying a password.
+type PasswordCheck struct {
+	Valid       bool       `json:"valid"`
+	LockedUntil *time.Time `json:"lockedUntil,omitempty"`
+}
+
+// UserFilter holds the exact values users are searched by. Empty fields are ignored. Phone matches users having it
+// among their phone numbers.
+type UserFilter struct {
+	FirstName         string `encrypted:"firstName"`
+	LastName          string `encrypted:"lastName"`
+	UserName          string
+	EmailID           string `encrypted:"emailId"`
+	Phone             string `encrypted:"number"`
+	CanonicalEmail    string `encrypted:"canonicalEmail"`
+	CanonicalUserName string
+}
+
+// SortFields are the user fields listings can be ordered by.
+var SortFields = []string{"id", "lastName", "userName", "emailId"}
+
+// UserQuery selects a page of users. Empty filter fields are ignored.
+type UserQuery struct {
+	LastName    string `encrypted:"lastName"`
+	UserName    string
+	EmailPrefix string
+	// Phone matches users having it among their phone numbers.
+	Phone string `encrypted:"number"`
+	// LastNames and Phones match users having any of them as last name or among their phone numbers. Encrypted
+	// datasources set them in place of LastName and Phone, to the values encrypted under every key.
+	LastNames []string
+	Phones    []string
+	// EmailPrefixIndex matches users having it among their EmailPrefixes. Encrypted datasources set it in place of
+	// EmailPrefix, to the blind index of the prefix.
+	EmailPrefixIndex string
+
+	// Sort is one of SortFields. Users sharing a sort value are ordered by id.
+	Sort       string
+	Descending bool
+	Limit      int
+	// After positions the page right behind the given user, nil starts from the beginning.
+	After *Cursor
+}
+
+// Cursor marks the last user of a page by its sort value and id.
+type Cursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d,omitempty"`
+	Value      string `json:"v"`
+	ID         string `json:"id"`
+}
+
+// UserPage is a single page of a user listing.
+type UserPage struct {
+	Users []User `json:"users"`
+	Next  string `json:"next,omitempty"`
+}
+
+// SortValue returns the value of field used to order users.
+func (u User) SortValue(field string) string {
+	switch field {
+	case "lastName":
+		return u.LastName
+	case "userName":
+		return u.UserName
+	case "emailId":
+		return u.EmailID
+	default:
+		return u.ID
+	}
 }
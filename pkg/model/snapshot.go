@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Snapshot is a user as one write left it. Snapshots never hold the password or lockout state of the user.
+type Snapshot struct {
+	ID      string `bson:"id" json:"id"`
+	UserID  string `bson:"userId" json:"userId"`
+	Version int64  `bson:"version" json:"version"`
+	// Timestamp is when the write happened, zero for the state of users written before snapshots were kept.
+	Timestamp time.Time `bson:"timestamp" json:"timestamp"`
+	// Deleted marks the write that deleted the user.
+	Deleted bool `bson:"deleted" json:"deleted"`
+	User    User `bson:"user" json:"user"`
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// Token stands for the value of a user field in payloads sent downstream. Equal values of a field share their token.
+type Token struct {
+	Token   string    `bson:"token" json:"token"`
+	Field   string    `bson:"field" json:"field"`
+	Value   string    `bson:"value" json:"value" encrypted:"token"`
+	Created time.Time `bson:"created" json:"-"`
+}
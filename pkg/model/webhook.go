@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// Statuses of webhook deliveries.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	// DeliveryDead marks the deliveries that failed every attempt, the dead letters of their webhook. They are only
+	// sent again when redelivered.
+	DeliveryDead = "dead"
+)
+
+// Webhook subscribes a URL to user events.
+type Webhook struct {
+	ID  string `bson:"id" json:"id"`
+	URL string `bson:"url" json:"url" validate:"required,max=2048"`
+	// Secret signs deliveries. It is never returned.
+	Secret string `bson:"secret" json:"secret,omitempty" validate:"required,min=16,max=256" encrypted:""`
+	// Events are the event types delivered, every type when empty.
+	Events  []string  `bson:"events" json:"events" validate:"oneof=user.created|user.updated|user.deleted"`
+	Created time.Time `bson:"created" json:"created"`
+	Updated time.Time `bson:"updated" json:"updated"`
+}
+
+// Delivery is the sending of an event to a webhook, with the log of its attempts.
+type Delivery struct {
+	ID        string    `bson:"id" json:"id"`
+	WebhookID string    `bson:"webhookId" json:"webhookId"`
+	Event     UserEvent `bson:"event" json:"event"`
+	Status    string    `bson:"status" json:"status"`
+	// Failures counts the failed attempts since the delivery was created or redelivered.
+	Failures int `bson:"failures" json:"failures"`
+	// NextAttempt is when a pending delivery is sent next.
+	NextAttempt *time.Time `bson:"nextAttempt,omitempty" json:"nextAttempt,omitempty"`
+	// Attempts logs the latest attempts, oldest first.
+	Attempts []DeliveryAttempt `bson:"attempts" json:"attempts"`
+	Created  time.Time         `bson:"created" json:"created"`
+	Updated  time.Time         `bson:"updated" json:"updated"`
+}
+
+// DeliveryAttempt is one sending of a delivery. StatusCode is 0 when no answer was received, Error tells why an
+// attempt failed.
+type DeliveryAttempt struct {
+	Timestamp  time.Time `bson:"timestamp" json:"timestamp"`
+	StatusCode int       `bson:"statusCode" json:"statusCode"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	DurationMs int64     `bson:"durationMs" json:"durationMs"`
+}
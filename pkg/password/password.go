@@ -0,0 +1,255 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// Argon2ID derives hashes with argon2id.
+	Argon2ID = "argon2id"
+	// Bcrypt hashes with bcrypt, whose hashes keep their standard $2a$<cost>$ encoding.
+	Bcrypt = "bcrypt"
+	// PBKDF2SHA256 derives hashes with PBKDF2 over HMAC-SHA256.
+	PBKDF2SHA256 = "pbkdf2-sha256"
+	// PBKDF2SHA512 derives hashes with PBKDF2 over HMAC-SHA512.
+	PBKDF2SHA512 = "pbkdf2-sha512"
+
+	defaultPBKDF2Iterations = 310000
+	defaultArgon2Iterations = 2
+	defaultArgon2Memory     = 19 * 1024
+	defaultArgon2Threads    = 1
+	defaultBcryptCost       = 12
+	defaultSaltLength       = 16
+	defaultKeyLength        = 32
+
+	defaultMaxFailures   = 5
+	defaultLockoutWindow = 15 * time.Minute
+)
+
+var (
+	// ErrUnsupportedAlgorithm is returned for algorithms that are not built into the application.
+	ErrUnsupportedAlgorithm = errors.New("unsupported password hashing algorithm")
+	// ErrMalformedHash is returned when a stored hash cannot be parsed.
+	ErrMalformedHash = errors.New("malformed password hash")
+)
+
+var digests = map[string]func() hash.Hash{
+	PBKDF2SHA256: sha256.New,
+	PBKDF2SHA512: sha512.New,
+}
+
+// Config represents the password hashing and lockout settings read from app.json.
+type Config struct {
+	Algorithm string `json:"algorithm"`
+	// Iterations is the number of PBKDF2 iterations, or of argon2id passes over memory.
+	Iterations int `json:"iterations"`
+	// Memory is the memory argon2id uses, in KiB.
+	Memory int `json:"memory-kib"`
+	// Threads is the parallelism of argon2id.
+	Threads int `json:"threads"`
+	// Cost is the bcrypt cost, bcrypt salts and sizes its keys itself.
+	Cost       int `json:"cost"`
+	SaltLength int `json:"salt-length"`
+	KeyLength  int `json:"key-length"`
+
+	// MaxFailures is the number of consecutive failed checks that locks a user.
+	MaxFailures int `json:"max-failures"`
+	// LockoutWindow is how long a locked user stays locked.
+	LockoutWindow time.Duration `json:"lockout-ms"`
+}
+
+// Hasher hashes passwords with the configured algorithm and parameters. Hashes are encoded together with their
+// algorithm, parameters and salt as $<algorithm>$i=<iterations>,l=<key length>$<salt>$<key>, argon2id hashes with
+// m=<memory>,p=<threads> among their parameters, so passwords hashed under earlier settings can still be verified.
+// bcrypt hashes keep the encoding of bcrypt.
+type Hasher struct {
+	conf Config
+}
+
+// New creates a Hasher, filling unset parameters with their defaults. The algorithm defaults to argon2id.
+func New(conf Config) (*Hasher, error) {
+	if conf.Algorithm == "" {
+		conf.Algorithm = Argon2ID
+	}
+	if !supported(conf.Algorithm) {
+		return nil, errors.Wrap(ErrUnsupportedAlgorithm, conf.Algorithm)
+	}
+	if conf.Iterations <= 0 {
+		conf.Iterations = defaultPBKDF2Iterations
+		if conf.Algorithm == Argon2ID {
+			conf.Iterations = defaultArgon2Iterations
+		}
+	}
+	if conf.Memory <= 0 {
+		conf.Memory = defaultArgon2Memory
+	}
+	if conf.Threads <= 0 {
+		conf.Threads = defaultArgon2Threads
+	}
+	if conf.Cost <= 0 {
+		conf.Cost = defaultBcryptCost
+	}
+	if conf.Algorithm == Bcrypt && (conf.Cost < bcrypt.MinCost || conf.Cost > bcrypt.MaxCost) {
+		return nil, errors.Errorf("bcrypt cost %d is out of [%d, %d]", conf.Cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if conf.SaltLength <= 0 {
+		conf.SaltLength = defaultSaltLength
+	}
+	if conf.KeyLength <= 0 {
+		conf.KeyLength = defaultKeyLength
+	}
+	if conf.MaxFailures <= 0 {
+		conf.MaxFailures = defaultMaxFailures
+	}
+	if conf.LockoutWindow <= 0 {
+		conf.LockoutWindow = defaultLockoutWindow
+	} else {
+		conf.LockoutWindow *= time.Millisecond
+	}
+	return &Hasher{conf: conf}, nil
+}
+
+// supported reports whether hashes of algorithm can be derived.
+func supported(algorithm string) bool {
+	_, ok := digests[algorithm]
+	return ok || algorithm == Argon2ID || algorithm == Bcrypt
+}
+
+// Hash returns the encoded hash of plain under a new random salt.
+func (h *Hasher) Hash(plain string) (string, error) {
+	if h.conf.Algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(plain), h.conf.Cost)
+		return string(hash), err
+	}
+	salt := make([]byte, h.conf.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	params := encoded{algorithm: h.conf.Algorithm, iterations: h.conf.Iterations, salt: salt}
+	if params.algorithm == Argon2ID {
+		params.memory, params.threads = h.conf.Memory, h.conf.Threads
+	}
+	params.key = params.derive(plain, h.conf.KeyLength)
+	return params.String(), nil
+}
+
+// Verify reports whether plain matches the encoded hash. Keys are compared in constant time.
+func (h *Hasher) Verify(plain, hash string) (bool, error) {
+	if isBcrypt(hash) {
+		switch err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain)); err {
+		case nil:
+			return true, nil
+		case bcrypt.ErrMismatchedHashAndPassword:
+			return false, nil
+		default:
+			return false, errors.Wrap(ErrMalformedHash, err.Error())
+		}
+	}
+	params, err := parse(hash)
+	if err != nil {
+		return false, err
+	}
+	key := params.derive(plain, len(params.key))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+// NeedsRehash reports whether hash was produced under other settings than the configured ones.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	if isBcrypt(hash) {
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || h.conf.Algorithm != Bcrypt || cost != h.conf.Cost
+	}
+	params, err := parse(hash)
+	if err != nil {
+		return true
+	}
+	if params.algorithm == Argon2ID && (params.memory != h.conf.Memory || params.threads != h.conf.Threads) {
+		return true
+	}
+	return params.algorithm != h.conf.Algorithm ||
+		params.iterations != h.conf.Iterations ||
+		len(params.salt) != h.conf.SaltLength ||
+		len(params.key) != h.conf.KeyLength
+}
+
+// isBcrypt reports whether hash is in the encoding of bcrypt, $2a$, $2b$ or $2y$ followed by the cost.
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2")
+}
+
+// Lockout returns the number of consecutive failures that lock a user and how long the lock lasts.
+func (h *Hasher) Lockout() (int, time.Duration) {
+	return h.conf.MaxFailures, h.conf.LockoutWindow
+}
+
+type encoded struct {
+	algorithm  string
+	iterations int
+	memory     int
+	threads    int
+	salt       []byte
+	key        []byte
+}
+
+func (e encoded) derive(plain string, keyLength int) []byte {
+	if e.algorithm == Argon2ID {
+		return argon2.IDKey([]byte(plain), e.salt, uint32(e.iterations), uint32(e.memory), uint8(e.threads),
+			uint32(keyLength))
+	}
+	return pbkdf2.Key([]byte(plain), e.salt, e.iterations, keyLength, digests[e.algorithm])
+}
+
+func (e encoded) String() string {
+	params := fmt.Sprintf("i=%d,l=%d", e.iterations, len(e.key))
+	if e.algorithm == Argon2ID {
+		params = fmt.Sprintf("i=%d,m=%d,p=%d,l=%d", e.iterations, e.memory, e.threads, len(e.key))
+	}
+	return fmt.Sprintf("$%s$%s$%s$%s", e.algorithm, params,
+		base64.RawStdEncoding.EncodeToString(e.salt), base64.RawStdEncoding.EncodeToString(e.key))
+}
+
+func parse(hash string) (encoded, error) {
+	var e encoded
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || parts[0] != "" {
+		return e, ErrMalformedHash
+	}
+	e.algorithm = parts[1]
+	if !supported(e.algorithm) || e.algorithm == Bcrypt {
+		return e, errors.Wrap(ErrUnsupportedAlgorithm, e.algorithm)
+	}
+
+	var keyLength int
+	var err error
+	if e.algorithm == Argon2ID {
+		_, err = fmt.Sscanf(parts[2], "i=%d,m=%d,p=%d,l=%d", &e.iterations, &e.memory, &e.threads, &keyLength)
+		if err == nil && (e.memory <= 0 || e.threads <= 0 || e.threads > 255) {
+			err = ErrMalformedHash
+		}
+	} else {
+		_, err = fmt.Sscanf(parts[2], "i=%d,l=%d", &e.iterations, &keyLength)
+	}
+	if err != nil || e.iterations <= 0 {
+		return e, ErrMalformedHash
+	}
+	if e.salt, err = base64.RawStdEncoding.DecodeString(parts[3]); err != nil {
+		return e, ErrMalformedHash
+	}
+	if e.key, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil || len(e.key) != keyLength {
+		return e, ErrMalformedHash
+	}
+	return e, nil
+}
@@ -0,0 +1,77 @@
+package password
+
+import "testing"
+
+func TestHashesVerifyAndRehash(t *testing.T) {
+	tests := []struct {
+		name string
+		conf Config
+	}{
+		{"argon2id", Config{Algorithm: Argon2ID, Iterations: 1, Memory: 64}},
+		{"bcrypt", Config{Algorithm: Bcrypt, Cost: 4}},
+		{"pbkdf2-sha256", Config{Algorithm: PBKDF2SHA256, Iterations: 1000}},
+		{"pbkdf2-sha512", Config{Algorithm: PBKDF2SHA512, Iterations: 1000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := New(tt.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for plain, want := range map[string]bool{"correct horse": true, "wrong": false} {
+				if valid, err := h.Verify(plain, hash); err != nil || valid != want {
+					t.Errorf("verifying %q returned %v (%v), want %v", plain, valid, err, want)
+				}
+			}
+			if h.NeedsRehash(hash) {
+				t.Errorf("hash %s needs a rehash under the settings it was hashed with", hash)
+			}
+
+			// every other algorithm verifies the hash and replaces it
+			for _, other := range tests {
+				if other.name == tt.name {
+					continue
+				}
+				o, err := New(other.conf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if valid, err := o.Verify("correct horse", hash); err != nil || !valid {
+					t.Errorf("%s failed to verify %s: %v", other.name, hash, err)
+				}
+				if !o.NeedsRehash(hash) {
+					t.Errorf("%s keeps hash %s", other.name, hash)
+				}
+			}
+		})
+	}
+}
+
+func TestChangedParametersNeedRehash(t *testing.T) {
+	h, err := New(Config{Iterations: 1, Memory: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, conf := range []Config{
+		{Iterations: 2, Memory: 64},
+		{Iterations: 1, Memory: 128},
+		{Iterations: 1, Memory: 64, Threads: 2},
+		{Iterations: 1, Memory: 64, KeyLength: 16},
+	} {
+		changed, err := New(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !changed.NeedsRehash(hash) {
+			t.Errorf("hash %s is kept under %+v", hash, conf)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MergePatchType is the media type of a JSON Merge Patch, see RFC 7396.
+	MergePatchType = "application/merge-patch+json"
+	// JSONPatchType is the media type of a JSON Patch, see RFC 6902.
+	JSONPatchType = "application/json-patch+json"
+)
+
+var (
+	// ErrInvalidPatch is returned when a patch is malformed or cannot be applied to the document.
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrTestFailed is returned when a JSON Patch test operation does not match the document.
+	ErrTestFailed = errors.New("patch test failed")
+)
+
+// Patch modifies a JSON document.
+type Patch interface {
+	Apply(doc []byte) ([]byte, error)
+}
+
+// MergePatch is a JSON Merge Patch document. Members set to null are removed from the target, objects are merged
+// recursively and every other value replaces the target member.
+type MergePatch []byte
+
+// Apply merges p into doc.
+func (p MergePatch) Apply(doc []byte) ([]byte, error) {
+	var target, patch interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(p, &patch); err != nil {
+		return nil, errors.Wrap(ErrInvalidPatch, err.Error())
+	}
+	return json.Marshal(merge(target, patch))
+}
+
+func merge(target, patch interface{}) interface{} {
+	members, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	result, ok := target.(map[string]interface{})
+	if !ok {
+		result = make(map[string]interface{})
+	}
+	for k, v := range members {
+		if v == nil {
+			delete(result, k)
+		} else {
+			result[k] = merge(result[k], v)
+		}
+	}
+	return result
+}
+
+// Operation is a single JSON Patch operation.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch is a sequence of operations applied in order. Either all of them apply or the document is left as is.
+type JSONPatch []Operation
+
+// ParseJSONPatch decodes and validates a JSON Patch document.
+func ParseJSONPatch(body []byte) (JSONPatch, error) {
+	var p JSONPatch
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, errors.Wrap(ErrInvalidPatch, err.Error())
+	}
+	for i, op := range p {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, errors.Wrapf(ErrInvalidPatch, "operation %d: %s requires a value", i, op.Op)
+			}
+		case "move", "copy":
+			if _, err := pointer(op.From); err != nil {
+				return nil, errors.Wrapf(err, "operation %d", i)
+			}
+		case "remove":
+		default:
+			return nil, errors.Wrapf(ErrInvalidPatch, "operation %d: unknown op %q", i, op.Op)
+		}
+		if _, err := pointer(op.Path); err != nil {
+			return nil, errors.Wrapf(err, "operation %d", i)
+		}
+	}
+	return p, nil
+}
+
+// Apply runs every operation of p against doc.
+func (p JSONPatch) Apply(doc []byte) ([]byte, error) {
+	var node interface{}
+	if err := json.Unmarshal(doc, &node); err != nil {
+		return nil, err
+	}
+	for i, op := range p {
+		var err error
+		node, err = op.apply(node)
+		if err != nil {
+			return nil, errors.Wrapf(err, "operation %d (%s %s)", i, op.Op, op.Path)
+		}
+	}
+	return json.Marshal(node)
+}
+
+func (op Operation) apply(doc interface{}) (interface{}, error) {
+	path, err := pointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "remove":
+		doc, _, err := remove(doc, path)
+		return doc, err
+	case "replace":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := get(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		doc, _, err = remove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "move":
+		from, _ := pointer(op.From)
+		if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errors.Wrap(ErrInvalidPatch, "cannot move a value into one of its children")
+		}
+		doc, value, err := remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "copy":
+		from, _ := pointer(op.From)
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, deepCopy(value))
+	case "test":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		actual, err := get(doc, path)
+		if err != nil {
+			return nil, errors.Wrap(ErrTestFailed, err.Error())
+		}
+		if !reflect.DeepEqual(actual, value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+	return nil, errors.Wrapf(ErrInvalidPatch, "unknown op %q", op.Op)
+}
+
+func (op Operation) value() (interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(op.Value, &value); err != nil {
+		return nil, errors.Wrap(ErrInvalidPatch, err.Error())
+	}
+	return value, nil
+}
+
+// pointer splits a JSON Pointer (RFC 6901) into its unescaped reference tokens.
+func pointer(path string) ([]string, error) {
+	if path == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, errors.Wrapf(ErrInvalidPatch, "%q is not a JSON pointer", path)
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, errors.Wrapf(ErrInvalidPatch, "member %q does not exist", token)
+			}
+			node = child
+		case []interface{}:
+			i, err := index(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, errors.Wrapf(ErrInvalidPatch, "cannot reference %q in a scalar value", token)
+		}
+	}
+	return node, nil
+}
+
+// add inserts value at path and returns the resulting node, which differs from node when an array grows.
+func add(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, last := path[0], len(path) == 1
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if last {
+			n[token] = value
+			return n, nil
+		}
+		child, ok := n[token]
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalidPatch, "member %q does not exist", token)
+		}
+		child, err := add(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+	case []interface{}:
+		if last {
+			if token == "-" {
+				return append(n, value), nil
+			}
+			i, err := index(token, len(n))
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		i, err := index(token, len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := add(n[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+	return nil, errors.Wrapf(ErrInvalidPatch, "cannot add %q to a scalar value", token)
+}
+
+// remove deletes the value at path and returns the resulting node along with the removed value.
+func remove(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.Wrap(ErrInvalidPatch, "cannot remove the whole document")
+	}
+	token, last := path[0], len(path) == 1
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, errors.Wrapf(ErrInvalidPatch, "member %q does not exist", token)
+		}
+		if last {
+			delete(n, token)
+			return n, child, nil
+		}
+		child, removed, err := remove(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = child
+		return n, removed, nil
+	case []interface{}:
+		i, err := index(token, len(n)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if last {
+			removed := n[i]
+			return append(n[:i], n[i+1:]...), removed, nil
+		}
+		child, removed, err := remove(n[i], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[i] = child
+		return n, removed, nil
+	}
+	return nil, nil, errors.Wrapf(ErrInvalidPatch, "cannot remove %q from a scalar value", token)
+}
+
+// index parses an array index token, which must lie within [0, max].
+func index(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, errors.Wrapf(ErrInvalidPatch, "invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c[k] = deepCopy(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = deepCopy(e)
+		}
+		return c
+	}
+	return value
+}
@@ -0,0 +1,153 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// equalJSON reports whether a and b hold the same JSON value.
+func equalJSON(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var av, bv interface{}
+	if err := json.Unmarshal(a, &av); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+// TestMergePatch runs the examples of RFC 7396, appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target+" "+tt.patch, func(t *testing.T) {
+			got, err := MergePatch(tt.patch).Apply([]byte(tt.target))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalJSON(t, got, []byte(tt.want)) {
+				t.Errorf("merging gave %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestJSONPatch runs the examples of RFC 6902, appendix A, and edge cases of test and move.
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+		err                    error
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`,
+			`{"baz":"qux","foo":"bar"}`, nil},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			`{"foo":["bar","qux","baz"]}`, nil},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, nil},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`,
+			`{"foo":["bar","baz"]}`, nil},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			`{"baz":"boo","foo":"bar"}`, nil},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`,
+			`[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, nil},
+		{"test success", `{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{"test failure", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", ErrTestFailed},
+		{"add nested member", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			`{"foo":"bar","child":{"grandchild":{}}}`, nil},
+		{"add to missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "",
+			ErrInvalidPatch},
+		{"escaped pointers", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`,
+			nil},
+		{"test of a string against a number", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":"10"}]`, "",
+			ErrTestFailed},
+		{"add array value", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			`{"foo":["bar",["abc","def"]]}`, nil},
+
+		{"test of a missing member", `{"a":1}`, `[{"op":"test","path":"/b","value":1}]`, "", ErrTestFailed},
+		{"test of null", `{"a":null}`, `[{"op":"test","path":"/a","value":null}]`, `{"a":null}`, nil},
+		{"test of the whole document", `{"a":[1,{"b":true}]}`,
+			`[{"op":"test","path":"","value":{"a":[1,{"b":true}]}}]`, `{"a":[1,{"b":true}]}`, nil},
+		{"test ignoring member order", `{"a":{"x":1,"y":2}}`, `[{"op":"test","path":"/a","value":{"y":2,"x":1}}]`,
+			`{"a":{"x":1,"y":2}}`, nil},
+		{"test of array order", `{"a":[1,2]}`, `[{"op":"test","path":"/a","value":[2,1]}]`, "", ErrTestFailed},
+		{"failed test undoes earlier operations", `{"a":1}`,
+			`[{"op":"replace","path":"/a","value":2},{"op":"test","path":"/a","value":1}]`, "", ErrTestFailed},
+		{"move onto itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a":{"b":1}}`, nil},
+		{"move into a child", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`, "", ErrInvalidPatch},
+		{"move to a sibling of a common prefix", `{"a":1}`, `[{"op":"move","from":"/a","path":"/ab"}]`,
+			`{"ab":1}`, nil},
+		{"move a child over its parent", `{"a":{"b":{"c":1}}}`, `[{"op":"move","from":"/a/b","path":"/a"}]`,
+			`{"a":{"c":1}}`, nil},
+		{"move from a missing member", `{"a":1}`, `[{"op":"move","from":"/b","path":"/c"}]`, "", ErrInvalidPatch},
+		{"move to the end of an array", `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/-"}]`,
+			`{"a":[2,3,1]}`, nil},
+		{"copy is independent", `{"a":{"b":1}}`,
+			`[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`,
+			`{"a":{"b":1},"c":{"b":2}}`, nil},
+		{"replace of a missing member", `{"a":1}`, `[{"op":"replace","path":"/b","value":1}]`, "", ErrInvalidPatch},
+		{"index past the end", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":2}]`, "", ErrInvalidPatch},
+		{"index with a leading zero", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/01"}]`, "", ErrInvalidPatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseJSONPatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Apply([]byte(tt.doc))
+			if errors.Cause(err) != tt.err {
+				t.Fatalf("patch failed with %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && !equalJSON(t, got, []byte(tt.want)) {
+				t.Errorf("patch gave %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONPatch(t *testing.T) {
+	tests := []struct {
+		name, patch string
+	}{
+		{"unknown op", `[{"op":"merge","path":"/a"}]`},
+		{"add without value", `[{"op":"add","path":"/a"}]`},
+		{"test without value", `[{"op":"test","path":"/a"}]`},
+		{"move without from", `[{"op":"move","from":"a","path":"/a"}]`},
+		{"relative path", `[{"op":"remove","path":"a"}]`},
+		{"not an array", `{"op":"remove","path":"/a"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseJSONPatch([]byte(tt.patch)); errors.Cause(err) != ErrInvalidPatch {
+				t.Errorf("parsing %s failed with %v, want %v", tt.patch, err, ErrInvalidPatch)
+			}
+		})
+	}
+}
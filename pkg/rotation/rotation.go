@@ -0,0 +1,70 @@
+package rotation
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// Drain is how long a replaced connection keeps serving the requests that started with it before it is closed.
+const Drain = 30 * time.Second
+
+var rotations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "credential_rotations_total",
+		Help: "Counter of credential rotations by target and result.",
+	},
+	[]string{"target", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(rotations)
+}
+
+// Record logs and counts the rotation of the credentials of target, which failed unless err is nil.
+func Record(target string, err error) {
+	if err != nil {
+		log.Error().Err(err).Str("target", target).Msg("credential rotation failed, the previous credentials stay in use")
+		rotations.WithLabelValues(target, "failure").Inc()
+		return
+	}
+	log.Info().Str("target", target).Msg("credentials rotated")
+	rotations.WithLabelValues(target, "success").Inc()
+}
+
+// Watch calls changed whenever the content of one of files changes, checking them every interval until ctx is done.
+// Files are polled rather than watched for events so that secrets mounted by symlink swaps are noticed as well.
+func Watch(ctx context.Context, interval time.Duration, files []string, changed func()) {
+	sums := checksums(files)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			next := checksums(files)
+			if !bytes.Equal(next, sums) {
+				sums = next
+				changed()
+			}
+		}
+	}
+}
+
+// checksums returns the checksums of the content of files. Files that cannot be read count as empty, so that a
+// secret is reloaded once it is written back.
+func checksums(files []string) []byte {
+	var sums []byte
+	for _, file := range files {
+		content, _ := ioutil.ReadFile(file)
+		sum := sha256.Sum256(content)
+		sums = append(sums, sum[:]...)
+	}
+	return sums
+}
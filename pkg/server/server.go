@@ -2,6 +2,7 @@ package server
 
 import (
 	router "vendor.lib/tng/tng-lib/router/mux"
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/rs/cors"
@@ -9,8 +10,17 @@ import (
 	"github.com/rs/zerolog/log"
 	"user-details/pkg/config"
 	"user-details/pkg/controller"
+	"user-details/pkg/rotation"
 	"user-details/pkg/service"
 	"net/http"
+	"reflect"
+	"time"
+)
+
+// Clients the rbac middleware looks callers up with.
+const (
+	loginService  = "login-service"
+	memberWrapper = "member-wrapper"
 )
 
 // Run configures and creates a new http.Server to be used for the application to listen on
@@ -34,8 +44,38 @@ func Run(info *router.BuildInfo) error {
 		return errors.Wrap(err, "unable to create controller")
 	}
 
+	rbac, err := newRBAC(conf)
+	if err != nil {
+		return errors.Wrap(err, "unable to create rbac middleware")
+	}
+	r := &rotator{ctrl: ctrl, auth: service.NewAuthenticator(rbac), conf: conf}
+
+	if conf.RotationInterval > 0 {
+		go rotation.Watch(context.Background(), conf.RotationInterval*time.Millisecond, config.Files, func() {
+			conf, err := config.GetConfig()
+			if err != nil {
+				log.Error().Err(err).Msg("unable to read rotated configuration, the current credentials stay in use")
+				return
+			}
+			r.rotate(conf)
+		})
+	}
+
+	if conf.Dedupe.Interval > 0 {
+		go ctrl.DetectDuplicates(context.Background())
+	}
+	if conf.Events.Interval > 0 {
+		go ctrl.RelayEvents(context.Background())
+	}
+	if conf.Webhooks.Interval > 0 {
+		go ctrl.DeliverWebhooks(context.Background())
+	}
+	if conf.Watcher.Enabled {
+		go ctrl.WatchUsers(context.Background())
+	}
+
 	router := router.NewRouter(info)
-	service.AddHandlers(router, ctrl)
+	service.AddHandlers(router, ctrl, r.auth)
 
 	srv := http.Server{
 		Addr:    fmt.Sprintf(":%d", conf.Port),
@@ -44,4 +84,44 @@ func Run(info *router.BuildInfo) error {
 
 	log.Info().Msgf("Server running %v", srv.Addr)
 	return srv.ListenAndServe()
-}
\ No newline at end of file
+}
+
+// newRBAC creates the middleware authenticating callers with the login-service and member-wrapper entries of
+// clients.
+func newRBAC(conf config.Config) (*router.RBAC, error) {
+	for _, name := range []string{loginService, memberWrapper} {
+		if _, ok := conf.Clients[name]; !ok {
+			return nil, errors.Errorf("client %s is not configured", name)
+		}
+	}
+	return router.NewRBAC(router.Config{LoginService: conf.Clients[loginService], MemberWrapper: conf.Clients[memberWrapper]})
+}
+
+// rotator applies rotated credentials to the controller and to the rbac middleware.
+type rotator struct {
+	ctrl *controller.Controller
+	auth *service.Authenticator
+	// conf is the configuration the current rbac middleware was made of
+	conf config.Config
+}
+
+// rotate applies the credentials of conf, rebuilding the rbac middleware when the settings of its clients changed.
+// It is not meant to be called concurrently.
+func (r *rotator) rotate(conf config.Config) {
+	r.ctrl.Rotate(conf)
+
+	unchanged := true
+	for _, name := range []string{loginService, memberWrapper} {
+		unchanged = unchanged && reflect.DeepEqual(conf.Clients[name], r.conf.Clients[name])
+	}
+	if unchanged {
+		return
+	}
+	rbac, err := newRBAC(conf)
+	rotation.Record("rbac", err)
+	if err != nil {
+		return
+	}
+	r.auth.Replace(rbac)
+	r.conf = conf
+}
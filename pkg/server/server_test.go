@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"user-details/pkg/config"
+	"user-details/pkg/controller"
+	"user-details/pkg/db"
+	"user-details/pkg/service"
+
+	common "vendor.lib/tng/tng-lib/http"
+	router "vendor.lib/tng/tng-lib/router/mux"
+)
+
+func TestRotateRebuildsRBAC(t *testing.T) {
+	// the fake login service and member wrapper only answer clients sending the api key they currently accept
+	var mu sync.Mutex
+	accepted := "old"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("X-Api-Key") != accepted {
+			router.RespondWithJSON(w, http.StatusUnauthorized, map[string]string{"error": "unknown api key"})
+			return
+		}
+		switch r.URL.Path {
+		case "/token":
+			router.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"chpRoles": []string{}})
+		default:
+			router.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"refData": []map[string]string{}})
+		}
+	}))
+	defer upstream.Close()
+
+	configured := func(key string) config.Config {
+		var conf config.Config
+		conf.Users = db.MemoryUsers
+		client := common.Config{URL: upstream.URL, Headers: map[string]string{"X-Api-Key": key}}
+		conf.Clients = map[string]common.Config{loginService: client, memberWrapper: client}
+		return conf
+	}
+	conf := configured("old")
+	ctrl, err := controller.New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rbac, err := newRBAC(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rot := &rotator{ctrl: ctrl, auth: service.NewAuthenticator(rbac), conf: conf}
+	r := router.NewRouter(&router.BuildInfo{Branch: "master"})
+	service.AddHandlers(r, ctrl, rot.auth)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		rotate func()
+		status int
+	}{
+		{"current key", func() {}, http.StatusOK},
+		{"key rotated upstream", func() {
+			mu.Lock()
+			defer mu.Unlock()
+			accepted = "new"
+		}, http.StatusUnauthorized},
+		{"unrelated settings rotated", func() {
+			changed := configured("old")
+			changed.Clients["events"] = common.Config{URL: upstream.URL}
+			rot.rotate(changed)
+		}, http.StatusUnauthorized},
+		{"key rotated here", func() { rot.rotate(configured("new")) }, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rotate()
+			req, err := http.NewRequest(http.MethodGet, srv.URL+"/users", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer reader")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("GET /users answered %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"user-details/pkg/audit"
+	"user-details/pkg/model"
+
+	router "vendor.lib/tng/tng-lib/router/mux"
+	gorilla "github.com/gorilla/context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// requestIDHeader carries the id correlating a request across services. Requests without one are given a new id.
+const requestIDHeader = "X-Request-ID"
+
+// callerKey holds the authenticated caller of a request in its context.
+type callerKey struct{}
+
+// middleware wraps the handlers of the routes callers must be authenticated for.
+type middleware func(next http.HandlerFunc) http.Handler
+
+// Authenticator holds the rbac middleware callers are authenticated with. The middleware is replaced when the
+// credentials of its clients are rotated.
+type Authenticator struct {
+	mu   sync.RWMutex
+	rbac *router.RBAC
+}
+
+// NewAuthenticator returns an Authenticator authenticating callers with rbac.
+func NewAuthenticator(rbac *router.RBAC) *Authenticator {
+	return &Authenticator{rbac: rbac}
+}
+
+// Replace authenticates the requests that follow with rbac. Requests in flight keep the middleware they started with.
+func (a *Authenticator) Replace(rbac *router.RBAC) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rbac = rbac
+}
+
+func (a *Authenticator) current() *router.RBAC {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.rbac
+}
+
+// authenticated returns the middleware authenticating callers with the current rbac middleware of auth, which looks
+// up their roles and business units with the login service and the member wrapper, before handing the request to
+// withActor. Callers without a valid bearer token are answered 401.
+func authenticated(auth *Authenticator) middleware {
+	return func(next http.HandlerFunc) http.Handler {
+		h := withActor(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// rbac keeps the caller in gorilla/context under the request it was given, which nothing else clears
+			defer gorilla.Clear(r)
+			auth.current().Middleware(h).ServeHTTP(w, r)
+		})
+	}
+}
+
+// withActor makes the caller and id of the request available to the audit of the writes next makes and to the
+// masking of its responses. The request id is echoed in the response.
+func withActor(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" {
+			requestID = primitive.NewObjectID().Hex()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		user := router.GetUser(r)
+		actor := model.Actor{Roles: append([]string{}, user.Roles...)}
+		if len(user.Info) > 0 {
+			actor.AccountName = user.Info[0].SAMAccountName
+		}
+		ctx := context.WithValue(audit.WithActor(r.Context(), actor, requestID), callerKey{}, user)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// caller returns the authenticated caller of r. router.GetUser does not find it once withActor gave r a new
+// context.
+func caller(r *http.Request) router.User {
+	user, _ := r.Context().Value(callerKey{}).(router.User)
+	return user
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"net/http"
+	"user-details/pkg/controller"
+
+	router "vendor.lib/tng/tng-lib/router/mux"
+	"github.com/gorilla/mux"
+)
+
+func addConsentHandlers(r *router.Router, ctrl *controller.Controller, auth middleware) {
+	r.HandleWithMetrics("/users/{id}/consents", auth(getConsents(ctrl))).Methods(http.MethodGet)
+	r.HandleWithMetrics("/users/{id}/consents", auth(recordConsent(ctrl))).Methods(http.MethodPost)
+	r.HandleWithMetrics("/users/{id}/consents/effective", auth(getEffectiveConsents(ctrl))).Methods(http.MethodGet)
+}
+
+func getConsents(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		consents, err := ctrl.UserConsents(vars["id"], r.URL.Query().Get("purpose"), ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		respondWithJSON(w, r, ctrl, http.StatusOK, consents)
+	}
+}
+
+func recordConsent(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		consent, err := ctrl.DecodeConsent(r.Body)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+
+		consent, err = ctrl.RecordConsent(vars["id"], consent, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		respondWithJSON(w, r, ctrl, http.StatusCreated, consent)
+	}
+}
+
+func getEffectiveConsents(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		states, err := ctrl.EffectiveConsents(vars["id"], ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		respondWithJSON(w, r, ctrl, http.StatusOK, states)
+	}
+}
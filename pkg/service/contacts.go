@@ -0,0 +1,240 @@
+package service
+
+import (
+	"net/http"
+	"user-details/pkg/controller"
+	"user-details/pkg/model"
+
+	router "vendor.lib/tng/tng-lib/router/mux"
+	"github.com/gorilla/mux"
+)
+
+func addContactHandlers(r *router.Router, ctrl *controller.Controller, auth middleware) {
+	r.HandleWithMetrics("/users/{id}/phones", auth(getPhones(ctrl))).Methods(http.MethodGet)
+	r.HandleWithMetrics("/users/{id}/phones", auth(addPhone(ctrl))).Methods(http.MethodPost)
+	r.HandleWithMetrics("/users/{id}/phones/{phoneId}", auth(replacePhone(ctrl))).Methods(http.MethodPut)
+	r.HandleWithMetrics("/users/{id}/phones/{phoneId}", auth(deletePhone(ctrl))).Methods(http.MethodDelete)
+	r.HandleWithMetrics("/users/{id}/addresses", auth(getAddresses(ctrl))).Methods(http.MethodGet)
+	r.HandleWithMetrics("/users/{id}/addresses", auth(addAddress(ctrl))).Methods(http.MethodPost)
+	r.HandleWithMetrics("/users/{id}/addresses/{addressId}", auth(replaceAddress(ctrl))).Methods(http.MethodPut)
+	r.HandleWithMetrics("/users/{id}/addresses/{addressId}", auth(deleteAddress(ctrl))).Methods(http.MethodDelete)
+}
+
+func getPhones(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		userDetails, err := ctrl.FindUserDetails(vars["id"], ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		phones := userDetails.Phones
+		if phones == nil {
+			phones = make([]model.Phone, 0)
+		}
+		respondWithContacts(w, r, ctrl, userDetails, phones, err)
+	}
+}
+
+func addPhone(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId := vars["id"]
+		ctx := r.Context()
+		phone, err := ctrl.DecodePhone(r.Body)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		version, ok := ifMatch(r)
+		if !ok {
+			respondWithError(w, model.ErrVersionConflict)
+			return
+		}
+
+		ur, phone, err := ctrl.AddPhone(userId, phone, version, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/users/"+userId+"/phones/"+phone.ID)
+		w.Header().Set("ETag", etag(ur.Version))
+		respondWithJSON(w, r, ctrl, http.StatusCreated, phone)
+	}
+}
+
+func replacePhone(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId, phoneId := vars["id"], vars["phoneId"]
+		ctx := r.Context()
+		phone, err := ctrl.DecodePhone(r.Body)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		if phone.ID != "" && phone.ID != phoneId {
+			router.RespondWithError(w, http.StatusBadRequest, errContactIDMismatch)
+			return
+		}
+		version, ok := ifMatch(r)
+		if !ok {
+			respondWithError(w, model.ErrVersionConflict)
+			return
+		}
+
+		ur, phone, err := ctrl.ReplacePhone(userId, phoneId, phone, version, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		w.Header().Set("ETag", etag(ur.Version))
+		respondWithJSON(w, r, ctrl, http.StatusOK, phone)
+	}
+}
+
+func deletePhone(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		version, ok := ifMatch(r)
+		if !ok {
+			respondWithError(w, model.ErrVersionConflict)
+			return
+		}
+
+		ur, err := ctrl.RemovePhone(vars["id"], vars["phoneId"], version, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		w.Header().Set("ETag", etag(ur.Version))
+		router.Respond(w, http.StatusNoContent, nil)
+	}
+}
+
+func getAddresses(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		userDetails, err := ctrl.FindUserDetails(vars["id"], ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		addresses := userDetails.Addresses
+		if addresses == nil {
+			addresses = make([]model.Address, 0)
+		}
+		respondWithContacts(w, r, ctrl, userDetails, addresses, err)
+	}
+}
+
+func addAddress(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId := vars["id"]
+		ctx := r.Context()
+		address, err := ctrl.DecodeAddress(r.Body)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		version, ok := ifMatch(r)
+		if !ok {
+			respondWithError(w, model.ErrVersionConflict)
+			return
+		}
+
+		ur, address, err := ctrl.AddAddress(userId, address, version, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/users/"+userId+"/addresses/"+address.ID)
+		w.Header().Set("ETag", etag(ur.Version))
+		respondWithJSON(w, r, ctrl, http.StatusCreated, address)
+	}
+}
+
+func replaceAddress(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId, addressId := vars["id"], vars["addressId"]
+		ctx := r.Context()
+		address, err := ctrl.DecodeAddress(r.Body)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		if address.ID != "" && address.ID != addressId {
+			router.RespondWithError(w, http.StatusBadRequest, errContactIDMismatch)
+			return
+		}
+		version, ok := ifMatch(r)
+		if !ok {
+			respondWithError(w, model.ErrVersionConflict)
+			return
+		}
+
+		ur, address, err := ctrl.ReplaceAddress(userId, addressId, address, version, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		w.Header().Set("ETag", etag(ur.Version))
+		respondWithJSON(w, r, ctrl, http.StatusOK, address)
+	}
+}
+
+func deleteAddress(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		version, ok := ifMatch(r)
+		if !ok {
+			respondWithError(w, model.ErrVersionConflict)
+			return
+		}
+
+		ur, err := ctrl.RemoveAddress(vars["id"], vars["addressId"], version, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		w.Header().Set("ETag", etag(ur.Version))
+		router.Respond(w, http.StatusNoContent, nil)
+	}
+}
+
+// respondWithContacts answers a lookup of the contacts of userDetails, honoring If-None-Match. The contacts share
+// the etag of their user.
+func respondWithContacts(w http.ResponseWriter, r *http.Request, ctrl *controller.Controller, userDetails model.User, contacts interface{}, err error) {
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(userDetails.Version))
+	if ifNoneMatch(r, userDetails.Version) {
+		router.Respond(w, http.StatusNotModified, nil)
+		return
+	}
+	respondWithJSON(w, r, ctrl, http.StatusOK, contacts)
+}
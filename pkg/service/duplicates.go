@@ -0,0 +1,60 @@
+package service
+
+import (
+	"net/http"
+	"user-details/pkg/controller"
+	"user-details/pkg/model"
+
+	router "vendor.lib/tng/tng-lib/router/mux"
+	"github.com/gorilla/mux"
+)
+
+func addDuplicateHandlers(r *router.Router, ctrl *controller.Controller, auth middleware) {
+	r.HandleWithMetrics("/users/merge", auth(mergeUsers(ctrl))).Methods(http.MethodPost)
+	r.HandleWithMetrics("/users/{id}/duplicates", auth(getDuplicates(ctrl))).Methods(http.MethodGet)
+}
+
+func getDuplicates(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		candidates, err := ctrl.UserDuplicates(vars["id"], ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		router.RespondWithJSON(w, http.StatusOK, candidates)
+	}
+}
+
+func mergeUsers(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		request, err := ctrl.DecodeMergeRequest(r.Body)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		// If-Match refers to the version of the survivor
+		version, ok := ifMatch(r)
+		if !ok {
+			respondWithError(w, model.ErrVersionConflict)
+			return
+		}
+
+		survivor, err := ctrl.MergeUsers(request, version, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/users/"+survivor.ID)
+		w.Header().Set("ETag", etag(survivor.Version))
+		respondWithJSON(w, r, ctrl, http.StatusOK, survivor)
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"user-details/pkg/model"
+)
+
+// etag renders the version of a user as a strong entity tag.
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// ifMatch returns the version the If-Match header of r requires, model.AnyVersion when the header is absent or "*".
+// ok is false when the header lists something other than a single strong user etag, which cannot match any version.
+func ifMatch(r *http.Request) (version int64, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return model.AnyVersion, true
+	}
+	unquoted, err := strconv.Unquote(header)
+	if err != nil {
+		return 0, false
+	}
+	version, err = strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version < 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// ifNoneMatch reports whether the If-None-Match header of r matches version, using weak comparison.
+func ifNoneMatch(r *http.Request, version int64) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
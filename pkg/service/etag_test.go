@@ -0,0 +1,64 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestWritesRequireTheCurrentVersion(t *testing.T) {
+	srv, roles := newTestService(t)
+	roles["admin"] = []string{adminRole}
+
+	user := map[string]interface{}{"id": "u1", "firstName": "Ada", "lastName": "Lovelace", "userName": "ada",
+		"emailId": "ada@example.com"}
+	status, header, body := callWithHeader(t, srv, http.MethodPost, "/users", "admin", nil, user)
+	if status != http.StatusCreated || header.Get("ETag") != `"1"` {
+		t.Fatalf("POST /users answered %d with etag %s, want %d with \"1\": %s", status, header.Get("ETag"),
+			http.StatusCreated, body)
+	}
+
+	// each step runs against the user the previous ones left
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		body   interface{}
+		status int
+		etag   string
+	}{
+		{"read", http.MethodGet, nil, nil, http.StatusOK, `"1"`},
+		{"read of the known version", http.MethodGet, http.Header{"If-None-Match": {`"1"`}}, nil,
+			http.StatusNotModified, `"1"`},
+		{"read of a weak tag of the known version", http.MethodGet, http.Header{"If-None-Match": {`"0", W/"1"`}},
+			nil, http.StatusNotModified, `"1"`},
+		{"replace of a stale version", http.MethodPut, http.Header{"If-Match": {`"0"`}}, user,
+			http.StatusPreconditionFailed, ""},
+		{"replace of a weak tag", http.MethodPut, http.Header{"If-Match": {`W/"1"`}}, user,
+			http.StatusPreconditionFailed, ""},
+		{"replace of the current version", http.MethodPut, http.Header{"If-Match": {`"1"`}}, user, http.StatusOK,
+			`"2"`},
+		{"patch of the replaced version", http.MethodPatch, http.Header{"If-Match": {`"1"`}},
+			map[string]string{"firstName": "Augusta"}, http.StatusPreconditionFailed, ""},
+		{"patch of any version", http.MethodPatch, http.Header{"If-Match": {"*"}},
+			map[string]string{"firstName": "Augusta"}, http.StatusOK, `"3"`},
+		{"patch without a version", http.MethodPatch, nil, map[string]string{"firstName": "Ada"}, http.StatusOK,
+			`"4"`},
+		{"read of a former version", http.MethodGet, http.Header{"If-None-Match": {`"3"`}}, nil, http.StatusOK,
+			`"4"`},
+		{"delete of a stale version", http.MethodDelete, http.Header{"If-Match": {`"3"`}}, nil,
+			http.StatusPreconditionFailed, ""},
+		{"delete of the current version", http.MethodDelete, http.Header{"If-Match": {`"4"`}}, nil,
+			http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, header, body := callWithHeader(t, srv, tt.method, "/users/u1", "admin", tt.header, tt.body)
+			if status != tt.status {
+				t.Fatalf("%s /users/u1 answered %d, want %d: %s", tt.method, status, tt.status, body)
+			}
+			if got := header.Get("ETag"); got != tt.etag {
+				t.Errorf("%s /users/u1 answered the etag %s, want %s", tt.method, got, tt.etag)
+			}
+		})
+	}
+}
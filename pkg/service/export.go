@@ -0,0 +1,184 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"user-details/pkg/controller"
+	"user-details/pkg/masking"
+	"user-details/pkg/model"
+
+	"github.com/gorilla/mux"
+)
+
+func exportUser(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		export, err := ctrl.ExportUser(vars["id"], ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+
+		archive, err := exportArchive(ctrl.ExportView(), export)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%s-export.zip"`,
+			strings.NewReplacer(`"`, "", `\`, "").Replace(export.User.ID)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(archive)
+	}
+}
+
+// exportArchive returns the zip archive of export, holding the user, its history, its consents and its accesses in
+// JSON and CSV along with a manifest. The archive shows the user fields as view lets the compliance role see them.
+func exportArchive(view masking.View, export model.Export) ([]byte, error) {
+	user, err := render(view, export.User)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := render(view, model.HistoryPage{Records: export.History})
+	if err != nil {
+		return nil, err
+	}
+	history := rendered.(model.HistoryPage).Records
+
+	userCSV, err := userRows(user.(json.RawMessage))
+	if err != nil {
+		return nil, err
+	}
+	manifest := map[string]interface{}{
+		"userId":    export.User.ID,
+		"generated": time.Now().UTC(),
+		"files": []string{"user.json", "user.csv", "history.json", "history.csv", "consents.json", "consents.csv",
+			"accesses.json", "accesses.csv"},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := []struct {
+		name string
+		body func() ([]byte, error)
+	}{
+		{"manifest.json", func() ([]byte, error) { return json.MarshalIndent(manifest, "", "  ") }},
+		{"user.json", func() ([]byte, error) { return indent(user.(json.RawMessage)) }},
+		{"user.csv", func() ([]byte, error) { return writeCSV(userCSV) }},
+		{"history.json", func() ([]byte, error) { return json.MarshalIndent(history, "", "  ") }},
+		{"history.csv", func() ([]byte, error) { return writeCSV(historyRows(history)) }},
+		{"consents.json", func() ([]byte, error) { return json.MarshalIndent(export.Consents, "", "  ") }},
+		{"consents.csv", func() ([]byte, error) { return writeCSV(consentRows(export.Consents)) }},
+		{"accesses.json", func() ([]byte, error) { return json.MarshalIndent(export.Accesses, "", "  ") }},
+		{"accesses.csv", func() ([]byte, error) { return writeCSV(accessRows(export.Accesses)) }},
+	}
+	for _, file := range files {
+		body, err := file.body()
+		if err != nil {
+			return nil, err
+		}
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(body); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// userRows lists the fields of the rendered user document by name. Values other than strings are written as JSON.
+func userRows(document json.RawMessage) ([][]string, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(document, &fields); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := [][]string{{"field", "value"}}
+	for _, name := range names {
+		rows = append(rows, []string{name, csvValue(fields[name])})
+	}
+	return rows, nil
+}
+
+// historyRows lists the changes of records, one row per change. Records without changes get a row of their own.
+func historyRows(records []model.AuditRecord) [][]string {
+	rows := [][]string{{"id", "timestamp", "operation", "actor", "requestId", "version", "field", "before", "after"}}
+	for _, record := range records {
+		row := []string{record.ID, record.Timestamp.Format(time.RFC3339Nano), record.Operation,
+			record.Actor.AccountName, record.RequestID, strconv.FormatInt(record.Version, 10)}
+		if len(record.Changes) == 0 {
+			rows = append(rows, append(row, "", "", ""))
+		}
+		for _, change := range record.Changes {
+			rows = append(rows, append(row[:len(row):len(row)], change.Field, csvValue(change.Before),
+				csvValue(change.After)))
+		}
+	}
+	return rows
+}
+
+// consentRows lists consents, one row each.
+func consentRows(consents []model.Consent) [][]string {
+	rows := [][]string{{"id", "timestamp", "purpose", "action", "source", "policyVersion", "actor", "requestId"}}
+	for _, consent := range consents {
+		rows = append(rows, []string{consent.ID, consent.Timestamp.Format(time.RFC3339Nano), consent.Purpose,
+			consent.Action, consent.Source, consent.PolicyVersion, consent.Actor.AccountName, consent.RequestID})
+	}
+	return rows
+}
+
+// accessRows lists accesses, one row each.
+func accessRows(accesses []model.Access) [][]string {
+	rows := [][]string{{"id", "timestamp", "operation", "actor", "requestId"}}
+	for _, access := range accesses {
+		rows = append(rows, []string{access.ID, access.Timestamp.Format(time.RFC3339Nano), access.Operation,
+			access.Actor.AccountName, access.RequestID})
+	}
+	return rows
+}
+
+// csvValue returns the JSON value as a CSV cell: strings unquoted, other values as JSON.
+func csvValue(value json.RawMessage) string {
+	var s string
+	if json.Unmarshal(value, &s) == nil {
+		return s
+	}
+	return string(value)
+}
+
+func writeCSV(rows [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func indent(document json.RawMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	err := json.Indent(&buf, document, "", "  ")
+	return buf.Bytes(), err
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"user-details/pkg/model"
+)
+
+func TestExportHoldsAccessesUnmasked(t *testing.T) {
+	srv, roles := newTestService(t)
+	roles["admin"] = []string{adminRole}
+	roles["reader"] = []string{}
+	roles["compliance"] = []string{complianceRole}
+
+	user := map[string]interface{}{"id": "u1", "firstName": "Ada", "lastName": "Lovelace", "userName": "ada",
+		"emailId": "ada@example.com"}
+	if status, body := call(t, srv, http.MethodPost, "/users", "admin", user); status != http.StatusCreated {
+		t.Fatalf("POST /users answered %d: %s", status, body)
+	}
+	for _, path := range []string{"/users/u1", "/users"} {
+		if status, body := call(t, srv, http.MethodGet, path, "reader", nil); status != http.StatusOK {
+			t.Fatalf("GET %s answered %d: %s", path, status, body)
+		}
+	}
+
+	if status, body := call(t, srv, http.MethodGet, "/users/u1/export", "reader", nil); status != http.StatusForbidden {
+		t.Errorf("export without the compliance role answered %d, want %d: %s", status, http.StatusForbidden, body)
+	}
+	status, body := call(t, srv, http.MethodGet, "/users/u1/export", "compliance", nil)
+	if status != http.StatusOK {
+		t.Fatalf("export answered %d: %s", status, body)
+	}
+	files := unzip(t, body)
+
+	var exported model.User
+	if err := json.Unmarshal(files["user.json"], &exported); err != nil {
+		t.Fatal(err)
+	}
+	if exported.EmailID != "ada@example.com" {
+		t.Errorf("export shows emailId %q, want it unmasked", exported.EmailID)
+	}
+
+	var accesses []model.Access
+	if err := json.Unmarshal(files["accesses.json"], &accesses); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{model.AccessRead, model.AccessList}
+	if len(accesses) != len(want) {
+		t.Fatalf("export holds accesses %+v, want the read and the listing", accesses)
+	}
+	for i, access := range accesses {
+		if access.Operation != want[i] || access.Actor.AccountName != "reader" {
+			t.Errorf("access %d is a %s by %q, want a %s by reader", i, access.Operation, access.Actor.AccountName,
+				want[i])
+		}
+	}
+}
+
+// unzip returns the files of the zip archive by name.
+func unzip(t *testing.T, archive []byte) map[string][]byte {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte, len(reader.File))
+	for _, file := range reader.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name] = body
+	}
+	return files
+}
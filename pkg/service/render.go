@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"user-details/pkg/audit"
+	"user-details/pkg/controller"
+	"user-details/pkg/masking"
+	"user-details/pkg/model"
+	"user-details/pkg/tokenization"
+
+	router "vendor.lib/tng/tng-lib/router/mux"
+	"github.com/pkg/errors"
+)
+
+var errFieldHidden = errors.New("the requested field is hidden from the caller")
+
+// respondWithJSON answers with payload, showing the user fields it holds as the masking policy lets the caller see
+// them. Every response carrying user data goes through it.
+//
+// With ?tokenize=true the values of tokenization.Fields are replaced by their tokens. Tokens reveal nothing, so they
+// are shown in place of masked values as well.
+func respondWithJSON(w http.ResponseWriter, r *http.Request, ctrl *controller.Controller, code int, payload interface{}) {
+	actor, _ := audit.ActorFromContext(r.Context())
+	view := ctrl.View(actor.Roles)
+	if r.URL.Query().Get("tokenize") == "true" {
+		var err error
+		if payload, err = tokenize(r.Context(), ctrl, payload); err != nil {
+			respondWithError(w, err)
+			return
+		}
+		view = view.Unmask(tokenization.Fields...)
+	}
+	body, err := render(view, payload)
+	if err == errFieldHidden {
+		router.RespondWithError(w, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if body == nil {
+		// the write succeeded, but the entry it stored is hidden from the caller
+		router.Respond(w, code, nil)
+		return
+	}
+	router.RespondWithJSON(w, code, body)
+}
+
+// tokenize replaces the values of tokenization.Fields in the users payload carries by their tokens.
+func tokenize(ctx context.Context, ctrl *controller.Controller, payload interface{}) (interface{}, error) {
+	switch p := payload.(type) {
+	case model.User:
+		return ctrl.TokenizeUser(p, ctx)
+	case model.UserPage:
+		users := make([]model.User, len(p.Users))
+		for i := range p.Users {
+			user, err := ctrl.TokenizeUser(p.Users[i], ctx)
+			if err != nil {
+				return nil, err
+			}
+			users[i] = user
+		}
+		p.Users = users
+		return p, nil
+	}
+	return payload, nil
+}
+
+// render returns payload as view shows it. Payloads without user data are returned as they are.
+func render(view masking.View, payload interface{}) (interface{}, error) {
+	switch p := payload.(type) {
+	case model.User:
+		return view.User(p)
+	case model.UserPage:
+		page := struct {
+			Users []json.RawMessage `json:"users"`
+			Next  string            `json:"next,omitempty"`
+		}{Users: make([]json.RawMessage, len(p.Users)), Next: p.Next}
+		for i := range p.Users {
+			user, err := view.User(p.Users[i])
+			if err != nil {
+				return nil, err
+			}
+			page.Users[i] = user
+		}
+		return page, nil
+	case model.HistoryPage:
+		records := make([]model.AuditRecord, len(p.Records))
+		for i, record := range p.Records {
+			changes := make([]model.Change, len(record.Changes))
+			for j := range record.Changes {
+				change, err := view.Change(record.Changes[j])
+				if err != nil {
+					return nil, err
+				}
+				changes[j] = change
+			}
+			record.Changes = changes
+			records[i] = record
+		}
+		p.Records = records
+		return p, nil
+	case []model.Phone:
+		if view.Visibility("phones") == masking.Hidden {
+			return nil, errFieldHidden
+		}
+		phones := make([]model.Phone, len(p))
+		for i := range p {
+			phones[i] = view.Phone(p[i])
+		}
+		return phones, nil
+	case model.Phone:
+		if view.Visibility("phones") == masking.Hidden {
+			return nil, nil
+		}
+		return view.Phone(p), nil
+	case []model.Address:
+		if view.Visibility("addresses") == masking.Hidden {
+			return nil, errFieldHidden
+		}
+		addresses := make([]model.Address, len(p))
+		for i := range p {
+			addresses[i] = view.Address(p[i])
+		}
+		return addresses, nil
+	case model.Address:
+		if view.Visibility("addresses") == masking.Hidden {
+			return nil, nil
+		}
+		return view.Address(p), nil
+	}
+	return payload, nil
+}
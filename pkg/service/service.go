@@ -1,14 +1,56 @@
 package service
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
 	"user-details/pkg/controller"
+	"user-details/pkg/model"
+	"user-details/pkg/patch"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	router "vendor.lib/tng/tng-lib/router/mux"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func AddHandlers(r *router.Router, ctrl *controller.Controller) {
+var (
+	errIDMismatch        = errors.New("user id in body does not match the request path")
+	errContactIDMismatch = errors.New("contact id in body does not match the request path")
+)
+
+// AddHandlers registers the routes of the service on r. Every route but /ready requires a caller authenticated by
+// authenticator.
+func AddHandlers(r *router.Router, ctrl *controller.Controller, authenticator *Authenticator) {
 	r.Handle("/ready", ready(ctrl)).Methods(http.MethodGet, http.MethodHead)
+
+	auth := authenticated(authenticator)
+
+	r.HandleWithMetrics("/users", auth(listUsers(ctrl))).Methods(http.MethodGet)
+	r.HandleWithMetrics("/users", auth(injectUser(ctrl))).Methods(http.MethodPost)
+	r.HandleWithMetrics("/users/by-email/{email}", auth(getUserByEmail(ctrl))).Methods(http.MethodGet)
+	r.HandleWithMetrics("/users/by-username/{name}", auth(getUserByUserName(ctrl))).Methods(http.MethodGet)
+	r.HandleWithMetrics("/users/events", auth(streamUserEvents(ctrl))).Methods(http.MethodGet)
+	r.HandleWithMetrics("/users/{id}", auth(getUserDetails(ctrl))).Methods(http.MethodGet)
+	r.HandleWithMetrics("/users/{id}", auth(replaceUser(ctrl))).Methods(http.MethodPut)
+	r.HandleWithMetrics("/users/{id}", auth(patchUser(ctrl))).Methods(http.MethodPatch)
+	r.HandleWithMetrics("/users/{id}", auth(deleteUser(ctrl))).Methods(http.MethodDelete)
+	r.HandleWithMetrics("/users/{id}/history", auth(userHistory(ctrl))).Methods(http.MethodGet)
+	r.HandleWithMetrics("/users/{id}/export", auth(exportUser(ctrl))).Methods(http.MethodGet)
+	r.HandleWithMetrics("/users/{id}/revert", auth(revertUser(ctrl))).Methods(http.MethodPost)
+	r.HandleWithMetrics("/users/{id}/verify-password", auth(verifyPassword(ctrl))).Methods(http.MethodPost)
+	r.HandleWithMetrics("/detokenize", auth(detokenize(ctrl))).Methods(http.MethodPost)
+	addContactHandlers(r, ctrl, auth)
+	addConsentHandlers(r, ctrl, auth)
+	addDuplicateHandlers(r, ctrl, auth)
+	addWebhookHandlers(r, ctrl, auth)
 }
 
 func ready(ctrl *controller.Controller) http.HandlerFunc {
@@ -23,29 +65,399 @@ func ready(ctrl *controller.Controller) http.HandlerFunc {
 	}
 }
 
-func getUserDetails(ctrl controller.Ctrl) http.HandlerFunc{
-	return func(w http.ResponseWriter, r *http.Request){
+func getUserDetails(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		userId := vars["id"]
-		ctx := r.context()
+		ctx := r.Context()
+		if asOf := r.URL.Query().Get("asOf"); asOf != "" {
+			at, err := time.Parse(time.RFC3339Nano, asOf)
+			if err != nil {
+				respondWithError(w, errors.Wrap(model.ErrInvalidQuery, "asOf must be an RFC 3339 timestamp"))
+				return
+			}
+			// earlier versions are not what If-Match and If-None-Match refer to, so they carry no etag
+			userDetails, err := ctrl.FindUserAsOf(userId, at, ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				respondWithError(w, err)
+				return
+			}
+			respondWithJSON(w, r, ctrl, http.StatusOK, userDetails)
+			return
+		}
 		userDetails, err := ctrl.FindUserDetails(userId, ctx)
-		if ctx.Err() != nil{
+		if errors.Cause(err) == model.ErrUserNotFound {
+			// ids of merged users lead to the user they were merged into
+			if survivorId, merr := ctrl.MergedInto(userId, ctx); merr == nil {
+				location := url.URL{Path: "/users/" + survivorId, RawQuery: r.URL.RawQuery}
+				http.Redirect(w, r, location.String(), http.StatusPermanentRedirect)
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		respondWithUser(w, r, ctrl, userDetails, err)
+	}
+}
+
+func getUserByEmail(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		userDetails, err := ctrl.FindUserByEmail(vars["email"], ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		respondWithUser(w, r, ctrl, userDetails, err)
+	}
+}
+
+func getUserByUserName(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		userDetails, err := ctrl.FindUserByUserName(vars["name"], ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		respondWithUser(w, r, ctrl, userDetails, err)
+	}
+}
+
+// respondWithUser answers a user lookup, honoring If-None-Match.
+func respondWithUser(w http.ResponseWriter, r *http.Request, ctrl *controller.Controller, userDetails model.User, err error) {
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(userDetails.Version))
+	if ifNoneMatch(r, userDetails.Version) {
+		router.Respond(w, http.StatusNotModified, nil)
+		return
+	}
+	respondWithJSON(w, r, ctrl, http.StatusOK, userDetails)
+}
+
+func listUsers(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		query := model.UserQuery{
+			LastName:    params.Get("lastName"),
+			UserName:    params.Get("userName"),
+			EmailPrefix: params.Get("emailId"),
+			Phone:       params.Get("phone"),
+			Sort:        strings.TrimPrefix(params.Get("sort"), "-"),
+			Descending:  strings.HasPrefix(params.Get("sort"), "-"),
+		}
+		if limit := params.Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil {
+				router.RespondWithError(w, http.StatusBadRequest, errors.Wrap(err, "invalid limit"))
+				return
+			}
+			query.Limit = n
+		}
+
+		ctx := r.Context()
+		page, err := ctrl.ListUsers(query, params.Get("cursor"), ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		if page.Next != "" {
+			params.Set("cursor", page.Next)
+			next := url.URL{Path: r.URL.Path, RawQuery: params.Encode()}
+			page.Next = next.String()
+			w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, page.Next))
+		}
+		respondWithJSON(w, r, ctrl, http.StatusOK, page)
+	}
+}
+
+func injectUser(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		ur, err := ctrl.DecodeUser(r.Body)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		if ur.ID == "" {
+			ur.ID = primitive.NewObjectID().Hex()
+		}
+		ur, err = ctrl.CreateUser(ur, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/users/"+ur.ID)
+		w.Header().Set("ETag", etag(ur.Version))
+		respondWithJSON(w, r, ctrl, http.StatusCreated, ur)
+	}
+}
+
+func replaceUser(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId := vars["id"]
+		ctx := r.Context()
+		ur, err := ctrl.DecodeUser(r.Body)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		if ur.ID != "" && ur.ID != userId {
+			router.RespondWithError(w, http.StatusBadRequest, errIDMismatch)
+			return
+		}
+		ur.ID = userId
+		version, ok := ifMatch(r)
+		if !ok {
+			respondWithError(w, model.ErrVersionConflict)
+			return
+		}
+
+		ur, created, err := ctrl.ReplaceUser(ur, version, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		code := http.StatusOK
+		if created {
+			code = http.StatusCreated
+			w.Header().Set("Location", "/users/"+userId)
+		}
+		w.Header().Set("ETag", etag(ur.Version))
+		respondWithJSON(w, r, ctrl, code, ur)
+	}
+}
+
+func patchUser(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId := vars["id"]
+		ctx := r.Context()
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			router.RespondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		var p patch.Patch
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case patch.JSONPatchType:
+			p, err = patch.ParseJSONPatch(body)
+			if err != nil {
+				router.RespondWithError(w, http.StatusBadRequest, err)
+				return
+			}
+		case patch.MergePatchType, "application/json", "":
+			p = patch.MergePatch(body)
+		default:
+			w.Header().Set("Accept-Patch", patch.MergePatchType+", "+patch.JSONPatchType)
+			router.RespondWithError(w, http.StatusUnsupportedMediaType, errors.Errorf("unsupported patch type %q", mediaType))
+			return
+		}
+
+		version, ok := ifMatch(r)
+		if !ok {
+			respondWithError(w, model.ErrVersionConflict)
 			return
 		}
+
+		ur, err := ctrl.PatchUser(userId, p, version, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		w.Header().Set("ETag", etag(ur.Version))
+		respondWithJSON(w, r, ctrl, http.StatusOK, ur)
 	}
 }
 
-func injectUser(ctrl Controller.Ctrl) http.HandlerFunc{
-	return func(w http.ResponseWriter, r *http.Request){
-		var ur model.User
+func revertUser(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId := vars["id"]
 		ctx := r.Context()
-		err := json.NewDecoder(r.Body).Decode(&ur)
+		toVersion, err := strconv.ParseInt(r.URL.Query().Get("version"), 10, 64)
+		if err != nil || toVersion < 0 {
+			respondWithError(w, errors.Wrap(model.ErrInvalidQuery, "version must be a user version"))
+			return
+		}
+		version, ok := ifMatch(r)
+		if !ok {
+			respondWithError(w, model.ErrVersionConflict)
+			return
+		}
+
+		ur, err := ctrl.RevertUser(userId, toVersion, version, ctx)
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
-			return err
+			respondWithError(w, err)
+			return
+		}
+		w.Header().Set("ETag", etag(ur.Version))
+		respondWithJSON(w, r, ctrl, http.StatusOK, ur)
+	}
+}
+
+func userHistory(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		params := r.URL.Query()
+		limit := 0
+		if l := params.Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil {
+				router.RespondWithError(w, http.StatusBadRequest, errors.Wrap(err, "invalid limit"))
+				return
+			}
+			limit = n
 		}
-		id, err := ctrl.IngestUser(ur, ctx)
+
+		ctx := r.Context()
+		page, err := ctrl.UserHistory(vars["id"], limit, params.Get("cursor"), ctx)
 		if ctx.Err() != nil {
 			return
 		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		if page.Next != "" {
+			params.Set("cursor", page.Next)
+			next := url.URL{Path: r.URL.Path, RawQuery: params.Encode()}
+			page.Next = next.String()
+			w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, page.Next))
+		}
+		respondWithJSON(w, r, ctrl, http.StatusOK, page)
+	}
+}
+
+func deleteUser(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId := vars["id"]
+		ctx := r.Context()
+		version, ok := ifMatch(r)
+		if !ok {
+			respondWithError(w, model.ErrVersionConflict)
+			return
+		}
+
+		switch mode := r.URL.Query().Get("mode"); mode {
+		case "":
+		case "erase":
+			certificate, err := ctrl.EraseUser(userId, version, ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				respondWithError(w, err)
+				return
+			}
+			router.RespondWithJSON(w, http.StatusOK, certificate)
+			return
+		default:
+			router.RespondWithError(w, http.StatusBadRequest, errors.Errorf("unknown delete mode %q", mode))
+			return
+		}
+
+		err := ctrl.RemoveUser(userId, version, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		router.Respond(w, http.StatusNoContent, nil)
+	}
+}
+
+func verifyPassword(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId := vars["id"]
+		ctx := r.Context()
+		var body struct {
+			Password string `json:"password"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			router.RespondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		if body.Password == "" {
+			router.RespondWithError(w, http.StatusBadRequest, errors.New("password is required"))
+			return
+		}
+
+		check, err := ctrl.VerifyPassword(userId, body.Password, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		router.RespondWithJSON(w, http.StatusOK, check)
+	}
+}
+
+// respondWithError maps controller errors onto their http status codes.
+func respondWithError(w http.ResponseWriter, err error) {
+	if fieldErrs, ok := errors.Cause(err).(model.FieldErrors); ok {
+		errs := make(router.Errors, len(fieldErrs))
+		for i := range fieldErrs {
+			errs[i] = fieldErrs[i]
+		}
+		router.RespondWithErrors(w, http.StatusUnprocessableEntity, errs)
+		return
+	}
+	if dup, ok := errors.Cause(err).(model.DuplicateError); ok {
+		router.RespondWithErrors(w, http.StatusConflict, router.Errors{
+			model.FieldError{Pointer: "/" + dup.Field, Message: "is already taken by another user"},
+		})
+		return
+	}
+
+	switch errors.Cause(err) {
+	case model.ErrUserNotFound, model.ErrContactNotFound, model.ErrSnapshotNotFound, model.ErrWebhookNotFound,
+		model.ErrDeliveryNotFound:
+		router.RespondWithError(w, http.StatusNotFound, err)
+	case model.ErrUserExists, model.ErrAmbiguousLookup:
+		router.RespondWithError(w, http.StatusConflict, err)
+	case model.ErrInvalidQuery, model.ErrMalformedBody, patch.ErrInvalidPatch:
+		router.RespondWithError(w, http.StatusBadRequest, err)
+	case patch.ErrTestFailed:
+		router.RespondWithError(w, http.StatusConflict, err)
+	case model.ErrForbidden:
+		router.RespondWithError(w, http.StatusForbidden, err)
+	case model.ErrVersionConflict:
+		router.RespondWithError(w, http.StatusPreconditionFailed, err)
+	default:
+		log.Error().Stack().Caller().Err(err).Send()
+		router.RespondWithError(w, http.StatusInternalServerError, err)
 	}
 }
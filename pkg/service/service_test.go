@@ -0,0 +1,238 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-details/pkg/config"
+	"user-details/pkg/controller"
+	"user-details/pkg/db"
+	"user-details/pkg/masking"
+	"user-details/pkg/tokenization"
+	"user-details/pkg/webhook"
+
+	common "vendor.lib/tng/tng-lib/http"
+	router "vendor.lib/tng/tng-lib/router/mux"
+)
+
+const (
+	// adminRole is the role the test configuration lets see and detokenize everything.
+	adminRole = "user-details-admin"
+	// complianceRole is the role the test configuration lets export users, which it shows in full.
+	complianceRole = "user-details-compliance"
+)
+
+// newTestService returns a server of the routes of the package, serving users from memory, along with the roles the
+// fake login service grants to the bearer token of each caller. configure changes the test configuration before the
+// controller is made of it.
+func newTestService(t *testing.T, configure ...func(conf *config.Config)) (*httptest.Server, map[string][]string) {
+	t.Helper()
+	roles := make(map[string][]string)
+	// the fake login service and member wrapper the rbac middleware looks callers up with
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			var body struct {
+				Token string `json:"token"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			granted, ok := roles[body.Token]
+			if !ok {
+				router.RespondWithJSON(w, http.StatusUnauthorized, map[string]string{"error": "unknown token"})
+				return
+			}
+			router.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"userInfo": []map[string]string{{"sAMAccountName": body.Token}},
+				"chpRoles": granted,
+			})
+		case "/v2/umvrefdata/businessline", "/v2/umvrefdata/businessunit":
+			router.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"refData": []map[string]string{{"code": "7", "name": "medicaid"}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	var conf config.Config
+	conf.Users = db.MemoryUsers
+	conf.Tokenization = tokenization.Config{DetokenizeRoles: []string{adminRole}}
+	conf.Webhooks = webhook.Config{ManageRoles: []string{adminRole}}
+	conf.ComplianceRole = complianceRole
+	conf.Masking.Default = masking.Rules{"emailId": masking.Masked}
+	conf.Masking.Roles = map[string]masking.Rules{adminRole: {"*": masking.Full}, complianceRole: {"*": masking.Full}}
+	for _, c := range configure {
+		c(&conf)
+	}
+	ctrl, err := controller.New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstreamConfig := common.Config{URL: upstream.URL}
+	rbac, err := router.NewRBAC(router.Config{LoginService: upstreamConfig, MemberWrapper: upstreamConfig})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// off master the router serves swagger through http.DefaultServeMux, which takes a route only once
+	r := router.NewRouter(&router.BuildInfo{Branch: "master"})
+	AddHandlers(r, ctrl, NewAuthenticator(rbac))
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv, roles
+}
+
+// call sends a request with body, as JSON unless it is nil, on behalf of the caller holding token, none when it is
+// empty, and returns the status and body of the response.
+func call(t *testing.T, srv *httptest.Server, method, path, token string, body interface{}) (int, []byte) {
+	t.Helper()
+	status, _, respBody := callWithHeader(t, srv, method, path, token, nil, body)
+	return status, respBody
+}
+
+// callWithHeader is call sending header along with the request, which also returns the header of the response.
+func callWithHeader(t *testing.T, srv *httptest.Server, method, path, token string, header http.Header,
+	body interface{}) (int, http.Header, []byte) {
+	t.Helper()
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header, respBody
+}
+
+func TestRoutesRequireAuthentication(t *testing.T) {
+	srv, roles := newTestService(t)
+	roles["reader"] = []string{}
+
+	tests := []struct {
+		name   string
+		token  string
+		path   string
+		status int
+	}{
+		{"no token", "", "/users", http.StatusUnauthorized},
+		{"unknown token", "forged", "/users", http.StatusUnauthorized},
+		{"known token", "reader", "/users", http.StatusOK},
+		// the memory datasource has no mongo to ping, so readiness fails, but not for want of a token
+		{"readiness needs no token", "", "/ready", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := call(t, srv, http.MethodGet, tt.path, tt.token, nil)
+			if status != tt.status {
+				t.Errorf("GET %s answered %d, want %d: %s", tt.path, status, tt.status, strings.TrimSpace(string(body)))
+			}
+		})
+	}
+}
+
+func TestUsersAreMaskedByRole(t *testing.T) {
+	srv, roles := newTestService(t)
+	roles["admin"] = []string{adminRole}
+	roles["support"] = []string{"user-details-support"}
+
+	user := map[string]interface{}{"id": "u1", "firstName": "Ada", "lastName": "Lovelace", "userName": "ada",
+		"emailId": "ada@example.com"}
+	if status, body := call(t, srv, http.MethodPost, "/users", "admin", user); status != http.StatusCreated {
+		t.Fatalf("POST /users answered %d: %s", status, body)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		email string
+	}{
+		{"role shown everything", "admin", "ada@example.com"},
+		{"role without rules", "support", "a***@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := call(t, srv, http.MethodGet, "/users/u1", tt.token, nil)
+			if status != http.StatusOK {
+				t.Fatalf("GET /users/u1 answered %d: %s", status, body)
+			}
+			var got struct {
+				FirstName string `json:"firstName"`
+				EmailID   string `json:"emailId"`
+			}
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.EmailID != tt.email || got.FirstName != "Ada" {
+				t.Errorf("GET /users/u1 showed %s, want the email %s and the first name in full", body, tt.email)
+			}
+		})
+	}
+}
+
+func TestTakenUserNamesAndEmailsConflict(t *testing.T) {
+	srv, roles := newTestService(t)
+	roles["admin"] = []string{adminRole}
+
+	ada := map[string]interface{}{"id": "u1", "firstName": "Ada", "lastName": "Lovelace", "userName": "ada",
+		"emailId": "ada@example.com"}
+	if status, body := call(t, srv, http.MethodPost, "/users", "admin", ada); status != http.StatusCreated {
+		t.Fatalf("POST /users answered %d: %s", status, body)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		userName string
+		emailId  string
+		status   int
+		pointer  string
+	}{
+		{"user name in another case", http.MethodPost, "/users", "ADA", "grace@navy.mil", http.StatusConflict,
+			"/userName"},
+		{"email in another case", http.MethodPost, "/users", "grace", "Ada@Example.com", http.StatusConflict,
+			"/emailId"},
+		{"values of the same user", http.MethodPut, "/users/u1", "Ada", "ADA@example.com", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := map[string]interface{}{"firstName": "Grace", "lastName": "Hopper", "userName": tt.userName,
+				"emailId": tt.emailId}
+			if tt.method == http.MethodPost {
+				user["id"] = "u2"
+			}
+			status, body := call(t, srv, tt.method, tt.path, "admin", user)
+			if status != tt.status {
+				t.Fatalf("%s %s answered %d, want %d: %s", tt.method, tt.path, status, tt.status, body)
+			}
+			if tt.pointer != "" && !strings.Contains(string(body), `"`+tt.pointer+": ") {
+				t.Errorf("%s %s answered %s, want an error at %s", tt.method, tt.path, body, tt.pointer)
+			}
+		})
+	}
+}
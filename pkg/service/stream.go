@@ -0,0 +1,120 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+	"user-details/pkg/controller"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// retryMs is how long, in milliseconds, event stream clients wait before reconnecting.
+const retryMs = 3000
+
+// streamUserEvents sends the change events of the users of the caller's business units as server-sent events until
+// the client goes away. Each event is identified by its sequence, so reconnecting clients resume after the last
+// event they received with Last-Event-ID, or the lastEventId parameter.
+func streamUserEvents(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		sequence, err := lastEventID(r, ctrl)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		units := []int(caller(r).BusinessUnits)
+		events, sequence, err := ctrl.UserEvents(units, sequence, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			respondWithError(w, errors.New("the connection cannot stream events"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// proxies buffering responses would hold events back
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: %d\n\n", retryMs)
+
+		poll, heartbeat := ctrl.EventStreamIntervals()
+		polls := time.NewTicker(poll)
+		defer polls.Stop()
+		heartbeats := time.NewTicker(heartbeat)
+		defer heartbeats.Stop()
+		// clients resuming far behind are caught up without waiting for the next poll
+		behind := true
+		for {
+			for _, event := range events {
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+			events = nil
+
+			if !behind {
+				select {
+				case <-ctx.Done():
+					return
+				case <-heartbeats.C:
+					if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+						return
+					}
+					continue
+				case <-polls.C:
+				}
+			} else if ctx.Err() != nil {
+				return
+			}
+			read := sequence
+			events, sequence, err = ctrl.UserEvents(units, sequence, ctx)
+			behind = sequence != read
+			if err != nil {
+				// the client reconnects and resumes after the last event it received
+				if ctx.Err() == nil {
+					log.Error().Stack().Caller().Err(err).Msg("user event stream failed")
+				}
+				return
+			}
+		}
+	}
+}
+
+// lastEventID returns the sequence of the last event the client received, the latest event when it names none.
+func lastEventID(r *http.Request, ctrl *controller.Controller) (int64, error) {
+	id := r.Header.Get("Last-Event-ID")
+	if id == "" {
+		id = r.URL.Query().Get("lastEventId")
+	}
+	if id == "" {
+		return ctrl.LastEventSequence(r.Context())
+	}
+	sequence, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || sequence < 0 {
+		return 0, errors.Wrap(model.ErrInvalidQuery, "Last-Event-ID must be the id of an event")
+	}
+	return sequence, nil
+}
+
+func writeEvent(w io.Writer, event model.UserEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Sequence, event.Type, data)
+	return err
+}
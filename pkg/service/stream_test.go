@@ -0,0 +1,88 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"user-details/pkg/config"
+)
+
+func TestStreamUserEventsOfBusinessUnits(t *testing.T) {
+	srv, roles := newTestService(t, func(conf *config.Config) {
+		conf.Events.StreamPoll, conf.Events.Heartbeat = 10, 50
+	})
+	roles["admin"] = []string{adminRole}
+	roles["dashboard"] = []string{}
+
+	// the fake member wrapper gives every caller business unit 7, the events of users of other units or of none are
+	// not streamed
+	for i, unit := range []int{7, 8, 0, 7} {
+		user := map[string]interface{}{"id": fmt.Sprintf("u%d", i+1), "firstName": "Ada", "lastName": "Lovelace",
+			"userName": fmt.Sprintf("ada%d", i+1), "emailId": fmt.Sprintf("ada%d@example.com", i+1),
+			"businessUnit": unit}
+		if status, body := call(t, srv, http.MethodPost, "/users", "admin", user); status != http.StatusCreated {
+			t.Fatalf("POST /users answered %d: %s", status, body)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		want        []string
+	}{
+		{"from the first event", "0", []string{"1 user.created", "4 user.created"}},
+		{"resumed after the first event", "1", []string{"4 user.created"}},
+		{"resumed after the last event", "4", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/users/events", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer dashboard")
+			req.Header.Set("Last-Event-ID", tt.lastEventID)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("GET /users/events answered %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+			if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+				t.Errorf("GET /users/events answered %s, want text/event-stream", got)
+			}
+
+			// every event due is sent before the stream idles and sends its first heartbeat
+			var got []string
+			var id string
+			lines := bufio.NewScanner(resp.Body)
+			for lines.Scan() {
+				line := lines.Text()
+				if line == ": heartbeat" {
+					break
+				}
+				switch {
+				case strings.HasPrefix(line, "id: "):
+					id = strings.TrimPrefix(line, "id: ")
+				case strings.HasPrefix(line, "event: "):
+					got = append(got, id+" "+strings.TrimPrefix(line, "event: "))
+				}
+			}
+			if err := lines.Err(); err != nil {
+				t.Fatalf("stream ended before a heartbeat: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("streamed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
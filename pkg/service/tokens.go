@@ -0,0 +1,33 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"user-details/pkg/controller"
+
+	router "vendor.lib/tng/tng-lib/router/mux"
+)
+
+func detokenize(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		var body struct {
+			Tokens []string `json:"tokens"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			router.RespondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		tokens, err := ctrl.Detokenize(body.Tokens, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		router.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"tokens": tokens})
+	}
+}
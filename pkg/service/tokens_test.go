@@ -0,0 +1,67 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestDetokenize(t *testing.T) {
+	srv, roles := newTestService(t)
+	roles["admin"] = []string{adminRole}
+	roles["support"] = []string{"user-details-support"}
+
+	user := map[string]interface{}{"id": "u1", "firstName": "Ada", "lastName": "Lovelace", "userName": "ada",
+		"emailId": "ada@example.com"}
+	if status, body := call(t, srv, http.MethodPost, "/users", "admin", user); status != http.StatusCreated {
+		t.Fatalf("POST /users answered %d: %s", status, body)
+	}
+	status, body := call(t, srv, http.MethodGet, "/users/u1?tokenize=true", "admin", nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET /users/u1?tokenize=true answered %d: %s", status, body)
+	}
+	var tokenized struct {
+		EmailID string `json:"emailId"`
+	}
+	if err := json.Unmarshal(body, &tokenized); err != nil {
+		t.Fatal(err)
+	}
+	if tokenized.EmailID == "" || tokenized.EmailID == "ada@example.com" {
+		t.Fatalf("emailId was not tokenized: %s", body)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		value  string
+	}{
+		{"configured role", "admin", http.StatusOK, "ada@example.com"},
+		{"other role", "support", http.StatusForbidden, ""},
+		{"anonymous", "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := map[string][]string{"tokens": {tokenized.EmailID}}
+			status, body := call(t, srv, http.MethodPost, "/detokenize", tt.token, request)
+			if status != tt.status {
+				t.Fatalf("POST /detokenize answered %d, want %d: %s", status, tt.status, body)
+			}
+			if tt.value == "" {
+				return
+			}
+			var answer struct {
+				Tokens []struct {
+					Field string `json:"field"`
+					Value string `json:"value"`
+				} `json:"tokens"`
+			}
+			if err := json.Unmarshal(body, &answer); err != nil {
+				t.Fatal(err)
+			}
+			if len(answer.Tokens) != 1 || answer.Tokens[0].Value != tt.value {
+				t.Errorf("POST /detokenize answered %s, want the value %s", body, tt.value)
+			}
+		})
+	}
+}
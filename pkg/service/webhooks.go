@@ -0,0 +1,156 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"user-details/pkg/controller"
+
+	router "vendor.lib/tng/tng-lib/router/mux"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+func addWebhookHandlers(r *router.Router, ctrl *controller.Controller, auth middleware) {
+	r.HandleWithMetrics("/webhooks", auth(listWebhooks(ctrl))).Methods(http.MethodGet)
+	r.HandleWithMetrics("/webhooks", auth(createWebhook(ctrl))).Methods(http.MethodPost)
+	r.HandleWithMetrics("/webhooks/{id}", auth(getWebhook(ctrl))).Methods(http.MethodGet)
+	r.HandleWithMetrics("/webhooks/{id}", auth(replaceWebhook(ctrl))).Methods(http.MethodPut)
+	r.HandleWithMetrics("/webhooks/{id}", auth(deleteWebhook(ctrl))).Methods(http.MethodDelete)
+	r.HandleWithMetrics("/webhooks/{id}/deliveries", auth(getDeliveries(ctrl))).Methods(http.MethodGet)
+	r.HandleWithMetrics("/webhooks/{id}/deliveries/{deliveryId}/redeliver", auth(redeliver(ctrl))).
+		Methods(http.MethodPost)
+}
+
+func listWebhooks(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		webhooks, err := ctrl.ListWebhooks(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		router.RespondWithJSON(w, http.StatusOK, webhooks)
+	}
+}
+
+func createWebhook(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		webhook, err := ctrl.DecodeWebhook(r.Body)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+
+		webhook, err = ctrl.CreateWebhook(webhook, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/webhooks/"+webhook.ID)
+		router.RespondWithJSON(w, http.StatusCreated, webhook)
+	}
+}
+
+func getWebhook(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		webhook, err := ctrl.FindWebhook(vars["id"], ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		router.RespondWithJSON(w, http.StatusOK, webhook)
+	}
+}
+
+func replaceWebhook(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		webhook, err := ctrl.DecodeWebhook(r.Body)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+
+		webhook, err = ctrl.ReplaceWebhook(vars["id"], webhook, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		router.RespondWithJSON(w, http.StatusOK, webhook)
+	}
+}
+
+func deleteWebhook(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		err := ctrl.RemoveWebhook(vars["id"], ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		router.Respond(w, http.StatusNoContent, nil)
+	}
+}
+
+func getDeliveries(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		params := r.URL.Query()
+		limit := 0
+		if l := params.Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil {
+				router.RespondWithError(w, http.StatusBadRequest, errors.Wrap(err, "invalid limit"))
+				return
+			}
+			limit = n
+		}
+
+		ctx := r.Context()
+		deliveries, err := ctrl.WebhookDeliveries(vars["id"], params.Get("status"), limit, ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		router.RespondWithJSON(w, http.StatusOK, deliveries)
+	}
+}
+
+func redeliver(ctrl *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		ctx := r.Context()
+		delivery, err := ctrl.Redeliver(vars["id"], vars["deliveryId"], ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		router.RespondWithJSON(w, http.StatusAccepted, delivery)
+	}
+}
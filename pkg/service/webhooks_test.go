@@ -0,0 +1,84 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWebhooksRequireManageRole(t *testing.T) {
+	srv, roles := newTestService(t)
+	roles["admin"] = []string{adminRole}
+	roles["support"] = []string{"user-details-support"}
+
+	webhook := map[string]interface{}{"url": "https://example.com/hook", "secret": "0123456789abcdef"}
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		body   interface{}
+		status int
+	}{
+		{"register with the manage role", "admin", http.MethodPost, webhook, http.StatusCreated},
+		{"list with the manage role", "admin", http.MethodGet, nil, http.StatusOK},
+		{"register with another role", "support", http.MethodPost, webhook, http.StatusForbidden},
+		{"list with another role", "support", http.MethodGet, nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, body := call(t, srv, tt.method, "/webhooks", tt.token, tt.body); status != tt.status {
+				t.Errorf("%s /webhooks answered %d, want %d: %s", tt.method, status, tt.status, body)
+			}
+		})
+	}
+}
+
+func TestWebhookSecretsAreNeverReturned(t *testing.T) {
+	srv, roles := newTestService(t)
+	roles["admin"] = []string{adminRole}
+
+	webhook := map[string]interface{}{"url": "https://example.com/hook", "secret": "0123456789abcdef"}
+	status, body := call(t, srv, http.MethodPost, "/webhooks", "admin", webhook)
+	if status != http.StatusCreated {
+		t.Fatalf("POST /webhooks answered %d: %s", status, body)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatal(err)
+	}
+	path := "/webhooks/" + created.ID
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"created", http.MethodPost, "/webhooks", webhook, http.StatusCreated},
+		{"listed", http.MethodGet, "/webhooks", nil, http.StatusOK},
+		{"found", http.MethodGet, path, nil, http.StatusOK},
+		{"replaced", http.MethodPut, path, webhook, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := call(t, srv, tt.method, tt.path, "admin", tt.body)
+			if status != tt.status {
+				t.Fatalf("%s %s answered %d, want %d: %s", tt.method, tt.path, status, tt.status, body)
+			}
+			if strings.Contains(string(body), "secret") || strings.Contains(string(body), "0123456789abcdef") {
+				t.Errorf("%s %s answered the secret: %s", tt.method, tt.path, body)
+			}
+		})
+	}
+
+	if status, body := call(t, srv, http.MethodDelete, path, "admin", nil); status != http.StatusNoContent {
+		t.Fatalf("DELETE %s answered %d: %s", path, status, body)
+	}
+	if status, _ := call(t, srv, http.MethodGet, path, "admin", nil); status != http.StatusNotFound {
+		t.Errorf("GET %s answered %d once deleted, want %d", path, status, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,105 @@
+package tokenization
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+	"user-details/pkg/model"
+)
+
+// prefix starts every token, telling tokens apart from the values they stand for.
+const prefix = "tok_"
+
+// Fields are the user fields, by json name, whose values are replaced by tokens in tokenized responses.
+var Fields = []string{"emailId", "legacyContact", "phones", "emails"}
+
+// Config names the chpRoles allowed to turn tokens back into values.
+type Config struct {
+	DetokenizeRoles []string `json:"detokenize-roles"`
+}
+
+// MayDetokenize reports whether a caller with roles may turn tokens back into values.
+func (c Config) MayDetokenize(roles []string) bool {
+	for _, role := range roles {
+		for _, allowed := range c.DetokenizeRoles {
+			if role == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Vault keeps the values tokens stand for, see db.TokenRepository.
+type Vault interface {
+	Tokenize(token model.Token, ctx context.Context) (model.Token, error)
+}
+
+// User returns user with the values of Fields replaced by the tokens vault keeps for them. Phone numbers and email
+// addresses are tokenized as the fields phones.number and emails.address.
+func User(vault Vault, user model.User, ctx context.Context) (model.User, error) {
+	// the contacts are shared with the caller's user
+	user.Phones = append([]model.Phone(nil), user.Phones...)
+	user.Emails = append([]model.Email(nil), user.Emails...)
+	err := each(&user, func(field string, value *string) error {
+		token, err := Tokenize(vault, field, *value, ctx)
+		if err != nil {
+			return err
+		}
+		*value = token
+		return nil
+	})
+	return user, err
+}
+
+// Values returns the field and value of every value of user that User tokenizes.
+func Values(user model.User) []model.Token {
+	values := make([]model.Token, 0)
+	each(&user, func(field string, value *string) error {
+		values = append(values, model.Token{Field: field, Value: *value})
+		return nil
+	})
+	return values
+}
+
+// each calls fn with every non-empty value of user that is tokenized, along with the field it is tokenized as.
+func each(user *model.User, fn func(field string, value *string) error) error {
+	call := func(field string, value *string) error {
+		if *value == "" {
+			return nil
+		}
+		return fn(field, value)
+	}
+	if err := call("emailId", &user.EmailID); err != nil {
+		return err
+	}
+	if err := call("legacyContact", &user.LegacyContact); err != nil {
+		return err
+	}
+	for i := range user.Phones {
+		if err := call("phones.number", &user.Phones[i].Number); err != nil {
+			return err
+		}
+	}
+	for i := range user.Emails {
+		if err := call("emails.address", &user.Emails[i].Address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tokenize returns the token vault keeps for value of field, issuing a new token for values it has none for.
+func Tokenize(vault Vault, field, value string, ctx context.Context) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := model.Token{Token: prefix + hex.EncodeToString(b), Field: field, Value: value, Created: time.Now().UTC()}
+	stored, err := vault.Tokenize(token, ctx)
+	if err != nil {
+		return "", err
+	}
+	return stored.Token, nil
+}
@@ -0,0 +1,223 @@
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidRule is returned by Check for validate tags naming an unknown rule or a rule with an invalid argument.
+var ErrInvalidRule = errors.New("invalid validation rule")
+
+var (
+	emailPattern    = regexp.MustCompile("^[A-Za-z0-9.!#$%&'*+/=?^_`{|}~-]+@[A-Za-z0-9](?:[A-Za-z0-9-]{0,61}[A-Za-z0-9])?(?:\\.[A-Za-z0-9](?:[A-Za-z0-9-]{0,61}[A-Za-z0-9])?)+$")
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	e164Pattern     = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	statePattern    = regexp.MustCompile(`^[A-Z]{2}$`)
+	zipPattern      = regexp.MustCompile(`^[0-9]{5}(-[0-9]{4})?$`)
+)
+
+// Struct checks the fields of the struct v against the comma separated rules of their validate tag and returns all
+// violations, each pointing at the field by its json name. Nested structs and slices of structs are checked as well.
+// Rules of a string slice apply to each of its elements, except for required which asks for at least one element.
+// Rules other than required skip empty values.
+//
+// Supported rules are required, min=<n> and max=<n> (counted in characters), oneof=<a>|<b>..., email, username,
+// e164, state (two letter US state code) and zip (ZIP or ZIP+4 code). The tags of v are expected to pass Check, rules
+// that do not are reported as violations of the field.
+func Struct(v interface{}) model.FieldErrors {
+	errs := make(model.FieldErrors, 0)
+	walk(reflect.Indirect(reflect.ValueOf(v)), "", &errs)
+	return errs
+}
+
+// Check returns ErrInvalidRule for the first validate tag of the struct v, or of the structs it holds, that Struct
+// cannot apply. It is meant to be called once for every type checked with Struct, before any value is checked.
+func Check(v interface{}) error {
+	return checkType(reflect.Indirect(reflect.ValueOf(v)).Type(), "")
+}
+
+func checkType(t reflect.Type, prefix string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		pointer := prefix + "/" + escape(jsonName(field))
+		if rules, ok := field.Tag.Lookup("validate"); ok {
+			for _, rule := range strings.Split(rules, ",") {
+				if err := known(rule); err != nil {
+					return errors.Wrapf(err, "%s of %s", rule, pointer)
+				}
+			}
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Slice {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Struct {
+			if err := checkType(fieldType, pointer); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// known returns ErrInvalidRule unless check can apply rule.
+func known(rule string) error {
+	name, arg := rule, ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		name, arg = rule[:i], rule[i+1:]
+	}
+	switch name {
+	case "required", "email", "username", "e164", "state", "zip":
+		if arg != "" {
+			return ErrInvalidRule
+		}
+	case "min", "max":
+		if _, err := strconv.Atoi(arg); err != nil {
+			return ErrInvalidRule
+		}
+	case "oneof":
+		if arg == "" {
+			return ErrInvalidRule
+		}
+	default:
+		return ErrInvalidRule
+	}
+	return nil
+}
+
+func walk(value reflect.Value, prefix string, errs *model.FieldErrors) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		pointer := prefix + "/" + escape(jsonName(field))
+		rules, _ := field.Tag.Lookup("validate")
+		fieldValue := value.Field(i)
+
+		switch fieldValue.Kind() {
+		case reflect.String:
+			checkAll(rules, fieldValue.String(), pointer, errs)
+		case reflect.Struct:
+			walk(fieldValue, pointer, errs)
+		case reflect.Slice:
+			if fieldValue.Len() == 0 && hasRule(rules, "required") {
+				*errs = append(*errs, model.FieldError{Pointer: pointer, Message: "is required"})
+			}
+			for j := 0; j < fieldValue.Len(); j++ {
+				elem := fieldValue.Index(j)
+				elemPointer := pointer + "/" + strconv.Itoa(j)
+				switch elem.Kind() {
+				case reflect.String:
+					checkAll(rules, elem.String(), elemPointer, errs)
+				case reflect.Struct:
+					walk(elem, elemPointer, errs)
+				}
+			}
+		}
+	}
+}
+
+// checkAll records the first rule of rules s violates.
+func checkAll(rules, s, pointer string, errs *model.FieldErrors) {
+	if rules == "" {
+		return
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		if msg := check(rule, s); msg != "" {
+			*errs = append(*errs, model.FieldError{Pointer: pointer, Message: msg})
+			return
+		}
+	}
+}
+
+func hasRule(rules, name string) bool {
+	for _, rule := range strings.Split(rules, ",") {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns why s violates rule, or an empty string when it does not. Rules Check rejects are always violated.
+func check(rule, s string) string {
+	if known(rule) != nil {
+		return "cannot be checked against the invalid rule " + rule
+	}
+	name, arg := rule, ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		name, arg = rule[:i], rule[i+1:]
+	}
+	if name == "required" {
+		if strings.TrimSpace(s) == "" {
+			return "is required"
+		}
+		return ""
+	}
+	if s == "" {
+		return ""
+	}
+
+	switch name {
+	case "min":
+		if n, _ := strconv.Atoi(arg); utf8.RuneCountInString(s) < n {
+			return fmt.Sprintf("must be at least %s characters", arg)
+		}
+	case "max":
+		if n, _ := strconv.Atoi(arg); utf8.RuneCountInString(s) > n {
+			return fmt.Sprintf("must be at most %s characters", arg)
+		}
+	case "email":
+		if !emailPattern.MatchString(s) {
+			return "must be a valid email address"
+		}
+	case "username":
+		if !usernamePattern.MatchString(s) {
+			return "may only contain letters, digits, '.', '_' and '-'"
+		}
+	case "e164":
+		if !e164Pattern.MatchString(s) {
+			return "must be an E.164 phone number such as +15555550123"
+		}
+	case "oneof":
+		for _, allowed := range strings.Split(arg, "|") {
+			if s == allowed {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Replace(arg, "|", ", ", -1)
+	case "state":
+		if !statePattern.MatchString(s) {
+			return "must be a two letter state code"
+		}
+	case "zip":
+		if !zipPattern.MatchString(s) {
+			return "must be a ZIP or ZIP+4 code such as 12345-6789"
+		}
+	}
+	return ""
+}
+
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// escape encodes a reference token of a JSON pointer, see RFC 6901.
+func escape(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
@@ -0,0 +1,102 @@
+package validate
+
+import (
+	"testing"
+	"user-details/pkg/model"
+
+	"github.com/pkg/errors"
+)
+
+func TestCheck(t *testing.T) {
+	type nested struct {
+		Code string `json:"code" validate:"oneof="`
+	}
+	tests := []struct {
+		name  string
+		v     interface{}
+		valid bool
+	}{
+		{"user", model.User{}, true},
+		{"consent", model.Consent{}, true},
+		{"merge request", model.MergeRequest{}, true},
+		{"webhook", model.Webhook{}, true},
+		{"unknown rule", struct {
+			Name string `validate:"required,uppercase"`
+		}{}, false},
+		{"invalid length", struct {
+			Name string `validate:"max=ten"`
+		}{}, false},
+		{"argument of a plain rule", struct {
+			Email string `validate:"email=strict"`
+		}{}, false},
+		{"nested in a slice", struct {
+			Codes []nested `json:"codes"`
+		}{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.v)
+			if valid := err == nil; valid != tt.valid || (err != nil && errors.Cause(err) != ErrInvalidRule) {
+				t.Errorf("Check returned %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestStruct(t *testing.T) {
+	type document struct {
+		Name  string   `json:"name" validate:"required,min=2,max=4"`
+		Kind  string   `json:"kind" validate:"oneof=a|b"`
+		Email string   `json:"email" validate:"email"`
+		Phone string   `json:"phone" validate:"e164"`
+		State string   `json:"state" validate:"state"`
+		Zip   string   `json:"zip" validate:"zip"`
+		Tags  []string `json:"tags" validate:"required,max=3"`
+	}
+	valid := document{Name: "Ada", Kind: "a", Email: "ada@example.com", Phone: "+15555550123", State: "NY",
+		Zip: "12345-6789", Tags: []string{"x"}}
+
+	tests := []struct {
+		name    string
+		change  func(d *document)
+		pointer string
+	}{
+		{"valid", func(d *document) {}, ""},
+		{"missing name", func(d *document) { d.Name = " " }, "/name"},
+		{"short name", func(d *document) { d.Name = "A" }, "/name"},
+		{"long name in characters", func(d *document) { d.Name = "Adaét" }, "/name"},
+		{"four characters of more bytes", func(d *document) { d.Name = "Éléa" }, ""},
+		{"unknown kind", func(d *document) { d.Kind = "c" }, "/kind"},
+		{"email", func(d *document) { d.Email = "ada@" }, "/email"},
+		{"phone", func(d *document) { d.Phone = "555-0123" }, "/phone"},
+		{"state", func(d *document) { d.State = "ny" }, "/state"},
+		{"zip", func(d *document) { d.Zip = "1234" }, "/zip"},
+		{"no tags", func(d *document) { d.Tags = nil }, "/tags"},
+		{"long tag", func(d *document) { d.Tags = []string{"x", "long"} }, "/tags/1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := valid
+			tt.change(&d)
+			errs := Struct(d)
+			if tt.pointer == "" {
+				if len(errs) > 0 {
+					t.Errorf("valid document failed with %v", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Pointer != tt.pointer {
+				t.Errorf("document failed with %v, want one error at %s", errs, tt.pointer)
+			}
+		})
+	}
+}
+
+func TestStructReportsInvalidRules(t *testing.T) {
+	broken := struct {
+		Name string `json:"name" validate:"uppercase"`
+	}{}
+	if errs := Struct(broken); len(errs) != 1 || errs[0].Pointer != "/name" {
+		t.Errorf("document of an invalid rule failed with %v, want one error at /name", errs)
+	}
+}
@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+	"user-details/pkg/model"
+)
+
+// Headers deliveries carry besides their JSON event.
+const (
+	// SignatureHeader holds sha256= followed by the hex HMAC-SHA256 of the timestamp, a dot and the body, keyed with
+	// the secret of the webhook.
+	SignatureHeader = "X-Webhook-Signature"
+	// TimestampHeader holds the unix time, in seconds, the delivery was signed at.
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// Defaults of the settings app.json leaves out.
+const (
+	DefaultMaxAttempts = 8
+	DefaultBackoff     = time.Second
+	DefaultMaxBackoff  = time.Hour
+	DefaultBatchSize   = 100
+)
+
+// Config represents the webhook settings read from app.json.
+type Config struct {
+	// Client names the entry of clients deliveries are sent with. Webhook URLs are absolute, so only the transport
+	// settings of the client apply.
+	Client string `json:"client"`
+	// Interval is how often, in milliseconds, due deliveries are sent. Zero disables deliveries.
+	Interval time.Duration `json:"interval-ms"`
+	// MaxAttempts is how many failed attempts make a delivery dead.
+	MaxAttempts int `json:"max-attempts"`
+	// Backoff is the delay, in milliseconds, after the first failed attempt. It doubles with every further failure up
+	// to MaxBackoff.
+	Backoff    time.Duration `json:"backoff-ms"`
+	MaxBackoff time.Duration `json:"max-backoff-ms"`
+	BatchSize  int           `json:"batch-size"`
+	// ManageRoles are the chpRoles allowed to manage webhooks.
+	ManageRoles []string `json:"manage-roles"`
+}
+
+// WithDefaults returns c with the defaults of the settings it leaves out and its durations in milliseconds applied.
+func (c Config) WithDefaults() Config {
+	c.Interval *= time.Millisecond
+	c.Backoff *= time.Millisecond
+	c.MaxBackoff *= time.Millisecond
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = DefaultMaxAttempts
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = DefaultBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = DefaultMaxBackoff
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	return c
+}
+
+// MayManage reports whether a caller with roles may manage webhooks.
+func (c Config) MayManage(roles []string) bool {
+	for _, role := range roles {
+		for _, allowed := range c.ManageRoles {
+			if role == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Delay returns how long to wait before the next attempt of a delivery that failed failures times.
+func (c Config) Delay(failures int) time.Duration {
+	delay := c.Backoff
+	for i := 1; i < failures && delay < c.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > c.MaxBackoff {
+		return c.MaxBackoff
+	}
+	return delay
+}
+
+// Sign returns the value of SignatureHeader for body sent at timestamp to a webhook with secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Matches reports whether events of eventType are delivered to webhook.
+func Matches(webhook model.Webhook, eventType string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, e := range webhook.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliveryID returns the id of the delivery of eventId to webhookId, the same for every relay of the event.
+func DeliveryID(eventId, webhookId string) string {
+	return eventId + "-" + webhookId
+}
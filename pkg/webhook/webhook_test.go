@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+	"user-details/pkg/model"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"type":"user.created"}`)
+	// computed independently with the hmac module of Python
+	want := "sha256=5201e1d8ec15a0b64539fe871758d8034bf85d818e868917795d781f8d50b969"
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      []byte
+		valid     bool
+	}{
+		{"same delivery", "whsec", 1700000000, body, true},
+		{"other secret", "whsec2", 1700000000, body, false},
+		{"replayed later", "whsec", 1700000001, body, false},
+		{"tampered body", "whsec", 1700000000, []byte(`{"type":"user.deleted"}`), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if valid := Sign(tt.secret, tt.timestamp, tt.body) == want; valid != tt.valid {
+				t.Errorf("signature is valid: %v, want %v", valid, tt.valid)
+			}
+		})
+	}
+}
+
+func TestDelay(t *testing.T) {
+	conf := Config{Backoff: 1000, MaxBackoff: 60000}.WithDefaults()
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{6, 32 * time.Second},
+		{7, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := conf.Delay(tt.failures); got != tt.want {
+			t.Errorf("delay after %d failures is %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	got := Config{Interval: 500}.WithDefaults()
+	want := Config{Interval: 500 * time.Millisecond, MaxAttempts: DefaultMaxAttempts, Backoff: DefaultBackoff,
+		MaxBackoff: DefaultMaxBackoff, BatchSize: DefaultBatchSize}
+	if got.Interval != want.Interval || got.MaxAttempts != want.MaxAttempts || got.Backoff != want.Backoff ||
+		got.MaxBackoff != want.MaxBackoff || got.BatchSize != want.BatchSize {
+		t.Errorf("defaults are %+v, want %+v", got, want)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		want   bool
+	}{
+		{"every event", nil, true},
+		{"subscribed", []string{"user.deleted", "user.created"}, true},
+		{"not subscribed", []string{"user.deleted"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Matches(model.Webhook{Events: tt.events}, "user.created"); got != tt.want {
+				t.Errorf("Matches returned %v, want %v", got, tt.want)
+			}
+		})
+	}
+}